@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/egorban/navprot/pkg/convertation"
+	"github.com/egorban/navprot/pkg/ndtp"
+)
+
+func runConvert(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := newFlagSet("convert", "[file]")
+	format := fs.String("format", formatAuto, "input format: auto, hex, base64 or raw")
+	output := fs.String("o", "", "output file of EGTS stream (required)")
+	report := fs.String("report", "", "report file of skipped packets (default <output>.report)")
+	terminal := fs.Uint("terminal", 0, "terminal ID used until the first NPH_SGC_CONN_REQUEST packet")
+	idMap := fs.String("id-map", "", "file with lines \"<terminal ID> <object ID>\", unmapped terminals keep their IDs")
+	packetID := fs.Uint("packet-id", 0, "identifier of the first EGTS packet")
+	recordNum := fs.Uint("record-num", 0, "number of the first EGTS record")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *output == "" {
+		fs.Usage()
+		return errors.New("output file is not set")
+	}
+	if *packetID > 0xFFFF || *recordNum > 0xFFFF || uint64(*terminal) > 0xFFFFFFFF {
+		return errors.New("packet-id, record-num or terminal is out of range")
+	}
+	if *report == "" {
+		*report = *output + ".report"
+	}
+	// terminal ID 0 is valid, so it's checked whether flag is set
+	hasTerminal := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "terminal" {
+			hasTerminal = true
+		}
+	})
+	c := &converter{
+		terminal:    uint32(*terminal),
+		hasTerminal: hasTerminal,
+		packetID:    uint16(*packetID),
+		recordNum:   uint16(*recordNum),
+	}
+	if *idMap != "" {
+		var err error
+		if c.ids, err = loadIDMap(*idMap); err != nil {
+			return err
+		}
+	}
+	data, err := readInput(fs.Arg(0), *format, stdin)
+	if err != nil {
+		return err
+	}
+	out, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	rep, err := os.Create(*report)
+	if err != nil {
+		return err
+	}
+	defer rep.Close()
+	w := bufio.NewWriter(out)
+	c.report = bufio.NewWriter(rep)
+	if err = c.convert(bytes.NewReader(data), w); err != nil {
+		return err
+	}
+	if err = w.Flush(); err != nil {
+		return err
+	}
+	if err = c.report.Flush(); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(stdout, "converted %d packets, skipped %d\n", c.converted, c.skipped)
+	return err
+}
+
+// converter converts NDTP stream to EGTS stream. Terminal ID is taken from NPH_SGC_CONN_REQUEST packets
+// and mapped to EGTS object ID by ids. Packet ID and record number are incremented for each EGTS packet.
+type converter struct {
+	ids         map[uint32]uint32
+	terminal    uint32
+	hasTerminal bool
+	packetID    uint16
+	recordNum   uint16
+	report      *bufio.Writer
+	converted   int
+	skipped     int
+}
+
+func (c *converter) convert(r io.Reader, w io.Writer) error {
+	dec := ndtp.NewDecoder(r)
+	for n := 1; ; n++ {
+		packet, err := dec.Decode()
+		switch {
+		case err == io.EOF:
+			return c.summary()
+		case err == ndtp.ErrCRC || err == ndtp.ErrPacketTooLarge:
+			c.skip(n, err.Error())
+			continue
+		case err == io.ErrUnexpectedEOF:
+			c.skip(n, "truncated packet at the end of stream")
+			return c.summary()
+		case err != nil && packet == nil:
+			return err
+		case err != nil:
+			c.skip(n, err.Error())
+			continue
+		}
+		if err = c.convertPacket(n, packet, w); err != nil {
+			return err
+		}
+	}
+}
+
+func (c *converter) convertPacket(n int, packet *ndtp.Packet, w io.Writer) error {
+	if packet.PacketType() == ndtp.NphSgsConnRequest {
+		id, _ := packet.GetID()
+		c.terminal = uint32(id)
+		c.hasTerminal = true
+		return nil
+	}
+	if packet.Service() != ndtp.NphSrvNavdata || packet.IsResult() {
+		c.skip(n, fmt.Sprintf("service %d packet type %d is not navigation data", packet.Nph.ServiceID, packet.Nph.PacketType))
+		return nil
+	}
+	if !c.hasTerminal {
+		c.skip(n, "terminal ID is unknown")
+		return nil
+	}
+	id, ok := c.ids[c.terminal]
+	if !ok {
+		id = c.terminal
+	}
+	egtsPacket, err := convertation.ToEGTS(packet, id, c.packetID, c.recordNum)
+	if err != nil {
+		c.skip(n, err.Error())
+		return nil
+	}
+	if len(egtsPacket.Records[0].Data) == 0 {
+		c.skip(n, "no data supported by EGTS")
+		return nil
+	}
+	message, err := egtsPacket.Form()
+	if err != nil {
+		c.skip(n, err.Error())
+		return nil
+	}
+	if _, err = w.Write(message); err != nil {
+		return err
+	}
+	c.packetID++
+	c.recordNum++
+	c.converted++
+	return nil
+}
+
+func (c *converter) skip(n int, reason string) {
+	c.skipped++
+	fmt.Fprintf(c.report, "packet %d: %s\n", n, reason)
+}
+
+func (c *converter) summary() error {
+	_, err := fmt.Fprintf(c.report, "converted %d packets, skipped %d\n", c.converted, c.skipped)
+	return err
+}
+
+// loadIDMap reads lines "<terminal ID> <object ID>", empty lines and lines starting with # are ignored
+func loadIDMap(name string) (map[uint32]uint32, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseIDMap(f, name)
+}
+
+func parseIDMap(r io.Reader, name string) (map[uint32]uint32, error) {
+	ids := make(map[uint32]uint32)
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected terminal ID and object ID", name, line)
+		}
+		terminal, err := strconv.ParseUint(fields[0], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", name, line, err)
+		}
+		object, err := strconv.ParseUint(fields[1], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", name, line, err)
+		}
+		ids[uint32(terminal)] = uint32(object)
+	}
+	return ids, scanner.Err()
+}
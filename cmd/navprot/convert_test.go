@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/egorban/navprot/pkg/egts"
+	"github.com/egorban/navprot/pkg/ndtp"
+)
+
+func TestConvert(t *testing.T) {
+	dir, err := ioutil.TempDir("", "navprot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	idMap := filepath.Join(dir, "ids")
+	if err = ioutil.WriteFile(idMap, []byte("# terminal object\n1024 5000\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	connRequest, err := ndtp.NewConnRequest(1024).Form()
+	if err != nil {
+		t.Fatal(err)
+	}
+	empty, err := ndtp.NewNavData(false, []ndtp.Subrecord{}).Form()
+	if err != nil {
+		t.Fatal(err)
+	}
+	nav := ndtpStream(t)
+	input := append(append(append([]byte(nil), nav...), connRequest...), empty...)
+	input = append(input, nav...)
+
+	output := filepath.Join(dir, "out.egts")
+	var stdout bytes.Buffer
+	args := []string{"convert", "-format", "raw", "-o", output, "-id-map", idMap, "-packet-id", "7", "-record-num", "100"}
+	if err = run(args, bytes.NewReader(input), &stdout); err != nil {
+		t.Fatalf("convert error = %v", err)
+	}
+	if want := "converted 2 packets, skipped 5\n"; stdout.String() != want {
+		t.Errorf("convert output = %q, want %q", stdout.String(), want)
+	}
+
+	data, err := ioutil.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec := egts.NewDecoder(bytes.NewReader(data))
+	for i := 0; i < 2; i++ {
+		packet, err := dec.Decode()
+		if err != nil {
+			t.Fatalf("Decode() error = %v", err)
+		}
+		rec := packet.Records[0]
+		if packet.ID != uint16(7+i) || rec.RecNum != uint16(100+i) || rec.ID != 5000 {
+			t.Errorf("packet %d = %v", i, packet)
+		}
+	}
+	if _, err = dec.Decode(); err != io.EOF {
+		t.Errorf("Decode() error = %v, want EOF", err)
+	}
+
+	report, err := ioutil.ReadFile(output + ".report")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"packet 1: terminal ID is unknown",
+		"packet 2: ndtp: crc incorrect",
+		"packet 3: terminal ID is unknown",
+		"packet 5: no data supported by EGTS",
+		"packet 7: ndtp: crc incorrect",
+		"converted 2 packets, skipped 5",
+	} {
+		if !strings.Contains(string(report), want) {
+			t.Errorf("report %q doesn't contain %q", report, want)
+		}
+	}
+}
+
+func TestConvert_terminalZero(t *testing.T) {
+	dir, err := ioutil.TempDir("", "navprot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	nav, err := ndtp.NewNavData(true, []ndtp.Subrecord{&ndtp.NavData{Time: 1522961700, Valid: true}}).Form()
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := filepath.Join(dir, "out.egts")
+	var stdout bytes.Buffer
+	args := []string{"convert", "-format", "raw", "-o", output, "-terminal", "0"}
+	if err = run(args, bytes.NewReader(nav), &stdout); err != nil {
+		t.Fatalf("convert error = %v", err)
+	}
+	if want := "converted 1 packets, skipped 0\n"; stdout.String() != want {
+		t.Errorf("convert output = %q, want %q", stdout.String(), want)
+	}
+	data, err := ioutil.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	packet, err := egts.NewDecoder(bytes.NewReader(data)).Decode()
+	if err != nil || packet.Records[0].ID != 0 {
+		t.Errorf("Decode() = %v, %v, want record of object 0", packet, err)
+	}
+}
+
+func TestParseIDMap(t *testing.T) {
+	ids, err := parseIDMap(strings.NewReader("1 2\n\n# comment\n 3\t4 \n"), "ids")
+	if err != nil {
+		t.Fatalf("parseIDMap() error = %v", err)
+	}
+	if len(ids) != 2 || ids[1] != 2 || ids[3] != 4 {
+		t.Errorf("parseIDMap() = %v", ids)
+	}
+	if _, err = parseIDMap(strings.NewReader("1 2 3\n"), "ids"); err == nil {
+		t.Error("parseIDMap() of incorrect line succeeded")
+	}
+}
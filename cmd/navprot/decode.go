@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/egorban/navprot/pkg/detector"
+	"github.com/egorban/navprot/pkg/egts"
+	"github.com/egorban/navprot/pkg/ndtp"
+)
+
+func runDecode(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := newFlagSet("decode", "[file]")
+	format := fs.String("format", formatAuto, "input format: auto, hex, base64 or raw")
+	proto := fs.String("proto", protoAuto, "protocol: auto, ndtp or egts")
+	asJSON := fs.Bool("json", false, "print packets as JSON lines instead of text")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	data, err := readInput(fs.Arg(0), *format, stdin)
+	if err != nil {
+		return err
+	}
+	if *proto == protoAuto {
+		p, _, ok := detector.New().Find(data)
+		if !ok {
+			return errors.New("neither NDTP nor EGTS packet found")
+		}
+		*proto = p.Name
+	}
+	dec, err := newPacketDecoder(*proto, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	out := &decodeOutput{w: stdout, proto: *proto, json: *asJSON}
+	for {
+		packet, err := dec.decode()
+		if err == io.EOF {
+			return nil
+		}
+		if err := out.print(packet, dec.Skipped(), err); err != nil {
+			return err
+		}
+		// output is partial, so error is returned to make exit status non-zero
+		if packet == nil && !dec.recoverable(err) {
+			return fmt.Errorf("decoding stopped after %d packets: %v", out.n, err)
+		}
+	}
+}
+
+// packetDecoder is a common interface of NDTP and EGTS decoders
+type packetDecoder interface {
+	decode() (interface{}, error)
+	// recoverable reports whether decoding can be continued after error returned without packet
+	recoverable(err error) bool
+	Skipped() int
+}
+
+type ndtpDecoder struct {
+	*ndtp.Decoder
+}
+
+func (d ndtpDecoder) decode() (interface{}, error) {
+	packet, err := d.Decode()
+	if packet == nil {
+		return nil, err
+	}
+	return packet, err
+}
+
+func (d ndtpDecoder) recoverable(err error) bool {
+	return err == ndtp.ErrCRC || err == ndtp.ErrPacketTooLarge
+}
+
+type egtsDecoder struct {
+	*egts.Decoder
+}
+
+func (d egtsDecoder) decode() (interface{}, error) {
+	packet, err := d.Decode()
+	if packet == nil {
+		return nil, err
+	}
+	return packet, err
+}
+
+func (d egtsDecoder) recoverable(err error) bool {
+	return err == egts.ErrCRC || err == egts.ErrPacketTooLarge
+}
+
+func newPacketDecoder(proto string, r io.Reader) (packetDecoder, error) {
+	switch proto {
+	case protoNDTP:
+		return ndtpDecoder{ndtp.NewDecoder(r)}, nil
+	case protoEGTS:
+		return egtsDecoder{egts.NewDecoder(r)}, nil
+	}
+	return nil, fmt.Errorf("unknown protocol %q", proto)
+}
+
+type decodeOutput struct {
+	w     io.Writer
+	proto string
+	json  bool
+	n     int
+}
+
+type decodedJSON struct {
+	N        int         `json:"n"`
+	Protocol string      `json:"protocol"`
+	Skipped  int         `json:"skipped,omitempty"`
+	Packet   interface{} `json:"packet,omitempty"`
+	Error    string      `json:"error,omitempty"`
+}
+
+// print writes packet and error of the same decoding step, packet or error can be nil
+func (o *decodeOutput) print(packet interface{}, skipped int, decErr error) error {
+	if packet != nil {
+		o.n++
+	}
+	if o.json {
+		v := decodedJSON{N: o.n, Protocol: o.proto, Skipped: skipped, Packet: packet}
+		if decErr != nil {
+			v.Error = decErr.Error()
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(o.w, "%s\n", b)
+		return err
+	}
+	if skipped > 0 {
+		if _, err := fmt.Fprintf(o.w, "skipped %d bytes\n", skipped); err != nil {
+			return err
+		}
+	}
+	if packet != nil {
+		if _, err := fmt.Fprintf(o.w, "%s #%d: %v\n", o.proto, o.n, packet); err != nil {
+			return err
+		}
+	}
+	if decErr != nil {
+		if _, err := fmt.Fprintf(o.w, "error: %v\n", decErr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/egorban/navprot/pkg/egts"
+	"github.com/egorban/navprot/pkg/ndtp"
+)
+
+func ndtpStream(t *testing.T) []byte {
+	packet := ndtp.NewNavData(true, []ndtp.Subrecord{
+		&ndtp.NavData{Time: 1522961700, Lon: 37.6925783, Lat: 55.7890249, Valid: true},
+	})
+	message, err := packet.Form()
+	if err != nil {
+		t.Fatal(err)
+	}
+	corrupted := append([]byte(nil), message...)
+	corrupted[len(corrupted)-1]++
+	stream := append([]byte{0, 0}, message...)
+	stream = append(stream, corrupted...)
+	return append(stream, message...)
+}
+
+func egtsStream(t *testing.T) []byte {
+	packet := &egts.Packet{Type: egts.EgtsPtAppdata, ID: 1, Records: []*egts.Record{{
+		RecNum:  1,
+		ID:      100,
+		Service: egts.EgtsTeledataService,
+		Data:    []*egts.SubRecord{{Type: egts.EgtsSrLiquidLevelSensor, Data: &egts.FuelData{Type: 2, Fuel: 30}}},
+	}}}
+	message, err := packet.Form()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return message
+}
+
+func TestDecode(t *testing.T) {
+	ndtpData := ndtpStream(t)
+	egtsData := egtsStream(t)
+	ndtpWant := []string{"skipped 2 bytes", "ndtp #1: NPL:", "skipped 1 bytes", "error: ndtp: crc incorrect",
+		"skipped 52 bytes", "ndtp #2: NPL:"}
+	tests := []struct {
+		name    string
+		args    []string
+		input   string
+		want    []string
+		wantErr bool
+	}{
+		{name: "ndtpRaw", args: nil, input: string(ndtpData),
+			want: ndtpWant},
+		{name: "ndtpHex", args: []string{"-format", "hex"}, input: hex.EncodeToString(ndtpData) + "\n",
+			want: ndtpWant},
+		{name: "egtsBase64", args: []string{"-format", "auto"}, input: base64.StdEncoding.EncodeToString(egtsData),
+			want: []string{"egts #1: Header: {PacketType:1; ID:1}"}},
+		{name: "truncated", args: []string{"-proto", "egts"}, input: string(egtsData[:len(egtsData)-1]),
+			want: []string{"skipped", "error: unexpected EOF"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := run(append([]string{"decode"}, tt.args...), strings.NewReader(tt.input), &out)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decode error = %v, wantErr %v", err, tt.wantErr)
+			}
+			lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+			if len(lines) != len(tt.want) {
+				t.Fatalf("decode output:\n%s\nwant %d lines", out.String(), len(tt.want))
+			}
+			for i, want := range tt.want {
+				if !strings.HasPrefix(lines[i], want) {
+					t.Errorf("line %d = %q, want prefix %q", i, lines[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestDecode_JSON(t *testing.T) {
+	var out bytes.Buffer
+	if err := run([]string{"decode", "-json"}, bytes.NewReader(ndtpStream(t)), &out); err != nil {
+		t.Fatalf("decode error = %v", err)
+	}
+	dec := json.NewDecoder(&out)
+	var results []decodedJSON
+	for dec.More() {
+		var v decodedJSON
+		if err := dec.Decode(&v); err != nil {
+			t.Fatalf("incorrect JSON output: %v", err)
+		}
+		results = append(results, v)
+	}
+	if len(results) != 3 {
+		t.Fatalf("got %d JSON lines, want 3", len(results))
+	}
+	if results[0].Skipped != 2 || results[0].Packet == nil || results[1].Error != ndtp.ErrCRC.Error() ||
+		results[2].N != 2 || results[2].Packet == nil {
+		t.Errorf("incorrect JSON output %+v", results)
+	}
+}
+
+func TestDecode_noPackets(t *testing.T) {
+	if err := run([]string{"decode", "-format", "raw"}, strings.NewReader("garbage"), new(bytes.Buffer)); err == nil {
+		t.Error("decode of garbage succeeded")
+	}
+}
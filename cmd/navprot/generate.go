@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/egorban/navprot/pkg/egts"
+	"github.com/egorban/navprot/pkg/general"
+	"github.com/egorban/navprot/pkg/generator"
+	"github.com/egorban/navprot/pkg/ndtp"
+)
+
+func runGenerate(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := newFlagSet("generate", "")
+	proto := fs.String("proto", ndtp.ProtocolName, "protocol of packets: ndtp or egts")
+	output := fs.String("o", "", "output file of packets stream")
+	addr := fs.String("addr", "", "server address host:port, every vehicle sends packets over its own connection")
+	auth := fs.Bool("auth", false, "write authorization packet before the first packet of every vehicle to output file")
+	pace := fs.Float64("pace", 0, "time factor of sending to server, 1 is real time, 0 sends as fast as replies are received")
+	var conf generator.Config
+	fs.IntVar(&conf.Vehicles, "vehicles", 1, "number of vehicles")
+	firstID := fs.Uint("first-id", 1, "identifier of the first vehicle")
+	fs.IntVar(&conf.Points, "points", generator.DefaultPoints, "number of points of every vehicle")
+	fs.DurationVar(&conf.Interval, "interval", generator.DefaultInterval, "time between points of vehicle")
+	start := fs.String("start", "", "time of the first point in RFC 3339 format (default current time)")
+	lat := fs.Float64("lat", float64(generator.DefaultCenter.Lat), "latitude of area center")
+	lon := fs.Float64("lon", float64(generator.DefaultCenter.Lon), "longitude of area center")
+	fs.Float64Var(&conf.Radius, "radius", generator.DefaultRadius, "radius of area in km")
+	speed := fs.Float64("speed", generator.DefaultSpeed, "mean speed in km/h")
+	fs.Float64Var(&conf.SosRate, "sos", 0, "probability of SOS point")
+	fs.Float64Var(&conf.HistoryRate, "history", 0, "probability of history point")
+	fs.Int64Var(&conf.Seed, "seed", 0, "seed of random tracks")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if (*output == "") == (*addr == "") {
+		fs.Usage()
+		return errors.New("exactly one of output file and server address must be set")
+	}
+	if uint64(*firstID) > 0xFFFFFFFF {
+		return errors.New("first-id is out of range")
+	}
+	if *start != "" {
+		var err error
+		if conf.Start, err = time.Parse(time.RFC3339, *start); err != nil {
+			return err
+		}
+	}
+	conf.FirstID = uint32(*firstID)
+	conf.Center = generator.Point{Lat: general.Degrees(*lat), Lon: general.Degrees(*lon)}
+	conf.Speed = general.KmH(*speed)
+	g, err := generator.New(conf)
+	if err != nil {
+		return err
+	}
+	if *proto != ndtp.ProtocolName && *proto != egts.ProtocolName {
+		return fmt.Errorf("unknown protocol %q", *proto)
+	}
+	if *addr != "" {
+		return sendGenerated(g, *proto, *addr, *pace, stdout)
+	}
+	return writeGenerated(g, *proto, *output, *auth, stdout)
+}
+
+func writeGenerated(g *generator.Generator, proto, output string, auth bool, stdout io.Writer) error {
+	out, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	w := bufio.NewWriter(out)
+	enc, err := generator.NewEncoder(w, proto)
+	if err != nil {
+		return err
+	}
+	authorized := make(map[uint32]bool)
+	n := 0
+	for {
+		s, err := g.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if auth && !authorized[s.ID] {
+			authorized[s.ID] = true
+			if err = enc.EncodeAuth(s.ID); err != nil {
+				return err
+			}
+		}
+		if err = enc.Encode(s); err != nil {
+			return err
+		}
+		n++
+	}
+	if err = w.Flush(); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(stdout, "generated %d packets of %d vehicles\n", n, len(g.Vehicles()))
+	return err
+}
+
+// sendCounters counts results of sending generated packets
+type sendCounters struct {
+	mu           sync.Mutex
+	sent, failed int
+	lastErr      error
+}
+
+func (c *sendCounters) add(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err != nil {
+		c.failed++
+		c.lastErr = err
+	} else {
+		c.sent++
+	}
+}
+
+// sendGenerated sends tracks of vehicles concurrently, every vehicle uses its own connection
+func sendGenerated(g *generator.Generator, proto, addr string, pace float64, stdout io.Writer) error {
+	var counters sendCounters
+	var wg sync.WaitGroup
+	started := time.Now()
+	for _, v := range g.Vehicles() {
+		wg.Add(1)
+		go func(v *generator.Vehicle) {
+			defer wg.Done()
+			var err error
+			if proto == ndtp.ProtocolName {
+				err = sendNDTP(v, addr, pace, started, &counters)
+			} else {
+				err = sendEGTS(v, addr, pace, started, &counters)
+			}
+			if err != nil {
+				counters.add(fmt.Errorf("vehicle %d: %v", v.ID, err))
+			}
+		}(v)
+	}
+	wg.Wait()
+	fmt.Fprintf(stdout, "sent %d packets, failed %d\n", counters.sent, counters.failed)
+	return counters.lastErr
+}
+
+// eachSample calls send for every sample of vehicle, samples are delayed according to pace
+func eachSample(v *generator.Vehicle, pace float64, started time.Time, send func(s *generator.Sample) error) error {
+	var first time.Time
+	for {
+		s, err := v.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if pace > 0 {
+			if first.IsZero() {
+				first = s.Nav.GetTime()
+			}
+			offset := time.Duration(float64(s.Nav.GetTime().Sub(first)) / pace)
+			time.Sleep(time.Until(started.Add(offset)))
+		}
+		if err = send(s); err != nil {
+			return err
+		}
+	}
+}
+
+func sendNDTP(v *generator.Vehicle, addr string, pace float64, started time.Time, counters *sendCounters) error {
+	terminal := ndtp.NewTerminal(addr, v.ID)
+	defer terminal.Close()
+	if err := terminal.Connect(); err != nil {
+		return err
+	}
+	return eachSample(v, pace, started, func(s *generator.Sample) error {
+		packet, err := generator.NDTPPacket(s)
+		if err != nil {
+			return err
+		}
+		err = terminal.Send(packet)
+		if _, ok := err.(*ndtp.ResultError); ok {
+			counters.add(err)
+			return nil
+		}
+		if err == nil {
+			counters.add(nil)
+		}
+		return err
+	})
+}
+
+func sendEGTS(v *generator.Vehicle, addr string, pace float64, started time.Time, counters *sendCounters) error {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return err
+	}
+	confirmed := make(chan struct{}, 1)
+	notify := func() {
+		select {
+		case confirmed <- struct{}{}:
+		default:
+		}
+	}
+	client := egts.NewClient(conn, egts.ClientConfig{
+		OnConfirm: func(rec *egts.Record) {
+			if rec.Service == egts.EgtsTeledataService {
+				counters.add(nil)
+			}
+			notify()
+		},
+		OnFail: func(rec *egts.Record, err error) {
+			counters.add(err)
+			notify()
+		},
+	})
+	defer client.Close()
+	var recNum uint16
+	if err = client.Send(generator.EGTSAuthPacket(v.ID, recNum)); err != nil {
+		return err
+	}
+	err = eachSample(v, pace, started, func(s *generator.Sample) error {
+		recNum++
+		packet, err := generator.EGTSPacket(s, recNum)
+		if err != nil {
+			return err
+		}
+		return client.Send(packet)
+	})
+	if err != nil {
+		return err
+	}
+	for client.Pending() > 0 {
+		select {
+		case <-confirmed:
+		case <-client.Done():
+			return client.Err()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/egorban/navprot/internal/testserver"
+	"github.com/egorban/navprot/pkg/egts"
+	"github.com/egorban/navprot/pkg/ndtp"
+)
+
+func TestGenerate_file(t *testing.T) {
+	dir, err := ioutil.TempDir("", "navprot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	output := filepath.Join(dir, "out.egts")
+	var stdout bytes.Buffer
+	args := []string{"generate", "-proto", "egts", "-o", output, "-auth", "-vehicles", "2", "-points", "5",
+		"-start", "2020-01-01T00:00:00Z", "-seed", "3"}
+	if err = run(args, nil, &stdout); err != nil {
+		t.Fatalf("generate error = %v", err)
+	}
+	if want := "generated 10 packets of 2 vehicles\n"; stdout.String() != want {
+		t.Errorf("generate output = %q, want %q", stdout.String(), want)
+	}
+	data, err := ioutil.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec := egts.NewDecoder(bytes.NewReader(data))
+	var auth, teledata int
+	for {
+		packet, err := dec.Decode()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Decode() error = %v", err)
+		}
+		switch packet.Records[0].Service {
+		case egts.EgtsAuthService:
+			auth++
+		case egts.EgtsTeledataService:
+			teledata++
+		}
+	}
+	if auth != 2 || teledata != 10 {
+		t.Errorf("%d auth and %d teledata packets, want 2 and 10", auth, teledata)
+	}
+}
+
+func TestGenerate_live(t *testing.T) {
+	l := testserver.Listen(t, "127.0.0.1:0", func(conn net.Conn) {
+		ndtp.NewSession(conn, func(id int, packet *ndtp.Packet) uint32 {
+			return ndtp.NphResultOk
+		}).Serve()
+	})
+	defer l.Close()
+	var stdout bytes.Buffer
+	args := []string{"generate", "-addr", l.Addr().String(), "-vehicles", "3", "-points", "4"}
+	if err := run(args, nil, &stdout); err != nil {
+		t.Fatalf("generate error = %v", err)
+	}
+	if want := "sent 12 packets, failed 0\n"; stdout.String() != want {
+		t.Errorf("generate output = %q, want %q", stdout.String(), want)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// Input formats
+const (
+	formatAuto   = "auto"
+	formatHex    = "hex"
+	formatBase64 = "base64"
+	formatRaw    = "raw"
+)
+
+// Protocols
+const (
+	protoAuto = "auto"
+	protoNDTP = "ndtp"
+	protoEGTS = "egts"
+)
+
+// readInput reads file name, or stdin if name is empty or "-", and decodes it according to format
+func readInput(name, format string, stdin io.Reader) ([]byte, error) {
+	r := stdin
+	if name != "" && name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return decodeInput(data, format)
+}
+
+// decodeInput converts hex or base64 text to binary. Auto format is hex, if data consists of hex digits
+// and spaces, base64, if data is correct base64 text, and raw otherwise.
+func decodeInput(data []byte, format string) ([]byte, error) {
+	switch format {
+	case formatRaw:
+		return data, nil
+	case formatHex:
+		return hex.DecodeString(string(stripSpaces(data)))
+	case formatBase64:
+		return base64.StdEncoding.DecodeString(string(stripSpaces(data)))
+	case formatAuto:
+		text := stripSpaces(data)
+		if len(text) == 0 {
+			return data, nil
+		}
+		if b, err := hex.DecodeString(string(text)); err == nil {
+			return b, nil
+		}
+		if b, err := base64.StdEncoding.DecodeString(string(text)); err == nil {
+			return b, nil
+		}
+		return data, nil
+	}
+	return nil, fmt.Errorf("unknown input format %q", format)
+}
+
+func stripSpaces(data []byte) []byte {
+	return bytes.Join(bytes.Fields(data), nil)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/egorban/navprot/pkg/load"
+	"github.com/egorban/navprot/pkg/ndtp"
+	"github.com/egorban/navprot/pkg/replay"
+)
+
+func runLoad(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := newFlagSet("load", "")
+	var conf load.Config
+	fs.StringVar(&conf.Addr, "addr", "", "server address host:port (required)")
+	fs.StringVar(&conf.Protocol, "proto", ndtp.ProtocolName, "protocol: ndtp or egts")
+	fs.IntVar(&conf.Connections, "conns", 100, "number of concurrent connections")
+	fs.Float64Var(&conf.Rate, "rate", load.DefaultRate, "packets per second of every connection")
+	fs.DurationVar(&conf.Duration, "duration", load.DefaultDuration, "time of sending packets")
+	fs.DurationVar(&conf.RampUp, "ramp-up", 0, "time, during which connections are opened evenly")
+	fs.DurationVar(&conf.ReplyTimeout, "timeout", replay.DefaultReplyTimeout, "time to wait for reply")
+	firstID := fs.Uint("first-id", 1, "terminal identifier of the first connection")
+	fs.Int64Var(&conf.Track.Seed, "seed", 0, "seed of random tracks")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if conf.Addr == "" {
+		fs.Usage()
+		return errors.New("server address is not set")
+	}
+	if uint64(*firstID) > 0xFFFFFFFF {
+		return errors.New("first-id is out of range")
+	}
+	conf.Track.FirstID = uint32(*firstID)
+	report, err := load.Run(conf)
+	if err != nil {
+		return err
+	}
+	if report.Err != nil {
+		fmt.Fprintln(stdout, "last error:", report.Err)
+	}
+	_, err = fmt.Fprintln(stdout, report)
+	return err
+}
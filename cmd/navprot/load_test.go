@@ -0,0 +1,30 @@
+package main
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/egorban/navprot/internal/testserver"
+	"github.com/egorban/navprot/pkg/ndtp"
+)
+
+func TestLoad(t *testing.T) {
+	l := testserver.Listen(t, "127.0.0.1:0", func(conn net.Conn) {
+		ndtp.NewSession(conn, func(id int, packet *ndtp.Packet) uint32 {
+			return ndtp.NphResultOk
+		}).Serve()
+	})
+	defer l.Close()
+	var stdout bytes.Buffer
+	args := []string{"load", "-addr", l.Addr().String(), "-conns", "10", "-rate", "20", "-duration", "100ms"}
+	if err := run(args, nil, &stdout); err != nil {
+		t.Fatalf("load error = %v", err)
+	}
+	out := stdout.String()
+	if !strings.HasPrefix(out, "connections 10, connect errors 0, auth errors 0, disconnects 0\nsent 20, replied 20,") ||
+		!strings.Contains(out, "throughput") {
+		t.Errorf("load output = %q", out)
+	}
+}
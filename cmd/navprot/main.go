@@ -0,0 +1,81 @@
+/*
+Command navprot is a tool for inspecting and converting navigation protocols traffic.
+
+Usage:
+
+	navprot <command> [flags] [arguments]
+
+Run "navprot <command> -h" for flags of command.
+*/
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+type command struct {
+	name    string
+	summary string
+	run     func(args []string, stdin io.Reader, stdout io.Writer) error
+}
+
+var commands = []command{
+	{name: "decode", summary: "print packets of NDTP or EGTS stream", run: runDecode},
+	{name: "convert", summary: "convert NDTP stream to EGTS stream", run: runConvert},
+	{name: "pcap", summary: "print NDTP and EGTS packets of pcap or pcapng capture", run: runPcap},
+	{name: "replay", summary: "send recorded packets to server and check replies", run: runReplay},
+	{name: "proxy", summary: "forward terminal connections and log decoded packets as JSON", run: runProxy},
+	{name: "generate", summary: "generate synthetic tracks of vehicles as NDTP or EGTS packets", run: runGenerate},
+	{name: "load", summary: "benchmark server with many concurrent connections", run: runLoad},
+	{name: "retranslate", summary: "run NDTP to EGTS retranslator service", run: runRetranslate},
+}
+
+func main() {
+	err := run(os.Args[1:], os.Stdin, os.Stdout)
+	if err == flag.ErrHelp {
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "navprot:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdin io.Reader, stdout io.Writer) error {
+	if len(args) == 0 {
+		usage(os.Stderr)
+		return flag.ErrHelp
+	}
+	for _, cmd := range commands {
+		if cmd.name == args[0] {
+			return cmd.run(args[1:], stdin, stdout)
+		}
+	}
+	if args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		usage(stdout)
+		return nil
+	}
+	usage(os.Stderr)
+	return errors.New("unknown command " + args[0])
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: navprot <command> [flags] [arguments]\n\nCommands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-10s %s\n", cmd.name, cmd.summary)
+	}
+}
+
+func newFlagSet(name, args string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: navprot %s [flags] %s\n", name, args)
+		fs.PrintDefaults()
+	}
+	return fs
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/egorban/navprot/pkg/pcap"
+)
+
+func runPcap(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := newFlagSet("pcap", "[file]")
+	asJSON := fs.Bool("json", false, "print packets as JSON lines instead of text")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	r := stdin
+	if name := fs.Arg(0); name != "" && name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	packets, err := pcap.ReadPackets(r)
+	if err != nil {
+		return err
+	}
+	for _, p := range packets {
+		if err = printCaptured(stdout, p, *asJSON); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type capturedJSON struct {
+	Time     time.Time   `json:"time"`
+	Src      string      `json:"src"`
+	Dst      string      `json:"dst"`
+	Protocol string      `json:"protocol"`
+	Packet   interface{} `json:"packet,omitempty"`
+	Error    string      `json:"error,omitempty"`
+}
+
+func printCaptured(w io.Writer, p *pcap.Packet, asJSON bool) error {
+	if asJSON {
+		v := capturedJSON{Time: p.Time, Src: p.Src.String(), Dst: p.Dst.String(), Protocol: p.Protocol, Packet: p.Parsed}
+		if p.Err != nil {
+			v.Error = p.Err.Error()
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", b)
+		return err
+	}
+	prefix := fmt.Sprintf("%s %s -> %s %s", p.Time.Format(time.RFC3339Nano), p.Src, p.Dst, p.Protocol)
+	if p.Parsed != nil {
+		if _, err := fmt.Fprintf(w, "%s: %v\n", prefix, p.Parsed); err != nil {
+			return err
+		}
+	}
+	if p.Err != nil {
+		if _, err := fmt.Fprintf(w, "%s error: %v\n", prefix, p.Err); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+
+	"github.com/egorban/navprot/pkg/proxy"
+)
+
+func runProxy(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := newFlagSet("proxy", "")
+	listen := fs.String("listen", "", "address to accept terminal connections on, e.g. :9000 (required)")
+	upstream := fs.String("upstream", "", "platform address host:port (required)")
+	proto := fs.String("proto", protoAuto, "protocol of connections: auto, ndtp or egts")
+	timeout := fs.Duration("timeout", proxy.DefaultReplyTimeout, "time after which request is reported as unanswered")
+	logName := fs.String("log", "", "file to append JSON events to (default standard output)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *listen == "" || *upstream == "" {
+		fs.Usage()
+		return errors.New("listen and upstream addresses are required")
+	}
+	if *proto == protoAuto {
+		// protocol is detected for every connection
+		*proto = ""
+	}
+	logOut := stdout
+	if *logName != "" {
+		f, err := os.OpenFile(*logName, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		logOut = f
+	}
+	p, err := proxy.New(proxy.Config{
+		Upstream:     *upstream,
+		Protocol:     *proto,
+		ReplyTimeout: *timeout,
+		Log:          proxy.JSONLogger(logOut),
+	})
+	if err != nil {
+		return err
+	}
+	l, err := net.Listen("tcp", *listen)
+	if err != nil {
+		return err
+	}
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+	go func() {
+		<-interrupt
+		p.Close()
+	}()
+	if err = p.Serve(l); err == proxy.ErrProxyClosed {
+		err = nil
+	}
+	return err
+}
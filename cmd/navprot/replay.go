@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+
+	"github.com/egorban/navprot/pkg/detector"
+	"github.com/egorban/navprot/pkg/pcap"
+	"github.com/egorban/navprot/pkg/replay"
+)
+
+func runReplay(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := newFlagSet("replay", "[file]")
+	addr := fs.String("addr", "", "server address host:port (required)")
+	speed := fs.Float64("speed", 1, "replay speed factor, 0 sends packets as fast as possible")
+	timeout := fs.Duration("timeout", replay.DefaultReplyTimeout, "time to wait for reply")
+	format := fs.String("format", formatAuto, "input format: auto, hex, base64, raw or pcap")
+	proto := fs.String("proto", protoAuto, "protocol of stream input: auto, ndtp or egts")
+	serverPort := fs.Uint("server-port", 0, "replay packets of capture sent to this port (default destination of the first packet)")
+	verbose := fs.Bool("v", false, "print result of every request")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *addr == "" {
+		fs.Usage()
+		return errors.New("server address is not set")
+	}
+	if *serverPort > 0xFFFF {
+		return errors.New("server-port is out of range")
+	}
+	var records []replay.Record
+	var err error
+	if *format == "pcap" {
+		records, *proto, err = capturedRecords(fs.Arg(0), stdin, uint16(*serverPort))
+	} else {
+		records, *proto, err = streamRecords(fs.Arg(0), *format, *proto, stdin)
+	}
+	if err != nil {
+		return err
+	}
+	conn, err := net.Dial("tcp", *addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	report, err := replay.Run(conn, records, replay.Config{Protocol: *proto, Speed: *speed, ReplyTimeout: *timeout})
+	if report != nil {
+		for _, res := range report.Results {
+			if *verbose || res.Err != nil {
+				printResult(stdout, res)
+			}
+		}
+		fmt.Fprintln(stdout, report.Summary())
+	}
+	return err
+}
+
+func printResult(w io.Writer, res replay.Result) {
+	status := "ok"
+	if res.Err != nil {
+		status = res.Err.Error()
+	}
+	fmt.Fprintf(w, "record %d id %d: %s, latency %v\n", res.Index+1, res.ID, status, res.Latency)
+}
+
+// streamRecords reads packets of NDTP or EGTS stream, they are replayed without delays
+func streamRecords(name, format, proto string, stdin io.Reader) ([]replay.Record, string, error) {
+	data, err := readInput(name, format, stdin)
+	if err != nil {
+		return nil, "", err
+	}
+	d := detector.New()
+	p, ok := d.Lookup(proto)
+	if proto == protoAuto {
+		if p, _, ok = d.Find(data); !ok {
+			return nil, "", errors.New("neither NDTP nor EGTS packet found")
+		}
+	} else if !ok {
+		return nil, "", fmt.Errorf("unknown protocol %q", proto)
+	}
+	dec := p.NewDecoder(bytes.NewReader(data))
+	var records []replay.Record
+	for {
+		frame, err := dec.Next()
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return records, p.Name, nil
+		}
+		if err != nil {
+			continue
+		}
+		records = append(records, replay.Record{Data: append([]byte(nil), frame...)})
+	}
+}
+
+// capturedRecords reads packets of capture sent to serverPort with their capture times
+func capturedRecords(name string, stdin io.Reader, serverPort uint16) ([]replay.Record, string, error) {
+	r := stdin
+	if name != "" && name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, "", err
+		}
+		defer f.Close()
+		r = f
+	}
+	packets, err := pcap.ReadPackets(r)
+	if err != nil {
+		return nil, "", err
+	}
+	var records []replay.Record
+	proto := ""
+	for _, p := range packets {
+		if p.Data == nil {
+			continue
+		}
+		if serverPort == 0 {
+			serverPort = p.Dst.Port
+		}
+		if p.Dst.Port != serverPort {
+			continue
+		}
+		if proto == "" {
+			proto = p.Protocol
+		}
+		if p.Protocol == proto {
+			records = append(records, replay.Record{Time: p.Time, Data: p.Data})
+		}
+	}
+	if len(records) == 0 {
+		return nil, "", errors.New("no packets to replay in capture")
+	}
+	return records, proto, nil
+}
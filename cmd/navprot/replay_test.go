@@ -0,0 +1,35 @@
+package main
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/egorban/navprot/internal/testserver"
+	"github.com/egorban/navprot/pkg/ndtp"
+)
+
+func TestReplay(t *testing.T) {
+	l := testserver.Listen(t, "127.0.0.1:0", func(conn net.Conn) {
+		dec := ndtp.NewDecoder(conn)
+		for {
+			packet, err := dec.Decode()
+			if err != nil {
+				return
+			}
+			conn.Write(packet.Reply(ndtp.NphResultOk))
+		}
+	})
+	defer l.Close()
+	var out bytes.Buffer
+	args := []string{"replay", "-addr", l.Addr().String(), "-speed", "0", "-v"}
+	if err := run(args, bytes.NewReader(ndtpStream(t)), &out); err != nil {
+		t.Fatalf("replay error = %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "record 1 id 1: ok") ||
+		!strings.HasPrefix(lines[2], "sent 2, replied 2, failed 0, lost 0") {
+		t.Errorf("replay output:\n%s", out.String())
+	}
+}
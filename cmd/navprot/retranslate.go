@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/egorban/navprot/pkg/retranslator"
+)
+
+func runRetranslate(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := newFlagSet("retranslate", "")
+	configName := fs.String("config", "", "JSON config file (required)")
+	statsInterval := fs.Duration("stats", time.Minute, "interval of printing upstream statistics, 0 disables it")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *configName == "" {
+		fs.Usage()
+		return errors.New("config file is not set")
+	}
+	conf, err := retranslator.LoadConfigFile(*configName)
+	if err != nil {
+		return err
+	}
+	s, err := retranslator.New(*conf)
+	if err != nil {
+		return err
+	}
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		var tick <-chan time.Time
+		if *statsInterval > 0 {
+			ticker := time.NewTicker(*statsInterval)
+			defer ticker.Stop()
+			tick = ticker.C
+		}
+		for {
+			select {
+			case <-interrupt:
+				s.Close()
+				return
+			case <-tick:
+				printStats(stdout, s.Stats())
+			case <-done:
+				return
+			}
+		}
+	}()
+	if err = s.ListenAndServe(); err == retranslator.ErrServiceClosed {
+		err = nil
+	} else {
+		s.Close()
+	}
+	printStats(stdout, s.Stats())
+	return err
+}
+
+func printStats(w io.Writer, stats []retranslator.Stats) {
+	for _, st := range stats {
+		fmt.Fprintf(w, "%s %s: queued %d, packets sent %d, resent %d, records sent %d, confirmed %d, rejected %d, "+
+			"connects %d, connect errors %d, disconnects %d\n",
+			st.Name, st.Addr, st.Queued, st.PacketsSent, st.PacketsResent, st.RecordsSent, st.RecordsConfirmed,
+			st.RecordsRejected, st.Connects, st.ConnectErrors, st.Disconnects)
+	}
+}
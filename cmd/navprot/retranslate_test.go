@@ -0,0 +1,25 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRetranslate_badConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "navprot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	config := filepath.Join(dir, "config.json")
+	if err = ioutil.WriteFile(config, []byte(`{"queue_dir": "q", "upstreams": []}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var stdout bytes.Buffer
+	if err = run([]string{"retranslate", "-config", config}, nil, &stdout); err == nil || err.Error() != "no upstreams" {
+		t.Errorf("retranslate error = %v, want no upstreams", err)
+	}
+}
@@ -0,0 +1,84 @@
+/*
+Package framer buffers input stream for decoders of binary packets. Decoder looks for packet
+in buffered data, skips garbage and requests more data until the whole packet is buffered.
+*/
+package framer
+
+import "io"
+
+// Reader is a buffer of input stream
+type Reader struct {
+	r          io.Reader
+	buf        []byte
+	start, end int
+	skipped    int
+	err        error
+}
+
+// NewReader creates Reader with initial buffer size bufLen, buffer grows for larger packets
+func NewReader(r io.Reader, bufLen int) *Reader {
+	return &Reader{r: r, buf: make([]byte, bufLen)}
+}
+
+// Data returns buffered data, it's valid until the next call of Fill
+func (f *Reader) Data() []byte {
+	return f.buf[f.start:f.end]
+}
+
+// Take consumes n bytes of packet and returns them. Capacity of returned slice is n,
+// so appending to it doesn't overwrite buffered data.
+func (f *Reader) Take(n int) []byte {
+	frame := f.buf[f.start : f.start+n : f.start+n]
+	f.start += n
+	return frame
+}
+
+// Skip discards n bytes of garbage
+func (f *Reader) Skip(n int) {
+	f.start += n
+	f.skipped += n
+}
+
+// Skipped returns number of bytes skipped since the last ResetSkipped call
+func (f *Reader) Skipped() int {
+	return f.skipped
+}
+
+// ResetSkipped resets number of skipped bytes, it's called before searching for the next packet
+func (f *Reader) ResetSkipped() {
+	f.skipped = 0
+}
+
+// Fill reads more data, buffer is enlarged to hold need bytes. It may return before need bytes
+// are buffered, so caller checks Data again. Incomplete data at the end of stream is skipped
+// and io.ErrUnexpectedEOF is returned, other read errors are returned as is.
+func (f *Reader) Fill(need int) error {
+	if f.err != nil {
+		if f.err == io.EOF && f.start != f.end {
+			f.Skip(f.end - f.start)
+			return io.ErrUnexpectedEOF
+		}
+		return f.err
+	}
+	if f.start > 0 {
+		f.end = copy(f.buf, f.buf[f.start:f.end])
+		f.start = 0
+	}
+	if need > len(f.buf) {
+		buf := make([]byte, need)
+		copy(buf, f.buf[:f.end])
+		f.buf = buf
+	} else if f.end == len(f.buf) {
+		return nil
+	}
+	n, err := f.r.Read(f.buf[f.end:])
+	f.end += n
+	if err != nil {
+		f.err = err
+		if n > 0 {
+			return nil
+		}
+		return f.Fill(need)
+	}
+	return nil
+}
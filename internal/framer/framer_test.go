@@ -0,0 +1,35 @@
+package framer
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+func TestReader(t *testing.T) {
+	f := NewReader(iotest.OneByteReader(bytes.NewReader([]byte("xxpacket!"))), 2)
+	for len(f.Data()) < 8 {
+		if err := f.Fill(8); err != nil {
+			t.Fatalf("Fill() error = %v", err)
+		}
+	}
+	f.Skip(2)
+	if frame := f.Take(6); string(frame) != "packet" || cap(frame) != 6 {
+		t.Errorf("Take() = %q with capacity %d", frame, cap(frame))
+	}
+	if f.Skipped() != 2 {
+		t.Errorf("Skipped() = %d, want 2", f.Skipped())
+	}
+	f.ResetSkipped()
+	var err error
+	for err == nil {
+		err = f.Fill(8)
+	}
+	if err != io.ErrUnexpectedEOF || f.Skipped() != 1 || len(f.Data()) != 0 {
+		t.Errorf("Fill() at incomplete end = %v, skipped %d", err, f.Skipped())
+	}
+	if err = f.Fill(8); err != io.EOF {
+		t.Errorf("Fill() at end = %v, want %v", err, io.EOF)
+	}
+}
@@ -0,0 +1,29 @@
+// Package testserver starts TCP servers for tests of clients, terminals and services
+package testserver
+
+import (
+	"net"
+	"testing"
+)
+
+// Listen listens on addr, e.g. "127.0.0.1:0", and serves every accepted connection by serve in its own goroutine.
+// Connection is closed when serve returns. Caller closes returned listener to stop accepting.
+func Listen(t testing.TB, addr string, serve func(conn net.Conn)) net.Listener {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				serve(conn)
+			}()
+		}
+	}()
+	return l
+}
@@ -0,0 +1,28 @@
+package testserver
+
+import (
+	"io"
+	"net"
+	"testing"
+)
+
+func TestListen(t *testing.T) {
+	l := Listen(t, "127.0.0.1:0", func(conn net.Conn) {
+		io.Copy(conn, conn)
+	})
+	defer l.Close()
+	for i := 0; i < 2; i++ {
+		conn, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]byte, 4)
+		if _, err = conn.Write([]byte("ping")); err == nil {
+			_, err = io.ReadFull(conn, buf)
+		}
+		conn.Close()
+		if err != nil || string(buf) != "ping" {
+			t.Errorf("connection %d echo = %q, %v", i, buf, err)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package convertation
+
+import (
+	"errors"
+
+	"github.com/egorban/navprot/pkg/egts"
+	"github.com/egorban/navprot/pkg/ndtp"
+)
+
+var nphResults = map[byte]uint32{
+	egts.Success:              ndtp.NphResultOk,
+	egts.EgtsPcUnsProtocol:    ndtp.NphResultProtoVerNotSupported,
+	egts.EgtsPcIncHeaderForm:  ndtp.NphResultPacketInvalidFormat,
+	egts.EgtsPcIncDataForm:    ndtp.NphResultPacketInvalidFormat,
+	egts.EgtsPcHeaderCrcError: ndtp.NphResultPacketInvalidFormat,
+	egts.EgtsPcDataCrcError:   ndtp.NphResultPacketInvalidFormat,
+	egts.EgtsPcUnsType:        ndtp.NphResultPacketNotSupported,
+	egts.EgtsPcNotEnParams:    ndtp.NphResultPacketInvalidParameter,
+	egts.EgtsPcInvDataLen:     ndtp.NphResultPacketInvalidSize,
+	egts.EgtsPcSrvcNotFound:   ndtp.NphResultServiceNotSupported,
+	egts.EgtsPcSrvcUnknown:    ndtp.NphResultServiceNotSupported,
+	egts.EgtsPcSrvcDenied:     ndtp.NphResultServiceNotAvailable,
+	egts.EgtsPcAuthDenied:     ndtp.NphResultClientAuthFailed,
+	egts.EgtsPcAlreadyExists:  ndtp.NphResultClientAlreadyRegistered,
+	egts.EgtsPcObjNotFound:    ndtp.NphResultClientNotRegistered,
+	egts.EgtsPcIDNotFound:     ndtp.NphResultClientNotRegistered,
+}
+
+// ConnRequestToEGTS converts NPH_SGC_CONN_REQUEST packet to EGTS_AUTH_SERVICE packet with
+// EGTS_SR_TERM_IDENTITY subrecord. Terminal ID is used as object identifier and TID.
+func ConnRequestToEGTS(packet *ndtp.Packet, packID, recID uint16) (*egts.Packet, error) {
+	id, err := packet.GetID()
+	if err != nil {
+		return nil, err
+	}
+	sub := &egts.SubRecord{
+		Type: egts.EgtsSrTermIdentity,
+		Data: &egts.TermIdentity{TID: uint32(id)},
+	}
+	record := egtsRecord([]*egts.SubRecord{sub}, uint32(id), recID)
+	record.Service = egts.EgtsAuthService
+	return egtsPacketData(record, packID), nil
+}
+
+// NphResult maps EGTS processing result or result code to NPH_RESULT code.
+// Unknown codes are mapped to NPH_RESULT_SERVICE_NOT_AVAILABLE.
+func NphResult(code byte) uint32 {
+	if result, ok := nphResults[code]; ok {
+		return result
+	}
+	return ndtp.NphResultServiceNotAvailable
+}
+
+// AuthResultToNDTP finds EGTS_SR_RESULT_CODE in EGTS_AUTH_SERVICE records of packet and maps it to NPH_RESULT code
+func AuthResultToNDTP(packet *egts.Packet) (uint32, error) {
+	for _, rec := range packet.Records {
+		if rec.Service != egts.EgtsAuthService {
+			continue
+		}
+		for _, sub := range rec.Data {
+			if code, ok := sub.Data.(*egts.ResultCode); ok {
+				return NphResult(code.RCD), nil
+			}
+		}
+	}
+	return 0, errors.New("EGTS_SR_RESULT_CODE not found")
+}
@@ -0,0 +1,66 @@
+package convertation
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/egorban/navprot/pkg/egts"
+	"github.com/egorban/navprot/pkg/ndtp"
+)
+
+func TestConnRequestToEGTS(t *testing.T) {
+	got, err := ConnRequestToEGTS(ndtp.NewConnRequest(239), 3, 7)
+	if err != nil {
+		t.Fatalf("ConnRequestToEGTS() error = %v", err)
+	}
+	want := &egts.Packet{
+		Type: egts.EgtsPtAppdata,
+		ID:   3,
+		Records: []*egts.Record{{
+			RecNum:  7,
+			ID:      239,
+			Service: egts.EgtsAuthService,
+			Data: []*egts.SubRecord{{
+				Type: egts.EgtsSrTermIdentity,
+				Data: &egts.TermIdentity{TID: 239},
+			}},
+		}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ConnRequestToEGTS() = %v, want %v", got, want)
+	}
+	if _, err = ConnRequestToEGTS(ndtp.NewNavData(true, nil), 0, 0); err == nil {
+		t.Error("ConnRequestToEGTS() expected error for navigation data")
+	}
+}
+
+func TestAuthResultToNDTP(t *testing.T) {
+	tests := []struct {
+		name    string
+		code    byte
+		want    uint32
+		wantErr bool
+	}{
+		{name: "ok", code: egts.Success, want: ndtp.NphResultOk},
+		{name: "authDenied", code: egts.EgtsPcAuthDenied, want: ndtp.NphResultClientAuthFailed},
+		{name: "unknown", code: 200, want: ndtp.NphResultServiceNotAvailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			packet := &egts.Packet{Type: egts.EgtsPtAppdata, Records: []*egts.Record{{
+				Service: egts.EgtsAuthService,
+				Data:    []*egts.SubRecord{{Type: egts.EgtsSrResultCode, Data: &egts.ResultCode{RCD: tt.code}}},
+			}}}
+			got, err := AuthResultToNDTP(packet)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("AuthResultToNDTP() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("AuthResultToNDTP() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+	if _, err := AuthResultToNDTP(&egts.Packet{}); err == nil {
+		t.Error("AuthResultToNDTP() expected error for packet without result code")
+	}
+}
@@ -1,32 +1,50 @@
 /*
 Package convertation provides functions for converting between different navigation protocols.
-Currently, convertation of general NavPtotocol to EGTS packet is supported.
+Currently, convertation of general NavPtotocol to EGTS packet and EGTS teledata to NDTP packets is supported.
 */
 package convertation
 
 import (
+	"encoding/binary"
+
 	"github.com/egorban/navprot/pkg/egts"
 	"github.com/egorban/navprot/pkg/general"
+	"github.com/egorban/navprot/pkg/ndtp"
 )
 
-// ToEGTS convert packet implemented NavProtocol iterface to egts.Packet type
+// ToEGTS convert packet implemented NavProtocol iterface to egts.Packet type.
+// General subrecords, which can't be represented in EGTS, are skipped.
 func ToEGTS(packet general.NavProtocol, id uint32, packID, recID uint16) (*egts.Packet, error) {
 	data, err := packet.ToGeneral()
 	if err != nil {
 		return nil, err
 	}
-	subrecords := egtsSubrecords(data)
+	subrecords, err := egtsSubrecords(data, nil)
+	if err != nil {
+		return nil, err
+	}
 	egtsPacket := formEgts(subrecords, id, packID, recID)
 	return egtsPacket, nil
 }
 
-func egtsSubrecords(data []general.Subrecord) []*egts.SubRecord {
+func egtsSubrecords(data []general.Subrecord, profile *Profile) ([]*egts.SubRecord, error) {
 	subrecords := make([]*egts.SubRecord, 0, 1)
 	for _, sub := range data {
-		egtsSub := sub.ToEgtsSubrecord()
-		subrecords = append(subrecords, egtsSub)
+		egtsSub, err := general.Encode(egts.ProtocolName, sub)
+		if err == general.ErrNotSupported {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		sub := egtsSub.(*egts.SubRecord)
+		if fuel, ok := sub.Data.(*egts.FuelData); ok && profile != nil {
+			fuel.Number = profile.FuelSensorNumber
+			fuel.Address = profile.FuelModuleAddress
+		}
+		subrecords = append(subrecords, sub)
 	}
-	return subrecords
+	return subrecords, nil
 }
 
 func formEgts(subrecords []*egts.SubRecord, id uint32, packID, recID uint16) *egts.Packet {
@@ -52,3 +70,85 @@ func egtsRecord(subrecords []*egts.SubRecord, id uint32, recID uint16) *egts.Rec
 		Data:    subrecords,
 	}
 }
+
+// ToNDTP converts teledata records of EGTS packet to NDTP packets, one packet per record.
+// Packet type is NPH_SND_REALTIME, if position data of record is real time, otherwise NPH_SND_HISTORY.
+// Object identifier of record is stored in NPL peer address. NDTP servers identify object by connection request
+// and ignore peer address, so caller must send every packet over connection of its object, e.g. by ndtp.Terminal
+// created for ID from peer address. Subrecords, which can't be represented in NDTP, are skipped,
+// as well as records without supported subrecords.
+func ToNDTP(packet *egts.Packet) ([]*ndtp.Packet, error) {
+	return ToNDTPWithProfile(packet, nil)
+}
+
+// ToNDTPWithProfile converts EGTS packet to NDTP packets like ToNDTP, mapping data according to profile
+func ToNDTPWithProfile(packet *egts.Packet, profile *Profile) ([]*ndtp.Packet, error) {
+	packets := make([]*ndtp.Packet, 0, len(packet.Records))
+	for _, rec := range packet.Records {
+		if rec.Service != egts.EgtsTeledataService {
+			continue
+		}
+		data, err := generalData(rec, profile)
+		if err != nil {
+			return nil, err
+		}
+		ndtpPacket, err := GeneralToNDTP(data, rec.ID)
+		if err != nil {
+			return nil, err
+		}
+		if ndtpPacket != nil {
+			packets = append(packets, ndtpPacket)
+		}
+	}
+	return packets, nil
+}
+
+func generalData(rec *egts.Record, profile *Profile) ([]general.Subrecord, error) {
+	single := egts.Packet{Type: egts.EgtsPtAppdata, Records: []*egts.Record{rec}}
+	data, err := single.ToGeneral()
+	if err != nil || profile == nil {
+		return data, err
+	}
+	filtered := data[:0]
+	for _, sub := range data {
+		if !profile.forwarded(sub) {
+			continue
+		}
+		if nav, ok := sub.(*general.NavData); ok && profile.SosSource != 0 {
+			nav.Sos = nav.Source == profile.SosSource
+		}
+		filtered = append(filtered, sub)
+	}
+	return filtered, nil
+}
+
+// GeneralToNDTP converts general subrecords to formed NPH_SND_REALTIME or NPH_SND_HISTORY packet.
+// Packet is real time, if any NavData is real time. Object identifier is stored in NPL peer address,
+// but it's ignored by servers, so packet must be sent over connection authorized by ndtp.NewConnRequest(id).
+// Subrecords, which can't be represented in NDTP, are skipped, nil packet is returned if none is left.
+func GeneralToNDTP(data []general.Subrecord, id uint32) (*ndtp.Packet, error) {
+	var cells []ndtp.Subrecord
+	realTime := false
+	for _, sub := range data {
+		cell, err := general.Encode(ndtp.ProtocolName, sub)
+		if err == general.ErrNotSupported {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		cells = append(cells, cell.(ndtp.Subrecord))
+		if nav, ok := sub.(*general.NavData); ok && nav.RealTime {
+			realTime = true
+		}
+	}
+	if len(cells) == 0 {
+		return nil, nil
+	}
+	packet := ndtp.NewNavData(realTime, cells)
+	binary.LittleEndian.PutUint32(packet.Npl.PeerAddress, id)
+	if _, err := packet.Form(); err != nil {
+		return nil, err
+	}
+	return packet, nil
+}
@@ -243,3 +243,72 @@ func ndtpNavAndFuelPacket() *ndtp.Packet {
 		Packet: []byte(nil),
 	}
 }
+
+func TestToNDTP(t *testing.T) {
+	tests := []struct {
+		name           string
+		packet         *egts.Packet
+		wantPacketType string
+		wantAddress    []byte
+		wantCells      []ndtp.Subrecord
+	}{
+		{name: "realTime", packet: navAndFuelEgtsWant(), wantPacketType: ndtp.NphSndRealtime,
+			wantAddress: []byte{0, 0, 0, 0}, wantCells: ndtpNavAndFuelCells()},
+		{name: "history", packet: egtsFuelRecord(239), wantPacketType: ndtp.NphSndHistory,
+			wantAddress: []byte{239, 0, 0, 0}, wantCells: []ndtp.Subrecord{&ndtp.FuelData{Type: 2, Fuel: 150, LevelL: 150}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ToNDTP(tt.packet)
+			if err != nil {
+				t.Fatalf("ToNDTP() error = %v", err)
+			}
+			if len(got) != 1 {
+				t.Fatalf("ToNDTP() returned %d packets, want 1", len(got))
+			}
+			parsed := new(ndtp.Packet)
+			if _, err = parsed.Parse(got[0].Packet); err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if parsed.PacketType() != tt.wantPacketType {
+				t.Errorf("packet type = %s, want %s", parsed.PacketType(), tt.wantPacketType)
+			}
+			if !reflect.DeepEqual(parsed.Npl.PeerAddress, tt.wantAddress) {
+				t.Errorf("peer address = %v, want %v", parsed.Npl.PeerAddress, tt.wantAddress)
+			}
+			if !reflect.DeepEqual(parsed.Nph.Data, tt.wantCells) {
+				t.Errorf("cells = %v, want %v", parsed.Nph.Data, tt.wantCells)
+			}
+		})
+	}
+}
+
+func TestToNDTP_skipRecords(t *testing.T) {
+	packet := egtsFuelRecord(1)
+	packet.Records[0].Service = 1
+	got, err := ToNDTP(packet)
+	if err != nil || len(got) != 0 {
+		t.Errorf("ToNDTP() = %v, %v; want no packets", got, err)
+	}
+}
+
+func ndtpNavAndFuelCells() []ndtp.Subrecord {
+	nav := ndtpNavAndFuelPacket().Nph.Data.([]ndtp.Subrecord)[0].(*ndtp.NavData)
+	return []ndtp.Subrecord{nav, &ndtp.FuelData{Type: 1, Fuel: 20}}
+}
+
+func egtsFuelRecord(id uint32) *egts.Packet {
+	rec := egts.Record{
+		RecNum:  1,
+		ID:      id,
+		Service: egts.EgtsTeledataService,
+		Data: []*egts.SubRecord{{
+			Type: egts.EgtsSrLiquidLevelSensor,
+			Data: &egts.FuelData{Type: 2, Fuel: 150},
+		}},
+	}
+	return &egts.Packet{
+		Type:    egts.EgtsPtAppdata,
+		Records: []*egts.Record{&rec},
+	}
+}
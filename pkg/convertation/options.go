@@ -0,0 +1,121 @@
+package convertation
+
+import (
+	"github.com/egorban/navprot/pkg/egts"
+	"github.com/egorban/navprot/pkg/general"
+)
+
+// Grouping defines how general subrecords are split into EGTS records
+type Grouping int
+
+const (
+	// GroupNone puts all subrecords into one record
+	GroupNone Grouping = iota
+	// GroupByNavData starts new record for every NavData, following subrecords are attached to it
+	GroupByNavData
+	// GroupByTime puts NavData with the same time and subrecords following them into one record
+	GroupByTime
+)
+
+// Options contains parameters of convertation to EGTS
+type Options struct {
+	Grouping Grouping
+	// NextRecNum returns number of the next record (optional). Records are numbered from 0, if it's not set.
+	NextRecNum func() uint16
+	// Profile defines mapping of data (optional)
+	Profile *Profile
+}
+
+type recordGroup struct {
+	time    uint32
+	hasTime bool
+	data    []general.Subrecord
+}
+
+// ToEGTSWithOptions converts packet implemented NavProtocol interface to egts.Packet, splitting
+// subrecords into records according to opts. Time of record is set to time of its first NavData.
+func ToEGTSWithOptions(packet general.NavProtocol, id uint32, packID uint16, opts Options) (*egts.Packet, error) {
+	data, err := opts.Profile.GeneralData(packet)
+	if err != nil {
+		return nil, err
+	}
+	return GeneralToEGTS(data, id, packID, opts)
+}
+
+// GeneralToEGTS converts general subrecords to egts.Packet like ToEGTSWithOptions.
+// Profile of opts is used only for fuel sensor parameters, data is expected to be mapped already.
+func GeneralToEGTS(data []general.Subrecord, id uint32, packID uint16, opts Options) (*egts.Packet, error) {
+	nextRecNum := opts.NextRecNum
+	if nextRecNum == nil {
+		var recNum uint16
+		nextRecNum = func() uint16 {
+			recNum++
+			return recNum - 1
+		}
+	}
+	groups := groupSubrecords(data, opts.Grouping)
+	records := make([]*egts.Record, 0, len(groups))
+	for _, group := range groups {
+		subrecords, err := egtsSubrecords(group.data, opts.Profile)
+		if err != nil {
+			return nil, err
+		}
+		if len(subrecords) == 0 {
+			continue
+		}
+		record := egtsRecord(subrecords, id, nextRecNum())
+		if group.hasTime {
+			if err := record.SetTime(general.FromSeconds(general.UnixEpoch, group.time)); err != nil {
+				return nil, err
+			}
+		}
+		records = append(records, record)
+	}
+	return &egts.Packet{
+		Type:    egts.EgtsPtAppdata,
+		ID:      packID,
+		Records: records,
+	}, nil
+}
+
+func groupSubrecords(data []general.Subrecord, grouping Grouping) []*recordGroup {
+	var groups []*recordGroup
+	var current *recordGroup
+	byTime := make(map[uint32]*recordGroup)
+	for _, sub := range data {
+		navTime, isNav := navDataTime(sub)
+		switch {
+		case current == nil:
+			current = new(recordGroup)
+			groups = append(groups, current)
+		case !isNav || grouping == GroupNone:
+		case grouping == GroupByNavData:
+			current = new(recordGroup)
+			groups = append(groups, current)
+		case grouping == GroupByTime:
+			if group, ok := byTime[navTime]; ok {
+				current = group
+			} else if current.hasTime || len(current.data) > 0 {
+				current = new(recordGroup)
+				groups = append(groups, current)
+			}
+		}
+		if isNav && !current.hasTime {
+			current.time = navTime
+			current.hasTime = true
+			byTime[navTime] = current
+		}
+		current.data = append(current.data, sub)
+	}
+	return groups
+}
+
+func navDataTime(sub general.Subrecord) (uint32, bool) {
+	switch nav := sub.(type) {
+	case general.NavData:
+		return nav.Time, true
+	case *general.NavData:
+		return nav.Time, true
+	}
+	return 0, false
+}
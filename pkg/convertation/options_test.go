@@ -0,0 +1,77 @@
+package convertation
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/egorban/navprot/pkg/egts"
+	"github.com/egorban/navprot/pkg/ndtp"
+)
+
+func TestToEGTSWithOptions(t *testing.T) {
+	const t1, t2 = 1522961700, 1522961710
+	tests := []struct {
+		name        string
+		grouping    Grouping
+		wantRecNums []uint16
+		wantTimes   []uint32
+		wantSubs    [][]byte
+	}{
+		{name: "none", grouping: GroupNone, wantRecNums: []uint16{10},
+			wantTimes: []uint32{t1 - egts.Timestamp20100101utc},
+			wantSubs:  [][]byte{{16, 27, 16, 27, 16}}},
+		{name: "byNavData", grouping: GroupByNavData, wantRecNums: []uint16{10, 11, 12},
+			wantTimes: []uint32{t1 - egts.Timestamp20100101utc, t2 - egts.Timestamp20100101utc, t1 - egts.Timestamp20100101utc},
+			wantSubs:  [][]byte{{16, 27}, {16, 27}, {16}}},
+		{name: "byTime", grouping: GroupByTime, wantRecNums: []uint16{10, 11},
+			wantTimes: []uint32{t1 - egts.Timestamp20100101utc, t2 - egts.Timestamp20100101utc},
+			wantSubs:  [][]byte{{16, 27, 16}, {16, 27}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			packet := ndtp.NewNavData(false, []ndtp.Subrecord{
+				&ndtp.NavData{Time: t1, Lon: 37.6, Lat: 55.7},
+				&ndtp.FuelData{Type: 2, Fuel: 10},
+				&ndtp.NavData{Time: t2, Lon: 37.6, Lat: 55.7},
+				&ndtp.FuelData{Type: 2, Fuel: 11},
+				&ndtp.NavData{Time: t1, Lon: 37.6, Lat: 55.7},
+			})
+			recNum := uint16(10)
+			opts := Options{
+				Grouping: tt.grouping,
+				NextRecNum: func() uint16 {
+					recNum++
+					return recNum - 1
+				},
+			}
+			got, err := ToEGTSWithOptions(packet, 239, 5, opts)
+			if err != nil {
+				t.Fatalf("ToEGTSWithOptions() error = %v", err)
+			}
+			var recNums []uint16
+			var times []uint32
+			var subs [][]byte
+			for _, rec := range got.Records {
+				recNums = append(recNums, rec.RecNum)
+				times = append(times, rec.Time)
+				var types []byte
+				for _, sub := range rec.Data {
+					types = append(types, sub.Type)
+				}
+				subs = append(subs, types)
+				if rec.ID != 239 {
+					t.Errorf("record ID = %d, want 239", rec.ID)
+				}
+			}
+			if !reflect.DeepEqual(recNums, tt.wantRecNums) {
+				t.Errorf("record numbers = %v, want %v", recNums, tt.wantRecNums)
+			}
+			if !reflect.DeepEqual(times, tt.wantTimes) {
+				t.Errorf("record times = %v, want %v", times, tt.wantTimes)
+			}
+			if !reflect.DeepEqual(subs, tt.wantSubs) {
+				t.Errorf("subrecord types = %v, want %v", subs, tt.wantSubs)
+			}
+		})
+	}
+}
@@ -0,0 +1,198 @@
+package convertation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/egorban/navprot/pkg/egts"
+	"github.com/egorban/navprot/pkg/general"
+	"github.com/egorban/navprot/pkg/ndtp"
+)
+
+// Units of fuel level in NDTP UziM cell
+const (
+	// UnitAuto means liters, if liters level is not zero, otherwise mm
+	UnitAuto = "auto"
+	// UnitLiters means liters level
+	UnitLiters = "liters"
+	// UnitMm means mm level
+	UnitMm = "mm"
+)
+
+// Names of forwarded general types
+const (
+	ForwardNav      = "nav"
+	ForwardFuel     = "fuel"
+	ForwardSensors  = "sensors"
+	ForwardCounters = "counters"
+)
+
+var (
+	// ErrFuelCells is returned if NDTP cells don't correspond to general subrecords, so unit of UziM
+	// fuel level can't be applied
+	ErrFuelCells = errors.New("NDTP cells don't match general subrecords")
+	// ErrNoLiters is returned if UziM unit is liters, but UziM cell contains only level in mm
+	ErrNoLiters = errors.New("UziM cell has no fuel level in liters")
+)
+
+// Profile defines mapping of data between protocols
+type Profile struct {
+	// SosSource is EGTS source code of position data sent by alarm button,
+	// 0 means it's not set and egts.SourceSos is used
+	SosSource byte `json:"sos_source"`
+	// FuelSensorNumber is EGTS liquid level sensor number (LLSN) of fuel level
+	FuelSensorNumber byte `json:"fuel_sensor_number"`
+	// FuelModuleAddress is EGTS module address (MADDR) of fuel level sensor
+	FuelModuleAddress uint16 `json:"fuel_module_address"`
+	// UziMUnit is unit of fuel level taken from NDTP UziM cell, conversion fails with ErrNoLiters
+	// if it's liters, but cell contains only level in mm
+	UziMUnit string `json:"uzim_unit"`
+	// Forward contains names of forwarded general types, all types are forwarded if it's empty
+	Forward []string `json:"forward"`
+}
+
+// DefaultProfile returns profile with default mapping
+func DefaultProfile() *Profile {
+	return &Profile{
+		SosSource:         13,
+		FuelSensorNumber:  2,
+		FuelModuleAddress: 1,
+		UziMUnit:          UnitAuto,
+	}
+}
+
+// LoadProfile reads profile in JSON format. Omitted fields have default values.
+func LoadProfile(r io.Reader) (*Profile, error) {
+	profile := DefaultProfile()
+	if err := json.NewDecoder(r).Decode(profile); err != nil {
+		return nil, err
+	}
+	if err := profile.validate(); err != nil {
+		return nil, err
+	}
+	return profile, nil
+}
+
+// LoadProfileFile reads profile from JSON file
+func LoadProfileFile(name string) (*Profile, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return LoadProfile(f)
+}
+
+func (p *Profile) validate() error {
+	switch p.UziMUnit {
+	case UnitAuto, UnitLiters, UnitMm:
+	default:
+		return fmt.Errorf("unknown UziM unit %q", p.UziMUnit)
+	}
+	if p.FuelSensorNumber > 7 {
+		return fmt.Errorf("fuel sensor number %d is out of range 0-7", p.FuelSensorNumber)
+	}
+	for _, name := range p.Forward {
+		switch name {
+		case ForwardNav, ForwardFuel, ForwardSensors, ForwardCounters:
+		default:
+			return fmt.Errorf("unknown forwarded type %q", name)
+		}
+	}
+	return nil
+}
+
+// TypeName returns name of general type used in Profile.Forward, empty string is returned for unknown types
+func TypeName(sub general.Subrecord) string {
+	switch sub.(type) {
+	case general.NavData, *general.NavData:
+		return ForwardNav
+	case general.FuelData, *general.FuelData:
+		return ForwardFuel
+	case general.SensorData, *general.SensorData:
+		return ForwardSensors
+	case general.CounterData, *general.CounterData:
+		return ForwardCounters
+	}
+	return ""
+}
+
+func (p *Profile) forwarded(sub general.Subrecord) bool {
+	if len(p.Forward) == 0 {
+		return true
+	}
+	name := TypeName(sub)
+	for _, forward := range p.Forward {
+		if forward == name {
+			return true
+		}
+	}
+	return false
+}
+
+// GeneralData converts packet to general subrecords according to profile, profile can be nil
+func (p *Profile) GeneralData(packet general.NavProtocol) ([]general.Subrecord, error) {
+	data, err := packet.ToGeneral()
+	if err != nil || p == nil {
+		return data, err
+	}
+	if ndtpPacket, ok := packet.(*ndtp.Packet); ok {
+		if err = p.applyUziMUnit(ndtpPacket, data); err != nil {
+			return nil, err
+		}
+	}
+	filtered := data[:0]
+	for _, sub := range data {
+		if !p.forwarded(sub) {
+			continue
+		}
+		if nav, ok := sub.(*general.NavData); ok && nav.Sos {
+			if p.SosSource != 0 {
+				nav.Source = p.SosSource
+			} else {
+				nav.Source = egts.SourceSos
+			}
+		}
+		filtered = append(filtered, sub)
+	}
+	return filtered, nil
+}
+
+// applyUziMUnit relies on one-to-one mapping of NDTP cells to general subrecords. ErrNoLiters is returned
+// if level in liters is required, but UziM cell contains only level in mm.
+func (p *Profile) applyUziMUnit(packet *ndtp.Packet, data []general.Subrecord) error {
+	if p.UziMUnit == UnitAuto {
+		return nil
+	}
+	cells, ok := packet.Nph.Data.([]ndtp.Subrecord)
+	if !ok || len(cells) != len(data) {
+		return ErrFuelCells
+	}
+	for i, cell := range cells {
+		fuel, ok := cell.(*ndtp.FuelData)
+		if !ok {
+			continue
+		}
+		gen, ok := data[i].(*general.FuelData)
+		if !ok {
+			return ErrFuelCells
+		}
+		if fuel.LevelMm == 0 && fuel.LevelL == 0 {
+			continue
+		}
+		if p.UziMUnit == UnitLiters {
+			if fuel.LevelL == 0 {
+				return ErrNoLiters
+			}
+			gen.Type = 2
+			gen.Fuel = uint32(fuel.LevelL)
+		} else {
+			gen.Type = 0
+			gen.Fuel = uint32(fuel.LevelMm)
+		}
+	}
+	return nil
+}
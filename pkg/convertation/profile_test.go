@@ -0,0 +1,153 @@
+package convertation
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/egorban/navprot/pkg/egts"
+	"github.com/egorban/navprot/pkg/general"
+	"github.com/egorban/navprot/pkg/ndtp"
+)
+
+func TestLoadProfile(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    string
+		want    *Profile
+		wantErr bool
+	}{
+		{name: "default", json: `{}`, want: DefaultProfile()},
+		{name: "custom", json: `{"sos_source": 5, "fuel_sensor_number": 1, "uzim_unit": "mm", "forward": ["nav"]}`,
+			want: &Profile{SosSource: 5, FuelSensorNumber: 1, FuelModuleAddress: 1, UziMUnit: UnitMm, Forward: []string{ForwardNav}}},
+		{name: "unknownUnit", json: `{"uzim_unit": "gallons"}`, wantErr: true},
+		{name: "unknownType", json: `{"forward": ["nav", "photo"]}`, wantErr: true},
+		{name: "sensorNumber", json: `{"fuel_sensor_number": 8}`, wantErr: true},
+		{name: "incorrectJSON", json: `{`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := LoadProfile(strings.NewReader(tt.json))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadProfile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("LoadProfile() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestToEGTSWithOptions_profile(t *testing.T) {
+	tests := []struct {
+		name     string
+		profile  *Profile
+		wantSubs []*egts.SubRecord
+	}{
+		{name: "default", profile: DefaultProfile(), wantSubs: []*egts.SubRecord{
+			{Type: egts.EgtsSrPosData, Data: &egts.PosData{Time: 260657700, Lon: 37.6, Lat: 55.7, Valid: 1, Source: 13}},
+			{Type: egts.EgtsSrLiquidLevelSensor, Data: &egts.FuelData{Type: 2, Fuel: 30, Number: 2, Address: 1}},
+		}},
+		{name: "custom", profile: &Profile{SosSource: 5, FuelSensorNumber: 1, FuelModuleAddress: 3, UziMUnit: UnitMm},
+			wantSubs: []*egts.SubRecord{
+				{Type: egts.EgtsSrPosData, Data: &egts.PosData{Time: 260657700, Lon: 37.6, Lat: 55.7, Valid: 1, Source: 5}},
+				{Type: egts.EgtsSrLiquidLevelSensor, Data: &egts.FuelData{Type: 0, Fuel: 400, Number: 1, Address: 3}},
+			}},
+		{name: "forwardFuel", profile: &Profile{FuelSensorNumber: 2, UziMUnit: UnitLiters, Forward: []string{ForwardFuel}},
+			wantSubs: []*egts.SubRecord{
+				{Type: egts.EgtsSrLiquidLevelSensor, Data: &egts.FuelData{Type: 2, Fuel: 30, Number: 2}},
+			}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			packet := ndtp.NewNavData(false, []ndtp.Subrecord{
+				&ndtp.NavData{Time: 1522961700, Lon: 37.6, Lat: 55.7, Valid: true, Sos: true},
+				&ndtp.FuelData{Type: 2, Fuel: 30, LevelMm: 400, LevelL: 30},
+			})
+			got, err := ToEGTSWithOptions(packet, 1, 0, Options{Profile: tt.profile})
+			if err != nil {
+				t.Fatalf("ToEGTSWithOptions() error = %v", err)
+			}
+			if len(got.Records) != 1 {
+				t.Fatalf("ToEGTSWithOptions() returned %d records, want 1", len(got.Records))
+			}
+			if !reflect.DeepEqual(got.Records[0].Data, tt.wantSubs) {
+				t.Errorf("subrecords = %v, want %v", got.Records[0].Data, tt.wantSubs)
+			}
+		})
+	}
+}
+
+func TestToNDTPWithProfile(t *testing.T) {
+	packet := navAndFuelEgtsWant()
+	packet.Records[0].Data[0].Data.(*egts.PosData).Source = 5
+	profile := &Profile{SosSource: 5, UziMUnit: UnitAuto, Forward: []string{ForwardNav}}
+	got, err := ToNDTPWithProfile(packet, profile)
+	if err != nil {
+		t.Fatalf("ToNDTPWithProfile() error = %v", err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("ToNDTPWithProfile() returned %d packets, want 1", len(got))
+	}
+	cells := got[0].Nph.Data.([]ndtp.Subrecord)
+	if len(cells) != 1 {
+		t.Fatalf("ToNDTPWithProfile() returned %d cells, want 1", len(cells))
+	}
+	if nav, ok := cells[0].(*ndtp.NavData); !ok || !nav.Sos {
+		t.Errorf("cell = %v, want NavData with Sos", cells[0])
+	}
+}
+
+func TestToNDTPWithProfile_unsetSosSource(t *testing.T) {
+	packet := navAndFuelEgtsWant()
+	// source 0 is not SOS, if SOS source of profile is not set
+	packet.Records[0].Data[0].Data.(*egts.PosData).Source = 0
+	got, err := ToNDTPWithProfile(packet, &Profile{UziMUnit: UnitAuto, Forward: []string{ForwardNav}})
+	if err != nil || len(got) != 1 {
+		t.Fatalf("ToNDTPWithProfile() = %v, %v", got, err)
+	}
+	if nav, ok := got[0].Nph.Data.([]ndtp.Subrecord)[0].(*ndtp.NavData); !ok || nav.Sos {
+		t.Errorf("cell = %v, want NavData without Sos", got[0].Nph.Data)
+	}
+}
+
+func TestProfile_GeneralData(t *testing.T) {
+	tests := []struct {
+		name       string
+		profile    *Profile
+		fuel       *ndtp.FuelData
+		wantSource byte
+		wantFuel   general.FuelData
+		wantErr    error
+	}{
+		{name: "unsetSosSource", profile: &Profile{UziMUnit: UnitAuto}, fuel: &ndtp.FuelData{Type: 2, Fuel: 30, LevelMm: 400, LevelL: 30},
+			wantSource: egts.SourceSos, wantFuel: general.FuelData{Type: 2, Fuel: 30}},
+		{name: "sosSource", profile: &Profile{SosSource: 5, UziMUnit: UnitMm}, fuel: &ndtp.FuelData{Type: 2, Fuel: 30, LevelMm: 400, LevelL: 30},
+			wantSource: 5, wantFuel: general.FuelData{Type: 0, Fuel: 400}},
+		{name: "liters", profile: &Profile{UziMUnit: UnitLiters}, fuel: &ndtp.FuelData{Type: 2, Fuel: 30, LevelMm: 400, LevelL: 30},
+			wantSource: egts.SourceSos, wantFuel: general.FuelData{Type: 2, Fuel: 30}},
+		{name: "noLiters", profile: &Profile{UziMUnit: UnitLiters}, fuel: &ndtp.FuelData{Type: 0, Fuel: 400, LevelMm: 400},
+			wantErr: ErrNoLiters},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			packet := ndtp.NewNavData(true, []ndtp.Subrecord{
+				&ndtp.NavData{Time: 1522961700, Lon: 37.6, Lat: 55.7, Valid: true, Sos: true},
+				tt.fuel,
+			})
+			got, err := tt.profile.GeneralData(packet)
+			if err != tt.wantErr {
+				t.Fatalf("GeneralData() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if nav, ok := got[0].(*general.NavData); !ok || nav.Source != tt.wantSource {
+				t.Errorf("GeneralData() nav = %+v, want source %d", got[0], tt.wantSource)
+			}
+			if fuel, ok := got[1].(*general.FuelData); !ok || fuel.Type != tt.wantFuel.Type || fuel.Fuel != tt.wantFuel.Fuel {
+				t.Errorf("GeneralData() fuel = %+v, want %+v", got[1], tt.wantFuel)
+			}
+		})
+	}
+}
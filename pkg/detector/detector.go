@@ -0,0 +1,166 @@
+/*
+Package detector recognizes protocol of connection by its first bytes, so terminals of different protocols
+can be served on one port. Bytes read during detection are handed back to reader of detected protocol.
+NDTP and EGTS are detected by default, other protocols are added by describing them with Protocol.
+*/
+package detector
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"time"
+
+	"github.com/egorban/navprot/pkg/egts"
+	"github.com/egorban/navprot/pkg/ndtp"
+)
+
+const (
+	// DefaultTimeout is default time to wait for header of connection
+	DefaultTimeout = 10 * time.Second
+
+	maxHeaderLen = 64
+)
+
+// ErrUnknownProtocol is returned when stream doesn't start with header of any protocol of Detector
+var ErrUnknownProtocol = errors.New("detector: unknown protocol")
+
+// Decoder reads binary packets of protocol, it's implemented by ndtp.Decoder and egts.Decoder
+type Decoder interface {
+	// Next returns next binary packet
+	Next() ([]byte, error)
+	// Skipped returns number of bytes skipped before packet or error returned by the last Next call
+	Skipped() int
+}
+
+// Protocol describes protocol recognized by Detector
+type Protocol struct {
+	// Name is protocol name, e.g. ndtp.ProtocolName
+	Name string
+	// Match reports whether data starts with packet header of protocol. If data is too short to decide,
+	// Match returns false and number of required bytes.
+	Match func(data []byte) (ok bool, need int)
+	// NewDecoder creates decoder of protocol packets
+	NewDecoder func(r io.Reader) Decoder
+}
+
+var (
+	// NDTP is recognized by NPL signature 0x7E7E
+	NDTP = Protocol{
+		Name:       ndtp.ProtocolName,
+		Match:      ndtp.MatchHeader,
+		NewDecoder: func(r io.Reader) Decoder { return ndtp.NewDecoder(r) },
+	}
+	// EGTS is recognized by PRV byte 0x01, header length and header checksum
+	EGTS = Protocol{
+		Name:       egts.ProtocolName,
+		Match:      egts.MatchHeader,
+		NewDecoder: func(r io.Reader) Decoder { return egts.NewDecoder(r) },
+	}
+)
+
+// Detector chooses protocol of stream from the list of protocols
+type Detector struct {
+	// Timeout limits time of reading header by DetectConn, 0 means no limit
+	Timeout time.Duration
+
+	protocols []Protocol
+}
+
+// New creates Detector of protocols, which are checked in the given order.
+// NDTP and EGTS are detected if protocols are not given.
+func New(protocols ...Protocol) *Detector {
+	if len(protocols) == 0 {
+		protocols = []Protocol{NDTP, EGTS}
+	}
+	return &Detector{Timeout: DefaultTimeout, protocols: protocols}
+}
+
+// Lookup returns protocol of Detector by name
+func (d *Detector) Lookup(name string) (Protocol, bool) {
+	for _, p := range d.protocols {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return Protocol{}, false
+}
+
+// Detect reads header of stream and returns its protocol. Returned reader contains the whole stream
+// including bytes read by Detect, it's returned together with error too. ErrUnknownProtocol is returned
+// if header doesn't match any protocol, read errors are returned as is.
+func (d *Detector) Detect(r io.Reader) (Protocol, io.Reader, error) {
+	header := make([]byte, 0, maxHeaderLen)
+	var readErr error
+	for {
+		p, ok, need := d.match(header)
+		rest := io.MultiReader(bytes.NewReader(header), r)
+		switch {
+		case ok:
+			return p, rest, nil
+		case need == 0 || need > cap(header):
+			return Protocol{}, rest, ErrUnknownProtocol
+		case readErr == io.EOF && len(header) > 0:
+			return Protocol{}, rest, io.ErrUnexpectedEOF
+		case readErr != nil:
+			return Protocol{}, rest, readErr
+		}
+		var n int
+		n, readErr = r.Read(header[len(header):cap(header)])
+		header = header[:len(header)+n]
+	}
+}
+
+// DetectConn detects protocol of connection like Detect. Returned connection reads bytes consumed by detection
+// before the rest of data, it's returned together with error too, so caller is responsible for closing it.
+func (d *Detector) DetectConn(conn net.Conn) (Protocol, net.Conn, error) {
+	if d.Timeout > 0 {
+		conn.SetReadDeadline(time.Now().Add(d.Timeout))
+		defer conn.SetReadDeadline(time.Time{})
+	}
+	p, r, err := d.Detect(conn)
+	return p, &detectedConn{Conn: conn, r: r}, err
+}
+
+// Find returns protocol and offset of the first correct packet in data. Unlike Detect it skips garbage
+// and checks the whole packet, so it's suitable for captured traffic.
+func (d *Detector) Find(data []byte) (p Protocol, offset int, ok bool) {
+	for i := range data {
+		for _, p := range d.protocols {
+			if ok, _ := p.Match(data[i:]); !ok {
+				continue
+			}
+			dec := p.NewDecoder(bytes.NewReader(data[i:]))
+			if _, err := dec.Next(); err == nil && dec.Skipped() == 0 {
+				return p, i, true
+			}
+		}
+	}
+	return Protocol{}, 0, false
+}
+
+// match returns the first protocol matching header, otherwise need is max number of bytes
+// required by protocols, which can't decide yet
+func (d *Detector) match(header []byte) (p Protocol, ok bool, need int) {
+	for _, p := range d.protocols {
+		ok, n := p.Match(header)
+		if ok {
+			return p, true, 0
+		}
+		if n > need {
+			need = n
+		}
+	}
+	return Protocol{}, false, need
+}
+
+// detectedConn returns header read by Detector before the rest of connection data
+type detectedConn struct {
+	net.Conn
+	r io.Reader
+}
+
+func (c *detectedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
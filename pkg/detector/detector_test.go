@@ -0,0 +1,163 @@
+package detector
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/egorban/navprot/pkg/egts"
+	"github.com/egorban/navprot/pkg/ndtp"
+)
+
+func ndtpPacket(t *testing.T) []byte {
+	packet, err := ndtp.NewConnRequest(1024).Form()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return packet
+}
+
+func egtsPacket(t *testing.T) []byte {
+	packet, err := (&egts.Packet{Type: egts.EgtsPtAppdata, ID: 1, Records: []*egts.Record{{
+		ID:      1024,
+		Service: egts.EgtsTeledataService,
+		Data:    []*egts.SubRecord{{Type: egts.EgtsSrLiquidLevelSensor, Data: &egts.FuelData{Type: 2, Fuel: 30}}},
+	}}}).Form()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return packet
+}
+
+func TestDetector_Detect(t *testing.T) {
+	ndtpData, egtsData := ndtpPacket(t), egtsPacket(t)
+	badHeader := append([]byte(nil), egtsData...)
+	badHeader[10]++
+	tests := []struct {
+		name    string
+		data    []byte
+		want    string
+		wantErr error
+	}{
+		{"ndtp", ndtpData, ndtp.ProtocolName, nil},
+		{"egts", egtsData, egts.ProtocolName, nil},
+		{"twoPackets", append(append([]byte(nil), egtsData...), ndtpData...), egts.ProtocolName, nil},
+		{"incorrectHeaderCrc", badHeader, "", ErrUnknownProtocol},
+		{"garbage", append([]byte{0, 1}, ndtpData...), "", ErrUnknownProtocol},
+		{"short", egtsData[:5], "", io.ErrUnexpectedEOF},
+		{"empty", nil, "", io.EOF},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, r, err := New().Detect(iotest.OneByteReader(bytes.NewReader(tt.data)))
+			if err != tt.wantErr {
+				t.Fatalf("Detect() error = %v, want %v", err, tt.wantErr)
+			}
+			if p.Name != tt.want {
+				t.Errorf("Detect() protocol = %q, want %q", p.Name, tt.want)
+			}
+			got, err := ioutil.ReadAll(r)
+			if err != nil || !bytes.Equal(got, tt.data) {
+				t.Errorf("Detect() reader returned %v, %v, want the whole stream", got, err)
+			}
+		})
+	}
+}
+
+func TestDetector_DetectConn(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	egtsData := egtsPacket(t)
+	go func() {
+		// header is split to check, that Detector waits for the rest of it
+		client.Write(egtsData[:3])
+		time.Sleep(10 * time.Millisecond)
+		client.Write(egtsData[3:])
+	}()
+	p, conn, err := New().DetectConn(server)
+	if err != nil {
+		t.Fatalf("DetectConn() error = %v", err)
+	}
+	defer conn.Close()
+	if p.Name != egts.ProtocolName {
+		t.Errorf("DetectConn() protocol = %q", p.Name)
+	}
+	frame, err := p.NewDecoder(conn).Next()
+	if err != nil || !bytes.Equal(frame, egtsData) {
+		t.Errorf("Next() = %v, %v, want %v", frame, err, egtsData)
+	}
+
+	silent, server := net.Pipe()
+	defer silent.Close()
+	d := New()
+	d.Timeout = 20 * time.Millisecond
+	if _, conn, err = d.DetectConn(server); err == nil {
+		t.Error("DetectConn() of silent connection succeeded")
+	}
+	conn.Close()
+}
+
+func TestDetector_Find(t *testing.T) {
+	ndtpData, egtsData := ndtpPacket(t), egtsPacket(t)
+	// 0x7E7E without correct packet and EGTS header prefix are skipped
+	garbage := []byte{0x7E, 0x7E, 0, 1, 0, 0}
+	p, offset, ok := New().Find(append(append(garbage, ndtpData...), egtsData...))
+	if !ok || p.Name != ndtp.ProtocolName || offset != len(garbage) {
+		t.Errorf("Find() = %q, %d, %v, want ndtp at %d", p.Name, offset, ok, len(garbage))
+	}
+	if _, _, ok = New(NDTP).Find(egtsData); ok {
+		t.Error("Find() of NDTP detector found packet in EGTS data")
+	}
+	if p, ok = New().Lookup(egts.ProtocolName); !ok || p.Name != egts.ProtocolName {
+		t.Errorf("Lookup() = %v, %v", p, ok)
+	}
+}
+
+func TestMux(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	ndtpIDs := make(chan int, 1)
+	egtsRecords := make(chan *egts.Record, 1)
+	mux := NewMux(New())
+	mux.Handle(ndtp.ProtocolName, func(conn net.Conn) {
+		ndtp.NewSession(conn, func(id int, packet *ndtp.Packet) uint32 {
+			ndtpIDs <- id
+			return ndtp.NphResultOk
+		}).Serve()
+	})
+	mux.Handle(egts.ProtocolName, func(conn net.Conn) {
+		defer conn.Close()
+		packet, err := egts.NewDecoder(conn).Decode()
+		if err == nil {
+			egtsRecords <- packet.Records[0]
+		}
+	})
+	go mux.Serve(l)
+
+	terminal := ndtp.NewTerminal(l.Addr().String(), 1024)
+	if err = terminal.Connect(); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	defer terminal.Close()
+	if id := <-ndtpIDs; id != 1024 {
+		t.Errorf("NDTP handler received terminal ID %d", id)
+	}
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err = conn.Write(egtsPacket(t)); err != nil {
+		t.Fatal(err)
+	}
+	if rec := <-egtsRecords; rec.ID != 1024 {
+		t.Errorf("EGTS handler received record %v", rec)
+	}
+}
@@ -0,0 +1,63 @@
+package detector
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// Mux serves connections of several protocols accepted on one listener.
+// Every connection is passed to handler of its detected protocol, e.g. to serve ndtp.Session.
+type Mux struct {
+	detector *Detector
+
+	mu       sync.RWMutex
+	handlers map[string]func(conn net.Conn)
+}
+
+// NewMux creates Mux, which detects protocols of connections by d
+func NewMux(d *Detector) *Mux {
+	return &Mux{detector: d, handlers: make(map[string]func(conn net.Conn))}
+}
+
+// Handle registers handler of connections of protocol name. Handler is responsible for closing connection.
+func (m *Mux) Handle(name string, handler func(conn net.Conn)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.handlers[name] = handler
+}
+
+// ServeConn detects protocol of conn and calls its handler. Connection is closed and error is returned
+// if protocol can't be detected or it has no handler.
+func (m *Mux) ServeConn(conn net.Conn) error {
+	p, conn, err := m.detector.DetectConn(conn)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	m.mu.RLock()
+	handler := m.handlers[p.Name]
+	m.mu.RUnlock()
+	if handler == nil {
+		conn.Close()
+		return ErrUnknownProtocol
+	}
+	handler(conn)
+	return nil
+}
+
+// Serve accepts connections on l and serves every connection by ServeConn in its own goroutine.
+// It returns error of Accept, l is closed by caller to stop Serve.
+func (m *Mux) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				time.Sleep(10 * time.Millisecond)
+				continue
+			}
+			return err
+		}
+		go m.ServeConn(conn)
+	}
+}
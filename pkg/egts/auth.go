@@ -0,0 +1,144 @@
+package egts
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+const (
+	// EgtsAuthService defines EGTS_AUTH_SERVICE
+	EgtsAuthService = 1
+	// EgtsSrTermIdentity defines EGTS_SR_TERM_IDENTITY subrecord
+	EgtsSrTermIdentity = 1
+	// EgtsSrResultCode defines EGTS_SR_RESULT_CODE subrecord
+	EgtsSrResultCode = 9
+
+	termIdentityLen = 5
+	imeiLen         = 15
+)
+
+// Processing result codes
+const (
+	// EgtsPcInProgress defines EGTS_PC_IN_PROGRESS
+	EgtsPcInProgress = 1
+	// EgtsPcUnsProtocol defines EGTS_PC_UNS_PROTOCOL
+	EgtsPcUnsProtocol = 128
+	// EgtsPcIncHeaderForm defines EGTS_PC_INC_HEADERFORM
+	EgtsPcIncHeaderForm = 131
+	// EgtsPcIncDataForm defines EGTS_PC_INC_DATAFORM
+	EgtsPcIncDataForm = 132
+	// EgtsPcUnsType defines EGTS_PC_UNS_TYPE
+	EgtsPcUnsType = 133
+	// EgtsPcNotEnParams defines EGTS_PC_NOTEN_PARAMS
+	EgtsPcNotEnParams = 134
+	// EgtsPcHeaderCrcError defines EGTS_PC_HEADERCRC_ERROR
+	EgtsPcHeaderCrcError = 137
+	// EgtsPcDataCrcError defines EGTS_PC_DATACRC_ERROR
+	EgtsPcDataCrcError = 138
+	// EgtsPcInvDataLen defines EGTS_PC_INVDATALEN
+	EgtsPcInvDataLen = 139
+	// EgtsPcObjNotFound defines EGTS_PC_OBJ_NFOUND
+	EgtsPcObjNotFound = 146
+	// EgtsPcSrvcNotFound defines EGTS_PC_SRVC_NFOUND
+	EgtsPcSrvcNotFound = 148
+	// EgtsPcSrvcDenied defines EGTS_PC_SRVC_DENIED
+	EgtsPcSrvcDenied = 149
+	// EgtsPcSrvcUnknown defines EGTS_PC_SRVC_UNKN
+	EgtsPcSrvcUnknown = 150
+	// EgtsPcAuthDenied defines EGTS_PC_AUTH_DENIED
+	EgtsPcAuthDenied = 151
+	// EgtsPcAlreadyExists defines EGTS_PC_ALREADY_EXISTS
+	EgtsPcAlreadyExists = 152
+	// EgtsPcIDNotFound defines EGTS_PC_ID_NFOUND
+	EgtsPcIDNotFound = 153
+)
+
+// TermIdentity describes EGTS_SR_TERM_IDENTITY subrecord
+type TermIdentity struct {
+	// Terminal Identifier
+	TID uint32 `json:"tid"`
+	// IMEI of terminal (optional)
+	IMEI string `json:"imei"`
+	// Buffer Size, max size of packet accepted by terminal (optional)
+	BufferSize uint16 `json:"buffer_size"`
+}
+
+// ResultCode describes EGTS_SR_RESULT_CODE subrecord
+type ResultCode struct {
+	// Result Code
+	RCD byte `json:"rcd"`
+}
+
+// lengths of optional fields of EGTS_SR_TERM_IDENTITY in order of flags: HDID, IMEI, IMSI, LNGC, -, NID, BS, MSISDN
+var termIdentityFields = [8]int{2, imeiLen, 16, 3, 0, 3, 2, 15}
+
+func (subData *SubRecord) parseAuthService(buff []byte) error {
+	switch subData.Type {
+	case EgtsSrTermIdentity:
+		return subData.parseTermIdentity(buff)
+	case EgtsSrResultCode:
+		if len(buff) < 1 {
+			return errors.New("EGTS_SR_RESULT_CODE is too short")
+		}
+		subData.Data = &ResultCode{RCD: buff[0]}
+	}
+	return nil
+}
+
+func (subData *SubRecord) parseTermIdentity(buff []byte) error {
+	if len(buff) < termIdentityLen {
+		return errors.New("EGTS_SR_TERM_IDENTITY is too short")
+	}
+	data := &TermIdentity{TID: binary.LittleEndian.Uint32(buff[:4])}
+	flags := buff[4]
+	pos := termIdentityLen
+	for i, fieldLen := range termIdentityFields {
+		if flags&(1<<uint(i)) == 0 {
+			continue
+		}
+		if len(buff) < pos+fieldLen {
+			return errors.New("EGTS_SR_TERM_IDENTITY is too short")
+		}
+		switch i {
+		case 1:
+			data.IMEI = string(bytes.TrimRight(buff[pos:pos+fieldLen], "\x00"))
+		case 6:
+			data.BufferSize = binary.LittleEndian.Uint16(buff[pos : pos+fieldLen])
+		}
+		pos += fieldLen
+	}
+	subData.Data = data
+	return nil
+}
+
+func (subData *SubRecord) formTermIdentity() (subrec []byte) {
+	data := subData.Data.(*TermIdentity)
+	subrec = make([]byte, 3+termIdentityLen)
+	subrec[0] = EgtsSrTermIdentity
+	binary.LittleEndian.PutUint32(subrec[3:7], data.TID)
+	if data.IMEI != "" {
+		subrec[7] |= 1 << 1
+		imei := make([]byte, imeiLen)
+		copy(imei, data.IMEI)
+		subrec = append(subrec, imei...)
+	}
+	if data.BufferSize != 0 {
+		subrec[7] |= 1 << 6
+		subrec = append(subrec, byte(data.BufferSize), byte(data.BufferSize>>8))
+	}
+	binary.LittleEndian.PutUint16(subrec[1:3], uint16(len(subrec)-3))
+	return
+}
+
+func (subData *SubRecord) formResultCode() []byte {
+	return []byte{EgtsSrResultCode, 1, 0, subData.Data.(*ResultCode).RCD}
+}
+
+func (sub *TermIdentity) String() string {
+	return stringDefault(*sub)
+}
+
+func (sub *ResultCode) String() string {
+	return stringDefault(*sub)
+}
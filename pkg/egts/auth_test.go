@@ -0,0 +1,40 @@
+package egts
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAuthService(t *testing.T) {
+	tests := []struct {
+		name string
+		sub  *SubRecord
+		want []byte
+	}{
+		{name: "termIdentity", sub: &SubRecord{Type: EgtsSrTermIdentity, Data: &TermIdentity{TID: 239}},
+			want: []byte{EgtsSrTermIdentity, 5, 0, 239, 0, 0, 0, 0}},
+		{name: "termIdentityImei", sub: &SubRecord{Type: EgtsSrTermIdentity,
+			Data: &TermIdentity{TID: 1, IMEI: "356307042441013", BufferSize: 1024}},
+			want: append(append([]byte{EgtsSrTermIdentity, 22, 0, 1, 0, 0, 0, 0x42}, "356307042441013"...), 0, 4)},
+		{name: "resultCode", sub: &SubRecord{Type: EgtsSrResultCode, Data: &ResultCode{RCD: EgtsPcAuthDenied}},
+			want: []byte{EgtsSrResultCode, 1, 0, EgtsPcAuthDenied}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.sub.form(EgtsAuthService)
+			if err != nil {
+				t.Fatalf("form() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("form() = %v, want %v", got, tt.want)
+			}
+			parsed := new(SubRecord)
+			if _, err = parsed.parse(EgtsAuthService, got, nil); err != nil {
+				t.Fatalf("parse() error = %v", err)
+			}
+			if !reflect.DeepEqual(parsed, tt.sub) {
+				t.Errorf("parse() = %v, want %v", parsed, tt.sub)
+			}
+		})
+	}
+}
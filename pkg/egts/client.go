@@ -0,0 +1,368 @@
+package egts
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultResponseTimeout is default value of TL_RESPONSE_TO parameter
+	DefaultResponseTimeout = 5 * time.Second
+	// DefaultResendAttempts is default value of TL_RESEND_ATTEMPTS parameter
+	DefaultResendAttempts = 3
+	// DefaultWindow is default number of unacknowledged packets
+	DefaultWindow = 64
+)
+
+var (
+	// ErrClientClosed is returned by Client methods after Close
+	ErrClientClosed = errors.New("egts client is closed")
+	// ErrNoResponse means that packet was not confirmed after all resend attempts
+	ErrNoResponse = errors.New("no response for packet")
+	// ErrNoConfirmation means that response to packet doesn't contain EGTS_SR_RECORD_RESPONSE for record
+	ErrNoConfirmation = errors.New("no confirmation for record")
+)
+
+// ResultError describes unsuccessful processing result of packet or record
+type ResultError struct {
+	// Processing Result or Record Status
+	Code byte
+}
+
+func (e *ResultError) Error() string {
+	return fmt.Sprintf("processing result %d", e.Code)
+}
+
+// ClientConfig contains transport layer parameters of EGTS client
+type ClientConfig struct {
+	// ResponseTimeout is time to wait for EGTS_PT_RESPONSE (TL_RESPONSE_TO)
+	ResponseTimeout time.Duration
+	// ResendAttempts is number of packet resending attempts (TL_RESEND_ATTEMPTS),
+	// 0 means DefaultResendAttempts and negative value means that packets are not resent
+	ResendAttempts int
+	// Window is max number of unacknowledged packets
+	Window int
+	// OnConfirm is called for every confirmed record (optional)
+	OnConfirm func(rec *Record)
+	// OnFail is called for every record, which delivery is failed (optional). When connection is lost,
+	// records of all unacknowledged packets are reported with the reason of stop.
+	OnFail func(rec *Record, err error)
+	// OnConfirm and OnFail are called in order of results by separate goroutine, so they can call Send.
+	// They must not call Close, because Close waits for delivery of results.
+}
+
+// Client sends EGTS packets to platform and resends them until they are confirmed
+type Client struct {
+	conn      net.Conn
+	conf      ClientConfig
+	mu        sync.Mutex
+	writeMu   sync.Mutex
+	pending   map[uint16]*pendingPacket
+	nextID    uint16
+	slots     chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+	err       error
+	wg        sync.WaitGroup
+	// results are delivered to callbacks by callbacks goroutine, it closes callbacksDone at exit
+	results       []result
+	notify        chan struct{}
+	callbacksDone chan struct{}
+}
+
+// result is delivery result of record passed to OnConfirm or OnFail
+type result struct {
+	rec *Record
+	err error
+}
+
+type pendingPacket struct {
+	packet   *Packet
+	data     []byte
+	sent     time.Time
+	attempts int
+}
+
+// NewClient creates Client, which uses conn for communication with platform.
+// Zero values in conf are replaced by default values, use negative ResendAttempts to disable resending.
+func NewClient(conn net.Conn, conf ClientConfig) *Client {
+	if conf.ResponseTimeout <= 0 {
+		conf.ResponseTimeout = DefaultResponseTimeout
+	}
+	if conf.ResendAttempts < 0 {
+		conf.ResendAttempts = 0
+	} else if conf.ResendAttempts == 0 {
+		conf.ResendAttempts = DefaultResendAttempts
+	}
+	if conf.Window <= 0 {
+		conf.Window = DefaultWindow
+	}
+	c := &Client{
+		conn:    conn,
+		conf:    conf,
+		pending: make(map[uint16]*pendingPacket),
+		slots:   make(chan struct{}, conf.Window),
+		done:    make(chan struct{}),
+		notify:  make(chan struct{}, 1),
+
+		callbacksDone: make(chan struct{}),
+	}
+	c.wg.Add(2)
+	go c.receive()
+	go c.resend()
+	go c.callbacks()
+	return c
+}
+
+// Send assigns next packet identifier to packet, sends it and keeps it until confirmation.
+// Send blocks while window of unacknowledged packets is full.
+func (c *Client) Send(packet *Packet) error {
+	select {
+	case c.slots <- struct{}{}:
+	case <-c.done:
+		return c.Err()
+	}
+	c.mu.Lock()
+	// client can be stopped after slot is taken, then pending packets are already reported
+	if c.err != nil {
+		err := c.err
+		c.mu.Unlock()
+		<-c.slots
+		return err
+	}
+	packet.ID = c.nextID
+	c.nextID++
+	data, err := packet.Form()
+	if err != nil {
+		c.mu.Unlock()
+		<-c.slots
+		return err
+	}
+	p := &pendingPacket{packet: packet, data: data, sent: time.Now()}
+	c.pending[packet.ID] = p
+	c.mu.Unlock()
+	return c.write(data)
+}
+
+// Pending returns number of unacknowledged packets
+func (c *Client) Pending() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.pending)
+}
+
+// Done returns channel, which is closed when client stops working
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns reason of client stop
+func (c *Client) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// Close closes connection and waits until all results are passed to callbacks.
+// Records of unacknowledged packets are not reported as failed.
+func (c *Client) Close() error {
+	err := c.stop(ErrClientClosed)
+	<-c.callbacksDone
+	return err
+}
+
+// stop closes connection, records of unacknowledged packets are reported as failed unless client is closed
+func (c *Client) stop(reason error) (err error) {
+	c.closeOnce.Do(func() {
+		c.mu.Lock()
+		c.err = reason
+		pending := c.pending
+		c.pending = make(map[uint16]*pendingPacket)
+		c.mu.Unlock()
+		if reason != ErrClientClosed {
+			for _, p := range pending {
+				c.fail(p.packet.Records, reason)
+			}
+		}
+		close(c.done)
+		err = c.conn.Close()
+	})
+	return
+}
+
+func (c *Client) write(data []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if _, err := c.conn.Write(data); err != nil {
+		c.stop(err)
+		return err
+	}
+	return nil
+}
+
+func (c *Client) receive() {
+	defer c.wg.Done()
+	decoder := NewDecoder(c.conn)
+	for {
+		packet, err := decoder.Decode()
+		if err == ErrCRC || err == ErrPacketTooLarge {
+			continue
+		}
+		if packet == nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			c.stop(err)
+			return
+		}
+		if err == nil {
+			c.handle(packet)
+		}
+	}
+}
+
+func (c *Client) handle(packet *Packet) {
+	if packet.Type != EgtsPtResponse {
+		return
+	}
+	resp, ok := packet.Data.(*Response)
+	if !ok {
+		return
+	}
+	c.mu.Lock()
+	p, ok := c.pending[resp.RPID]
+	if ok {
+		delete(c.pending, resp.RPID)
+	}
+	c.mu.Unlock()
+	if !ok {
+		return
+	}
+	<-c.slots
+	if resp.ProcRes != Success {
+		c.fail(p.packet.Records, &ResultError{Code: resp.ProcRes})
+		return
+	}
+	statuses := confirmations(packet.Records)
+	for _, rec := range p.packet.Records {
+		rst, ok := statuses[rec.RecNum]
+		switch {
+		case !ok:
+			c.report(rec, ErrNoConfirmation)
+		case rst != Success:
+			c.report(rec, &ResultError{Code: rst})
+		default:
+			c.report(rec, nil)
+		}
+	}
+}
+
+func (c *Client) resend() {
+	defer c.wg.Done()
+	ticker := time.NewTicker(c.conf.ResponseTimeout / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case now := <-ticker.C:
+			c.checkPending(now)
+		}
+	}
+}
+
+func (c *Client) checkPending(now time.Time) {
+	var resend [][]byte
+	var failed []*pendingPacket
+	c.mu.Lock()
+	for id, p := range c.pending {
+		if now.Sub(p.sent) < c.conf.ResponseTimeout {
+			continue
+		}
+		if p.attempts >= c.conf.ResendAttempts {
+			delete(c.pending, id)
+			failed = append(failed, p)
+			continue
+		}
+		p.attempts++
+		p.sent = now
+		resend = append(resend, p.data)
+	}
+	c.mu.Unlock()
+	for _, p := range failed {
+		<-c.slots
+		c.fail(p.packet.Records, ErrNoResponse)
+	}
+	for _, data := range resend {
+		if c.write(data) != nil {
+			return
+		}
+	}
+}
+
+func (c *Client) fail(records []*Record, err error) {
+	for _, rec := range records {
+		c.report(rec, err)
+	}
+}
+
+// report queues result of record for callbacks, nil err means confirmation
+func (c *Client) report(rec *Record, err error) {
+	c.mu.Lock()
+	c.results = append(c.results, result{rec: rec, err: err})
+	c.mu.Unlock()
+	select {
+	case c.notify <- struct{}{}:
+	default:
+	}
+}
+
+// callbacks passes results to OnConfirm and OnFail. After stop it waits for receive and resend goroutines
+// and delivers the rest of results.
+func (c *Client) callbacks() {
+	defer close(c.callbacksDone)
+	stopped := false
+	for {
+		c.mu.Lock()
+		results := c.results
+		c.results = nil
+		c.mu.Unlock()
+		for _, r := range results {
+			if r.err == nil {
+				if c.conf.OnConfirm != nil {
+					c.conf.OnConfirm(r.rec)
+				}
+			} else if c.conf.OnFail != nil {
+				c.conf.OnFail(r.rec, r.err)
+			}
+		}
+		if len(results) > 0 {
+			continue
+		}
+		if stopped {
+			return
+		}
+		select {
+		case <-c.notify:
+		case <-c.done:
+			c.wg.Wait()
+			stopped = true
+		}
+	}
+}
+
+func confirmations(records []*Record) map[uint16]byte {
+	statuses := make(map[uint16]byte)
+	for _, rec := range records {
+		for _, sub := range rec.Data {
+			if conf, ok := sub.Data.(*Confirmation); ok {
+				statuses[conf.CRN] = conf.RST
+			}
+		}
+	}
+	return statuses
+}
@@ -0,0 +1,275 @@
+package egts
+
+import (
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestClient_Send(t *testing.T) {
+	tests := []struct {
+		name        string
+		reply       func(packet *Packet, attempt int) *Packet
+		wantConfirm int
+		wantFail    int
+		wantErr     error
+		wantSent    int
+	}{
+		{name: "confirmed", reply: replyOk, wantConfirm: 2, wantSent: 1},
+		{name: "resent", reply: replyOnSecondAttempt, wantConfirm: 2, wantSent: 2},
+		{name: "noResponse", reply: noReply, wantFail: 2, wantErr: ErrNoResponse, wantSent: 3},
+		{name: "recordStatus", reply: replyRecordStatus, wantConfirm: 1, wantFail: 1, wantSent: 1},
+		{name: "noConfirmation", reply: replyWithoutRecords, wantFail: 2, wantErr: ErrNoConfirmation, wantSent: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientConn, serverConn := net.Pipe()
+			received := make(chan *Packet, 10)
+			go serveResponses(serverConn, tt.reply, received)
+			var mu sync.Mutex
+			var confirmed, failed []*Record
+			var failErr error
+			done := make(chan struct{}, 4)
+			conf := ClientConfig{
+				ResponseTimeout: 40 * time.Millisecond,
+				ResendAttempts:  2,
+				OnConfirm: func(rec *Record) {
+					mu.Lock()
+					confirmed = append(confirmed, rec)
+					mu.Unlock()
+					done <- struct{}{}
+				},
+				OnFail: func(rec *Record, err error) {
+					mu.Lock()
+					failed = append(failed, rec)
+					failErr = err
+					mu.Unlock()
+					done <- struct{}{}
+				},
+			}
+			client := NewClient(clientConn, conf)
+			defer client.Close()
+			if err := client.Send(clientPacket()); err != nil {
+				t.Fatalf("Send() error = %v", err)
+			}
+			for i := 0; i < 2; i++ {
+				select {
+				case <-done:
+				case <-time.After(time.Second):
+					t.Fatal("timeout waiting for delivery result")
+				}
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if len(confirmed) != tt.wantConfirm || len(failed) != tt.wantFail {
+				t.Errorf("confirmed = %d, failed = %d; want %d, %d", len(confirmed), len(failed), tt.wantConfirm, tt.wantFail)
+			}
+			if tt.wantErr != nil && failErr != tt.wantErr {
+				t.Errorf("fail error = %v, want %v", failErr, tt.wantErr)
+			}
+			if len(received) != tt.wantSent {
+				t.Errorf("sent %d times, want %d", len(received), tt.wantSent)
+			}
+			if client.Pending() != 0 {
+				t.Errorf("Pending() = %d, want 0", client.Pending())
+			}
+		})
+	}
+}
+
+func TestClient_noResend(t *testing.T) {
+	clientConn, serverConn := net.Pipe()
+	received := make(chan *Packet, 10)
+	go serveResponses(serverConn, noReply, received)
+	failed := make(chan error, 2)
+	client := NewClient(clientConn, ClientConfig{
+		ResponseTimeout: 20 * time.Millisecond,
+		ResendAttempts:  -1,
+		OnFail: func(rec *Record, err error) {
+			failed <- err
+		},
+	})
+	defer client.Close()
+	if err := client.Send(clientPacket()); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-failed:
+			if err != ErrNoResponse {
+				t.Errorf("fail error = %v, want %v", err, ErrNoResponse)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("timeout waiting for delivery result")
+		}
+	}
+	if len(received) != 1 {
+		t.Errorf("sent %d times, want 1", len(received))
+	}
+}
+
+func TestClient_sendAfterClose(t *testing.T) {
+	clientConn, serverConn := net.Pipe()
+	defer serverConn.Close()
+	client := NewClient(clientConn, ClientConfig{})
+	client.Close()
+	// free slots don't let Send add packets to stopped client
+	for i := 0; i < 20; i++ {
+		if err := client.Send(clientPacket()); err != ErrClientClosed {
+			t.Fatalf("Send() after Close error = %v, want %v", err, ErrClientClosed)
+		}
+	}
+	if client.Pending() != 0 {
+		t.Errorf("Pending() = %d, want 0", client.Pending())
+	}
+}
+
+func TestClient_connectionLost(t *testing.T) {
+	clientConn, serverConn := net.Pipe()
+	go func() {
+		NewDecoder(serverConn).Decode()
+		serverConn.Close()
+	}()
+	failed := make(chan error, 2)
+	client := NewClient(clientConn, ClientConfig{
+		OnFail: func(rec *Record, err error) {
+			failed <- err
+		},
+	})
+	defer client.Close()
+	if err := client.Send(clientPacket()); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-failed:
+			if err != io.ErrUnexpectedEOF {
+				t.Errorf("fail error = %v, want %v", err, io.ErrUnexpectedEOF)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("unacknowledged records are not reported after connection loss")
+		}
+	}
+	if client.Pending() != 0 {
+		t.Errorf("Pending() = %d, want 0", client.Pending())
+	}
+}
+
+func TestClient_sendFromCallback(t *testing.T) {
+	clientConn, serverConn := net.Pipe()
+	received := make(chan *Packet, 10)
+	go serveResponses(serverConn, replyOk, received)
+	sent := make(chan error, 1)
+	var client *Client
+	var once sync.Once
+	client = NewClient(clientConn, ClientConfig{
+		Window: 1,
+		OnConfirm: func(rec *Record) {
+			// the second Send waits until response to the first one is received
+			once.Do(func() {
+				err := client.Send(clientPacket())
+				if err == nil {
+					err = client.Send(clientPacket())
+				}
+				sent <- err
+			})
+		},
+	})
+	defer client.Close()
+	if err := client.Send(clientPacket()); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	select {
+	case err := <-sent:
+		if err != nil {
+			t.Errorf("Send() from callback error = %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Send() from callback is blocked")
+	}
+}
+
+func serveResponses(conn net.Conn, reply func(*Packet, int) *Packet, received chan<- *Packet) {
+	defer conn.Close()
+	encoder := NewEncoder(conn)
+	decoder := NewDecoder(conn)
+	attempts := make(map[uint16]int)
+	for {
+		packet, err := decoder.Decode()
+		if err != nil {
+			return
+		}
+		received <- packet
+		attempts[packet.ID]++
+		if resp := reply(packet, attempts[packet.ID]); resp != nil {
+			if err = encoder.Encode(resp); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func clientPacket() *Packet {
+	records := make([]*Record, 0, 2)
+	for i := uint16(1); i <= 2; i++ {
+		records = append(records, &Record{
+			RecNum:  i,
+			ID:      239,
+			Service: EgtsTeledataService,
+			Data: []*SubRecord{{
+				Type: EgtsSrLiquidLevelSensor,
+				Data: &FuelData{Type: 2, Fuel: 2},
+			}},
+		})
+	}
+	return &Packet{Type: EgtsPtAppdata, Records: records}
+}
+
+func response(packet *Packet, rst func(rec *Record) byte) *Packet {
+	records := make([]*Record, 0, len(packet.Records))
+	for _, rec := range packet.Records {
+		records = append(records, &Record{
+			RecNum:  rec.RecNum,
+			Service: rec.Service,
+			Data: []*SubRecord{{
+				Type: EgtsSrResponse,
+				Data: &Confirmation{CRN: rec.RecNum, RST: rst(rec)},
+			}},
+		})
+	}
+	return &Packet{
+		Type:    EgtsPtResponse,
+		Records: records,
+		Data:    &Response{RPID: packet.ID, ProcRes: Success},
+	}
+}
+
+func replyOk(packet *Packet, _ int) *Packet {
+	return response(packet, func(*Record) byte { return Success })
+}
+
+func replyOnSecondAttempt(packet *Packet, attempt int) *Packet {
+	if attempt < 2 {
+		return nil
+	}
+	return replyOk(packet, attempt)
+}
+
+func noReply(*Packet, int) *Packet {
+	return nil
+}
+
+func replyWithoutRecords(packet *Packet, _ int) *Packet {
+	return &Packet{Type: EgtsPtResponse, Data: &Response{RPID: packet.ID, ProcRes: Success}}
+}
+
+func replyRecordStatus(packet *Packet, _ int) *Packet {
+	return response(packet, func(rec *Record) byte {
+		if rec.RecNum == 2 {
+			return 153
+		}
+		return Success
+	})
+}
@@ -0,0 +1,159 @@
+package egts
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/egorban/navprot/internal/framer"
+)
+
+const (
+	// DefaultMaxPacketSize is default max size of EGTS packet accepted by Decoder,
+	// it's size of the largest packet: max header, 65535 bytes of data and data checksum
+	DefaultMaxPacketSize = maxEgtsHeaderLen + 0xFFFF + 2
+
+	maxEgtsHeaderLen = 16
+	decoderBufLen    = 4096
+)
+
+var (
+	// ErrCRC is returned by Decoder when packet header or data has incorrect checksum
+	ErrCRC = errors.New("egts: incorrect crc")
+	// ErrPacketTooLarge is returned by Decoder when packet length exceeds MaxPacketSize
+	ErrPacketTooLarge = errors.New("egts: packet is too large")
+)
+
+// Decoder reads EGTS packets from input stream. Packet header is recognized by PRV byte and header length.
+// After corruption Decoder looks for the next header.
+type Decoder struct {
+	// MaxPacketSize is max size of packet including header and data checksum
+	MaxPacketSize int
+
+	f *framer.Reader
+}
+
+// NewDecoder creates Decoder, which reads packets from r
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{
+		MaxPacketSize: DefaultMaxPacketSize,
+		f:             framer.NewReader(r, decoderBufLen),
+	}
+}
+
+// Decode returns next packet from stream. Packet is returned together with parsing error,
+// if packet framing and checksums are correct, but data can't be parsed. ErrCRC and ErrPacketTooLarge
+// are not fatal, decoding can be continued. Read errors are returned as is, io.EOF means end of stream.
+func (d *Decoder) Decode() (*Packet, error) {
+	frame, err := d.Next()
+	if err != nil {
+		return nil, err
+	}
+	// Parse copies data referenced by packet, so frame can be reused by the next Next call
+	packet := new(Packet)
+	_, err = packet.Parse(frame)
+	return packet, err
+}
+
+// MatchHeader reports whether data starts with packet header: PRV byte, header length and header checksum
+// are checked. If data is too short to decide, false and number of required bytes are returned.
+func MatchHeader(data []byte) (ok bool, need int) {
+	if len(data) == 0 {
+		return false, 1
+	}
+	if data[0] != prvSignature {
+		return false, 0
+	}
+	if len(data) < 4 {
+		return false, minEgtsHeaderLen
+	}
+	headerLen := int(data[3])
+	if headerLen != minEgtsHeaderLen && headerLen != maxEgtsHeaderLen {
+		return false, 0
+	}
+	if len(data) < headerLen {
+		return false, headerLen
+	}
+	return uint(data[headerLen-1]) == crc8EGTS(data[:headerLen-1]), 0
+}
+
+// Next returns next binary packet from stream without parsing and copying. Returned slice
+// references internal buffer and is valid until the next call of Next or Decode, so it can be
+// parsed by Packet.ParseInto without memory allocation. Errors are the same as in Decode.
+func (d *Decoder) Next() ([]byte, error) {
+	d.f.ResetSkipped()
+	for {
+		data := d.f.Data()
+		first := bytes.IndexByte(data, prvSignature)
+		if first == -1 {
+			d.f.Skip(len(data))
+		} else if first > 0 {
+			d.f.Skip(first)
+			continue
+		}
+		if first != 0 || len(data) < minEgtsHeaderLen {
+			if err := d.f.Fill(minEgtsHeaderLen); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		headerLen := int(data[3])
+		if headerLen != minEgtsHeaderLen && headerLen != maxEgtsHeaderLen {
+			d.f.Skip(1)
+			continue
+		}
+		if len(data) < headerLen {
+			if err := d.f.Fill(headerLen); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if uint(data[headerLen-1]) != crc8EGTS(data[:headerLen-1]) {
+			d.f.Skip(1)
+			return nil, ErrCRC
+		}
+		bodyLen := int(binary.LittleEndian.Uint16(data[5:7]))
+		size := headerLen + bodyLen + 2
+		if size > d.MaxPacketSize {
+			d.f.Skip(1)
+			return nil, ErrPacketTooLarge
+		}
+		if len(data) < size {
+			if err := d.f.Fill(size); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if binary.LittleEndian.Uint16(data[size-2:size]) != crc16EGTS(data[headerLen:size-2]) {
+			d.f.Skip(1)
+			return nil, ErrCRC
+		}
+		return d.f.Take(size), nil
+	}
+}
+
+// Skipped returns number of bytes skipped before packet or error returned by the last Decode call
+func (d *Decoder) Skipped() int {
+	return d.f.Skipped()
+}
+
+// Encoder writes EGTS packets to output stream
+type Encoder struct {
+	w io.Writer
+}
+
+// NewEncoder creates Encoder, which writes packets to w
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w}
+}
+
+// Encode writes binary packet generated by packet.Form
+func (e *Encoder) Encode(packet *Packet) error {
+	data, err := packet.Form()
+	if err != nil {
+		return err
+	}
+	_, err = e.w.Write(data)
+	return err
+}
@@ -0,0 +1,153 @@
+package egts
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+	"testing/iotest"
+)
+
+func TestDecoder_Decode(t *testing.T) {
+	pos := packetPosData()
+	badCrc := egtsIncorrectBodyCrc()
+	badHeader := egtsIncorrectHeaderCrc()
+	tooLarge := []byte{1, 0, 0, 11, 0, 255, 255, 0, 0, 1, 0}
+	tooLarge[10] = byte(crc8EGTS(tooLarge[:10]))
+	tests := []struct {
+		name        string
+		stream      [][]byte
+		wantPackets []*Packet
+		wantErrs    []error
+		wantSkipped []int
+	}{
+		{"packets", [][]byte{pos, packetFuelData()}, []*Packet{egtsPosData(), egtsFuelData(), nil},
+			[]error{nil, nil, io.EOF}, []int{0, 0, 0}},
+		{"garbage", [][]byte{{1, 2, 3}, pos, {1, 4}}, []*Packet{egtsPosData(), nil},
+			[]error{nil, io.ErrUnexpectedEOF}, []int{3, 2}},
+		{"incorrectHeaderCrc", [][]byte{badHeader, pos}, []*Packet{nil, egtsPosData()},
+			[]error{ErrCRC, nil}, []int{1, len(badHeader) - 1}},
+		{"crc", [][]byte{badCrc, pos}, []*Packet{nil, egtsPosData(), nil},
+			[]error{ErrCRC, nil, io.EOF}, []int{1, len(badCrc) - 1, 0}},
+		{"tooLarge", [][]byte{tooLarge, pos}, []*Packet{nil, egtsPosData()},
+			[]error{ErrPacketTooLarge, nil}, []int{1, len(tooLarge) - 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stream := bytes.Join(tt.stream, nil)
+			decoder := NewDecoder(iotest.OneByteReader(bytes.NewReader(stream)))
+			decoder.MaxPacketSize = 1024
+			for i, want := range tt.wantPackets {
+				got, err := decoder.Decode()
+				if err != tt.wantErrs[i] {
+					t.Fatalf("Decode() #%d error = %v, want %v", i, err, tt.wantErrs[i])
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("Decode() #%d = %v, want %v", i, got, want)
+				}
+				if decoder.Skipped() != tt.wantSkipped[i] {
+					t.Errorf("Skipped() #%d = %d, want %d", i, decoder.Skipped(), tt.wantSkipped[i])
+				}
+			}
+		})
+	}
+}
+
+func TestEncoder_Encode(t *testing.T) {
+	var buf bytes.Buffer
+	encoder := NewEncoder(&buf)
+	for _, packet := range []*Packet{navPacket(), fuelPacket()} {
+		if err := encoder.Encode(packet); err != nil {
+			t.Fatalf("Encode() error = %v", err)
+		}
+	}
+	want := append(wantNavData(), wantFuelData()...)
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("Encode() = %v, want %v", buf.Bytes(), want)
+	}
+}
+
+func TestDecoder_Next(t *testing.T) {
+	pos := packetPosData()
+	stream := bytes.Join([][]byte{{2, 3}, pos, pos}, nil)
+	decoder := NewDecoder(iotest.OneByteReader(bytes.NewReader(stream)))
+	packet := new(Packet)
+	for i := 0; i < 2; i++ {
+		frame, err := decoder.Next()
+		if err != nil {
+			t.Fatalf("Next() #%d error = %v", i, err)
+		}
+		if !bytes.Equal(frame, pos) {
+			t.Errorf("Next() #%d = %v, want %v", i, frame, pos)
+		}
+		if _, err = packet.ParseInto(frame); err != nil {
+			t.Errorf("ParseInto() #%d error = %v", i, err)
+		}
+	}
+	if _, err := decoder.Next(); err != io.EOF {
+		t.Errorf("Next() error = %v, want %v", err, io.EOF)
+	}
+}
+
+func TestDecoder_largePacket(t *testing.T) {
+	packet := &Packet{Type: EgtsPtAppdata, ID: 1}
+	for i := 0; i < 2000; i++ {
+		packet.Records = append(packet.Records, &Record{
+			RecNum:  uint16(i),
+			ID:      239,
+			Service: EgtsTeledataService,
+			Data:    []*SubRecord{{Type: EgtsSrLiquidLevelSensor, Data: &FuelData{Type: 2, Fuel: 150}}},
+		})
+	}
+	message, err := packet.Form()
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame, err := NewDecoder(bytes.NewReader(message)).Next()
+	if err != nil || !bytes.Equal(frame, message) {
+		t.Errorf("Next() of %d bytes packet = %d bytes, %v", len(message), len(frame), err)
+	}
+}
+
+func TestMatchHeader(t *testing.T) {
+	pos := packetPosData()
+	tests := []struct {
+		name     string
+		data     []byte
+		wantOk   bool
+		wantNeed int
+	}{
+		{"empty", nil, false, 1},
+		{"prv", pos[:1], false, minEgtsHeaderLen},
+		{"header", pos[:minEgtsHeaderLen], true, 0},
+		{"packet", pos, true, 0},
+		{"incorrectHeaderCrc", egtsIncorrectHeaderCrc(), false, 0},
+		{"headerLen", []byte{1, 0, 0, 12}, false, 0},
+		{"longHeader", []byte{1, 0, 0, maxEgtsHeaderLen, 0}, false, maxEgtsHeaderLen},
+		{"ndtp", []byte{0x7E, 0x7E}, false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, need := MatchHeader(tt.data)
+			if ok != tt.wantOk || need != tt.wantNeed {
+				t.Errorf("MatchHeader() = %v, %d, want %v, %d", ok, need, tt.wantOk, tt.wantNeed)
+			}
+		})
+	}
+}
+
+func TestDecoder_decodedPacketIsKept(t *testing.T) {
+	stream := append(packetPosData(), packetFuelData()...)
+	decoder := NewDecoder(iotest.OneByteReader(bytes.NewReader(stream)))
+	first, err := decoder.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the next packet reuses buffer of decoder
+	if _, err = decoder.Decode(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(first, egtsPosData()) {
+		t.Errorf("packet changed after the next Decode() = %v, want %v", first, egtsPosData())
+	}
+}
@@ -5,7 +5,9 @@ package egts
 
 import (
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"time"
 )
 
 const (
@@ -14,6 +16,8 @@ const (
 	egtsRecordHeaderLen   = 11
 	egtsSubrecDataLen     = 21
 	egtsSubrecFuelDataLen = 7
+	defaultFuelNumber     = 2
+	defaultFuelAddress    = 1
 
 	// EgtsPtResponse defines EGTS_PT_RESPONSE packet type
 	EgtsPtResponse = 0
@@ -23,16 +27,30 @@ const (
 	EgtsTeledataService = 2
 	// EgtsSrPosData defines EGTS_SR_POS_DATA subrecord
 	EgtsSrPosData = 16
+	// EgtsSrAdSensorsData defines EGTS_SR_AD_SENSORS_DATA subrecord
+	EgtsSrAdSensorsData = 18
+	// EgtsSrCountersData defines EGTS_SR_COUNTERS_DATA subrecord
+	EgtsSrCountersData = 19
 	// EgtsSrLiquidLevelSensor defines EGTS_SR_LIQUID_LEVEL_SENSOR subrecord
 	EgtsSrLiquidLevelSensor = 27
 	// EgtsSrResponse defines EGTS_SR_RECORD_RESPONSE subrecord
 	EgtsSrResponse = 0
+	// SourceSos is source code of position data sent by alarm button
+	SourceSos = 13
 	// Timestamp20100101utc is EGTS initial time
 	Timestamp20100101utc = 1262304000
 	// Success status
 	Success = 0
+
+	// EGTS packet fields names
+
+	// PacketID defines packet identifier field (PID)
+	PacketID = "PacketID"
 )
 
+// Epoch is EGTS initial time, timestamps of EGTS are seconds since Epoch
+var Epoch = time.Unix(Timestamp20100101utc, 0).UTC()
+
 // Packet contains information about about EGTS protocol (ERA GLONASS Telematics Standard) packet
 type Packet struct {
 	// Packet Type
@@ -43,27 +61,55 @@ type Packet struct {
 	Records []*Record
 	// Additional Data (optional)
 	Data interface{}
+
+	storage storage
 }
 
 // Response describes EGTS_PT_RESPONSE packet
 type Response struct {
 	// Response Packet ID
-	RPID uint16
+	RPID uint16 `json:"rpid"`
 	// Processing Result
-	ProcRes byte
+	ProcRes byte `json:"proc_res"`
 }
 
 // Parse EGTS packet. Parsed information is stored in variable with EGTS type.
+// RecBin of records and restBuf are copies, so message can be reused after Parse.
 func (packetData *Packet) Parse(message []byte) (restBuf []byte, err error) {
+	return packetData.parse(message, nil)
+}
+
+// ParseInto parses EGTS packet like Parse, but reuses memory of previously parsed packet.
+// Records and subrecords of previous packet are overwritten, RecBin and restBuf reference message.
+// Parsing of teledata doesn't allocate memory in steady state.
+func (packetData *Packet) ParseInto(message []byte) (restBuf []byte, err error) {
+	packetData.Reset()
+	return packetData.parse(message, &packetData.storage)
+}
+
+// Reset clears packet keeping memory for the next ParseInto call
+func (packetData *Packet) Reset() {
+	packetData.Type = 0
+	packetData.ID = 0
+	packetData.Records = nil
+	packetData.Data = nil
+	packetData.storage.reset()
+}
+
+func (packetData *Packet) parse(message []byte, st *storage) (restBuf []byte, err error) {
 	body, restBuf, err := packetData.parseHeader(message)
+	if st == nil && restBuf != nil {
+		// only ParseInto returns references to message
+		restBuf = append([]byte(nil), restBuf...)
+	}
 	if err != nil {
 		return
 	}
 	switch packetData.Type {
 	case EgtsPtResponse:
-		packetData.parseResponce(body)
+		err = packetData.parseResponce(body, st)
 	case EgtsPtAppdata:
-		packetData.parseAppData(body)
+		err = packetData.parseAppData(body, st)
 	default:
 		err = fmt.Errorf("packet type %d not implemented", packetData.Type)
 		return
@@ -101,6 +147,22 @@ func formData(packetData *Packet) (data []byte, err error) {
 	return
 }
 
+// Change changes values of specified fields of EGTS binary packet and recalculates header checksum
+func Change(packet []byte, changes map[string]int) []byte {
+	if len(packet) < minEgtsHeaderLen {
+		return packet
+	}
+	headerLen := int(packet[3])
+	if headerLen < minEgtsHeaderLen || headerLen > len(packet) {
+		return packet
+	}
+	if id, ok := changes[PacketID]; ok {
+		binary.LittleEndian.PutUint16(packet[7:9], uint16(id))
+	}
+	packet[headerLen-1] = byte(crc8EGTS(packet[:headerLen-1]))
+	return packet
+}
+
 // Print generate string with information about EGTS packet in readable format.
 func (packetData Packet) String() string {
 	h := fmt.Sprintf("Header: {PacketType:%d; ID:%d}; ", packetData.Type, packetData.ID)
@@ -108,16 +170,21 @@ func (packetData Packet) String() string {
 	return h + b
 }
 
-func (packetData *Packet) parseResponce(body []byte) {
-	recp := new(Response)
+func (packetData *Packet) parseResponce(body []byte, st *storage) (err error) {
+	if len(body) < 3 {
+		return errors.New("response is too short")
+	}
+	recp := st.newResponse()
 	recp.RPID = binary.LittleEndian.Uint16(body[:2])
 	recp.ProcRes = body[2]
-	packetData.Records = parseRecords(body[3:])
 	packetData.Data = recp
+	packetData.Records, err = parseRecords(body[3:], st)
+	return
 }
 
-func (packetData *Packet) parseAppData(body []byte) {
-	packetData.Records = parseRecords(body)
+func (packetData *Packet) parseAppData(body []byte, st *storage) (err error) {
+	packetData.Records, err = parseRecords(body, st)
+	return
 }
 
 func (packetData *Packet) formAppData() (packet []byte, err error) {
@@ -137,8 +204,10 @@ func (packetData *Packet) formAppData() (packet []byte, err error) {
 }
 
 func (packetData *Packet) formResponse() ([]byte, error) {
+	resp := packetData.Data.(*Response)
 	packet := make([]byte, 3)
-	binary.LittleEndian.PutUint16(packet[0:2], packetData.Data.(*Response).RPID)
+	binary.LittleEndian.PutUint16(packet[0:2], resp.RPID)
+	packet[2] = resp.ProcRes
 	for _, rec := range packetData.Records {
 		recBin, err := rec.formResponse()
 		if err != nil {
@@ -149,15 +218,21 @@ func (packetData *Packet) formResponse() ([]byte, error) {
 	return packet, nil
 }
 
-func parseRecords(body []byte) []*Record {
-	records := make([]*Record, 0, 1)
+func parseRecords(body []byte, st *storage) ([]*Record, error) {
+	records := st.newRecords()
 	restBuff := body
 	for len(restBuff) > 0 {
-		recData := new(Record)
-		restBuff = recData.parseRecord(restBuff)
+		recData := st.newRecord()
+		var err error
+		restBuff, err = recData.parseRecord(restBuff, st)
+		if err != nil {
+			st.setRecords(records)
+			return records, err
+		}
 		records = append(records, recData)
 	}
-	return records
+	st.setRecords(records)
+	return records, nil
 }
 
 func (packetData *Packet) data2String() (body string) {
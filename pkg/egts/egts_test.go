@@ -1,8 +1,11 @@
 package egts
 
 import (
+	"bytes"
 	"reflect"
 	"testing"
+
+	"github.com/egorban/navprot/pkg/general"
 )
 
 func TestEGTS_Parse(t *testing.T) {
@@ -416,5 +419,189 @@ func TestPacket_String(t *testing.T) {
 }
 
 func wantEgtsString() string {
-	return "Header: {PacketType:1; ID:0}; Records: {RecHeader: {Service:2; ID:239; RecNum:0}, [{SubType: 16,{Lon:37.782409656276556 Lat:55.62752532903746 Time:271266258 Bearing:178 Speed:0 Lohs:0 Lahs:0 Mv:0 RealTime:0 Valid:1 Source:0}}{SubType: 27,{Type:2 Fuel:2}}]}"
+	return "Header: {PacketType:1; ID:0}; Records: {RecHeader: {Service:2; ID:239; RecNum:0}, [{SubType: 16,{Lon:37.782409656276556 Lat:55.62752532903746 Time:271266258 Bearing:178 Speed:0 Lohs:0 Lahs:0 Mv:0 RealTime:0 Valid:1 Source:0}}{SubType: 27,{Type:2 Fuel:2 Number:0 Address:0}}]}"
+}
+
+func TestPacket_ParseInto(t *testing.T) {
+	tests := []struct {
+		name     string
+		message  []byte
+		wantEgts *Packet
+	}{
+		{"posAndFuelData", packetPosAndFuelData(), egtsPosAndFuelData()},
+		{"result", packetResult(), egtsRes()},
+		{"posData", packetPosData(), egtsPosData()},
+		{"fuelData", packetFuelData(), egtsFuelData()},
+		{"posAndFuelDataAgain", packetPosAndFuelData(), egtsPosAndFuelData()},
+	}
+	egts := new(Packet)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := egts.ParseInto(tt.message); err != nil {
+				t.Fatalf("ParseInto() error = %v", err)
+			}
+			got := &Packet{Type: egts.Type, ID: egts.ID, Records: egts.Records, Data: egts.Data}
+			if !reflect.DeepEqual(got, tt.wantEgts) {
+				t.Error("got:      ", got, "\nexpected: ", tt.wantEgts)
+			}
+		})
+	}
+}
+
+func TestPacket_ParseCopies(t *testing.T) {
+	message := append(packetPosAndFuelData(), 1, 2, 3)
+	packet := new(Packet)
+	restBuf, err := packet.Parse(message)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	recBin := append([]byte(nil), packet.Records[0].RecBin...)
+	// caller reuses its buffer
+	for i := range message {
+		message[i] = 0
+	}
+	if !bytes.Equal(packet.Records[0].RecBin, recBin) || !bytes.Equal(restBuf, []byte{1, 2, 3}) {
+		t.Errorf("Parse() result references message: RecBin %v, restBuf %v", packet.Records[0].RecBin, restBuf)
+	}
+}
+
+func TestPacket_ParseIntoAllocs(t *testing.T) {
+	message := packetPosAndFuelData()
+	egts := new(Packet)
+	allocs := testing.AllocsPerRun(100, func() {
+		if _, err := egts.ParseInto(message); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("ParseInto() allocs = %v, want 0", allocs)
+	}
+}
+
+func BenchmarkPacket_Parse(b *testing.B) {
+	message := packetPosAndFuelData()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		egts := new(Packet)
+		if _, err := egts.Parse(message); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkPacket_ParseInto(b *testing.B) {
+	message := packetPosAndFuelData()
+	egts := new(Packet)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := egts.ParseInto(message); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestRecord_Time(t *testing.T) {
+	packet := egtsFuelData()
+	packet.Records[0].Time = 260657700
+	packet.Records[0].HasTime = true
+	packet.Records[0].RecBin = nil
+	fuel := packet.Records[0].Data[0].Data.(*FuelData)
+	fuel.Number = 3
+	fuel.Address = 5
+	message, err := packet.Form()
+	if err != nil {
+		t.Fatalf("Form() error = %v", err)
+	}
+	parsed := new(Packet)
+	if _, err = parsed.Parse(message); err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	rec := parsed.Records[0]
+	if rec.Time != 260657700 || !rec.HasTime || rec.ID != packet.Records[0].ID || rec.Service != EgtsTeledataService {
+		t.Errorf("parsed record = %v, want %v", rec, packet.Records[0])
+	}
+	if !reflect.DeepEqual(rec.Data, packet.Records[0].Data) {
+		t.Errorf("parsed subrecords = %v, want %v", rec.Data, packet.Records[0].Data)
+	}
+}
+
+func TestPosData_SpeedRoundTrip(t *testing.T) {
+	tests := []struct {
+		speed, want general.KmH
+	}{
+		{0, 0}, {0.1, 0.1}, {60, 60}, {123.4, 123.4}, {1638.3, 1638.3},
+		// speed out of 14 bits is limited instead of wrapping
+		{1700, 1638.3}, {-5, 0},
+	}
+	for _, tt := range tests {
+		packet := Packet{Type: EgtsPtAppdata, Records: []*Record{{ID: 1, Service: EgtsTeledataService,
+			Data: []*SubRecord{{Type: EgtsSrPosData, Data: &PosData{Speed: tt.speed, Mv: 1}}}}}}
+		message, err := packet.Form()
+		if err != nil {
+			t.Fatalf("Form() error = %v", err)
+		}
+		parsed := new(Packet)
+		if _, err = parsed.Parse(message); err != nil {
+			t.Fatalf("Parse() error = %v", err)
+		}
+		got := parsed.Records[0].Data[0].Data.(*PosData).Speed
+		if got != tt.want {
+			t.Errorf("speed %v after round trip = %v, want %v", tt.speed, got, tt.want)
+		}
+	}
+}
+
+func TestPosData_FlagsRoundTrip(t *testing.T) {
+	want := &PosData{Lat: -10, Lon: -20, Speed: 5, Lahs: 1, Lohs: 1, Mv: 1, RealTime: 1, Valid: 1}
+	packet := Packet{Type: EgtsPtAppdata, Records: []*Record{{ID: 1, Service: EgtsTeledataService,
+		Data: []*SubRecord{{Type: EgtsSrPosData, Data: want}}}}}
+	message, err := packet.Form()
+	if err != nil {
+		t.Fatalf("Form() error = %v", err)
+	}
+	parsed := new(Packet)
+	if _, err = parsed.Parse(message); err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	got := parsed.Records[0].Data[0].Data.(*PosData)
+	if got.Lahs != 1 || got.Lohs != 1 || got.Mv != 1 || got.RealTime != 1 || got.Valid != 1 {
+		t.Errorf("flags after round trip = %+v, want %+v", got, want)
+	}
+}
+
+func TestSubRecord_parseSrPosDataFlags(t *testing.T) {
+	tests := []struct {
+		name  string
+		flags byte
+		want  PosData
+	}{
+		{"valid", 0x01, PosData{Valid: 1}},
+		{"realTime", 0x08, PosData{RealTime: 1}},
+		{"moving", 0x10, PosData{Mv: 1}},
+		{"south", 0x20, PosData{Lahs: 1}},
+		{"west", 0x40, PosData{Lohs: 1}},
+		{"all", 0x79, PosData{Lahs: 1, Lohs: 1, Mv: 1, RealTime: 1, Valid: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buff := make([]byte, egtsSubrecDataLen)
+			buff[12] = tt.flags
+			var sub SubRecord
+			sub.parseSrPosData(buff, nil)
+			if got := sub.Data.(*PosData); *got != tt.want {
+				t.Errorf("parseSrPosData() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChange(t *testing.T) {
+	message := Change(wantNavData(), map[string]int{PacketID: 0x1234})
+	parsed := new(Packet)
+	if _, err := parsed.Parse(message); err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if parsed.ID != 0x1234 {
+		t.Errorf("packet ID = %d, want %d", parsed.ID, 0x1234)
+	}
 }
@@ -0,0 +1,225 @@
+package egts
+
+import (
+	"errors"
+
+	"github.com/egorban/navprot/pkg/general"
+)
+
+// ProtocolName is name of EGTS protocol in general registries
+const ProtocolName = "egts"
+
+func init() {
+	general.RegisterEncoder(ProtocolName, func(sub general.Subrecord) (interface{}, error) {
+		return FromGeneral(sub)
+	})
+	general.RegisterDecoder(ProtocolName, func() general.NavProtocol {
+		return new(Packet)
+	})
+}
+
+// ToGeneral form general subrecords from teledata records of EGTS packet
+func (packetData *Packet) ToGeneral() (subrecords []general.Subrecord, err error) {
+	if packetData.Type != EgtsPtAppdata {
+		err = errors.New("incorrect packet type")
+		return
+	}
+	for _, rec := range packetData.Records {
+		if rec.Service != EgtsTeledataService {
+			continue
+		}
+		for _, sub := range rec.Data {
+			var gen general.Subrecord
+			gen, err = sub.toGeneral()
+			if err != nil {
+				return nil, err
+			}
+			if gen != nil {
+				subrecords = append(subrecords, gen)
+			}
+		}
+	}
+	return
+}
+
+// FromGeneral creates EGTS subrecord from general subrecord.
+// general.ErrNotSupported is returned for types, which can't be represented in EGTS,
+// general.ErrTimeOutOfRange is returned for navigation data before 2010.
+func FromGeneral(sub general.Subrecord) (*SubRecord, error) {
+	switch data := sub.(type) {
+	case general.NavData:
+		return fromNavData(&data)
+	case *general.NavData:
+		return fromNavData(data)
+	case general.FuelData:
+		return fromFuelData(&data), nil
+	case *general.FuelData:
+		return fromFuelData(data), nil
+	case general.SensorData:
+		return fromSensorData(&data), nil
+	case *general.SensorData:
+		return fromSensorData(data), nil
+	case general.CounterData:
+		return fromCounterData(&data), nil
+	case *general.CounterData:
+		return fromCounterData(data), nil
+	}
+	return nil, general.ErrNotSupported
+}
+
+func (subData *SubRecord) toGeneral() (general.Subrecord, error) {
+	switch data := subData.Data.(type) {
+	case *PosData:
+		return data.toGeneral()
+	case *FuelData:
+		return data.toGeneral(), nil
+	case *SensorsData:
+		return data.toGeneral(), nil
+	case *CountersData:
+		return data.toGeneral(), nil
+	}
+	return nil, nil
+}
+
+// toGeneral returns general.ErrTimeOutOfRange for time after 2106, which can't be stored in general.NavData
+func (sub *PosData) toGeneral() (general.Subrecord, error) {
+	gen := &general.NavData{
+		Lon:      sub.Lon,
+		Lat:      sub.Lat,
+		Bearing:  sub.Bearing,
+		Speed:    sub.Speed,
+		RealTime: sub.RealTime == 1,
+		Valid:    sub.Valid == 1,
+		Sos:      sub.Source == SourceSos,
+		Source:   sub.Source,
+	}
+	if err := gen.SetTime(sub.GetTime()); err != nil {
+		return nil, err
+	}
+	return gen, nil
+}
+
+func (sub *FuelData) toGeneral() general.Subrecord {
+	return &general.FuelData{
+		Type: sub.Type,
+		Fuel: sub.Fuel,
+	}
+}
+
+func (sub *SensorsData) toGeneral() general.Subrecord {
+	gen := &general.SensorData{
+		Outputs: sub.DigitalOutputs,
+	}
+	for i := uint(0); i < 8; i++ {
+		if sub.DigitalInputsMask&(1<<i) != 0 {
+			if gen.Digital == nil {
+				gen.Digital = make(map[byte]byte)
+			}
+			gen.Digital[byte(i+1)] = sub.DigitalInputs[i]
+		}
+		if sub.AnalogSensorsMask&(1<<i) != 0 {
+			if gen.Analog == nil {
+				gen.Analog = make(map[byte]uint32)
+			}
+			gen.Analog[byte(i+1)] = sub.AnalogSensors[i]
+		}
+	}
+	return gen
+}
+
+func (sub *CountersData) toGeneral() general.Subrecord {
+	gen := new(general.CounterData)
+	for i := uint(0); i < 8; i++ {
+		if sub.CountersMask&(1<<i) != 0 {
+			if gen.Counters == nil {
+				gen.Counters = make(map[byte]uint32)
+			}
+			gen.Counters[byte(i+1)] = sub.Counters[i]
+		}
+	}
+	return gen
+}
+
+func fromNavData(data *general.NavData) (*SubRecord, error) {
+	nav := PosData{
+		Lon:     data.Lon,
+		Lat:     data.Lat,
+		Bearing: data.Bearing,
+		Speed:   data.Speed,
+		Source:  data.Source,
+	}
+	// source of alarm data can be mapped to other code, e.g. by convertation.Profile
+	if data.Sos && data.Source == 0 {
+		nav.Source = SourceSos
+	}
+	if data.Lat < 0 {
+		nav.Lahs = 1
+	}
+	if data.Lon < 0 {
+		nav.Lohs = 1
+	}
+	if data.Speed > 0 {
+		nav.Mv = 1
+	}
+	if data.RealTime {
+		nav.RealTime = 1
+	}
+	if data.Valid {
+		nav.Valid = 1
+	}
+	if err := nav.SetTime(data.GetTime()); err != nil {
+		return nil, err
+	}
+	return &SubRecord{
+		Type: EgtsSrPosData,
+		Data: &nav,
+	}, nil
+}
+
+func fromFuelData(data *general.FuelData) *SubRecord {
+	fuel := FuelData{
+		Type: data.Type,
+		Fuel: data.Fuel,
+	}
+	return &SubRecord{
+		Type: EgtsSrLiquidLevelSensor,
+		Data: &fuel,
+	}
+}
+
+// fromSensorData ignores numbers of digital octets and sensors out of range 1-8
+func fromSensorData(data *general.SensorData) *SubRecord {
+	sensors := SensorsData{
+		DigitalOutputs: data.Outputs,
+	}
+	for n, v := range data.Digital {
+		if n >= 1 && n <= 8 {
+			sensors.DigitalInputsMask |= 1 << (n - 1)
+			sensors.DigitalInputs[n-1] = v
+		}
+	}
+	for n, v := range data.Analog {
+		if n >= 1 && n <= 8 {
+			sensors.AnalogSensorsMask |= 1 << (n - 1)
+			sensors.AnalogSensors[n-1] = v
+		}
+	}
+	return &SubRecord{
+		Type: EgtsSrAdSensorsData,
+		Data: &sensors,
+	}
+}
+
+func fromCounterData(data *general.CounterData) *SubRecord {
+	counters := CountersData{}
+	for n, v := range data.Counters {
+		if n >= 1 && n <= 8 {
+			counters.CountersMask |= 1 << (n - 1)
+			counters.Counters[n-1] = v
+		}
+	}
+	return &SubRecord{
+		Type: EgtsSrCountersData,
+		Data: &counters,
+	}
+}
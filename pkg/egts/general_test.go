@@ -0,0 +1,174 @@
+package egts
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/egorban/navprot/pkg/general"
+)
+
+func TestFromGeneral(t *testing.T) {
+	tests := []struct {
+		name    string
+		sub     general.Subrecord
+		want    *SubRecord
+		wantErr bool
+	}{
+		{name: "navData", sub: general.NavData{
+			Time:     1522961700,
+			Lon:      37.6925783,
+			Lat:      55.7890249,
+			Bearing:  339,
+			RealTime: true,
+			Valid:    true,
+			Source:   13,
+		}, want: egtsExpected()},
+		{name: "navDataSpeed", sub: &general.NavData{Time: Timestamp20100101utc, Lon: -1, Lat: -2, Speed: 60},
+			want: &SubRecord{Type: EgtsSrPosData, Data: &PosData{Lon: -1, Lat: -2, Lohs: 1, Lahs: 1, Speed: 60, Mv: 1}}},
+		{name: "navDataSos", sub: &general.NavData{Time: Timestamp20100101utc, Sos: true},
+			want: &SubRecord{Type: EgtsSrPosData, Data: &PosData{Source: SourceSos}}},
+		{name: "navDataSosSource", sub: &general.NavData{Time: Timestamp20100101utc, Sos: true, Source: 20},
+			want: &SubRecord{Type: EgtsSrPosData, Data: &PosData{Source: 20}}},
+		{name: "fuelData", sub: &general.FuelData{Type: 2, Fuel: 150},
+			want: &SubRecord{Type: EgtsSrLiquidLevelSensor, Data: &FuelData{Type: 2, Fuel: 150}}},
+		{name: "navDataBefore2010", sub: &general.NavData{Time: Timestamp20100101utc - 1}, wantErr: true},
+		{name: "nil", sub: nil, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FromGeneral(tt.sub)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("FromGeneral() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FromGeneral() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPacket_ToGeneral(t *testing.T) {
+	tests := []struct {
+		name    string
+		packet  *Packet
+		want    []general.Subrecord
+		wantErr bool
+	}{
+		{name: "posAndFuelData", packet: egtsPosAndFuelData(), want: []general.Subrecord{
+			&general.NavData{
+				Time:    1533570258,
+				Lon:     37.782409656276556,
+				Lat:     55.62752532903746,
+				Bearing: 178,
+				Valid:   true,
+			},
+			&general.FuelData{Type: 2, Fuel: 2},
+		}},
+		{name: "response", packet: egtsRes(), wantErr: true},
+		{name: "timeAfter2106", packet: &Packet{Type: EgtsPtAppdata, Records: []*Record{{Service: EgtsTeledataService,
+			Data: []*SubRecord{{Type: EgtsSrPosData, Data: &PosData{Time: 0xFFFFFFFF}}}}}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.packet.ToGeneral()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ToGeneral() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ToGeneral() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func egtsExpected() *SubRecord {
+	posData := PosData{
+		Time:     260657700,
+		Lon:      37.6925783,
+		Lat:      55.7890249,
+		Bearing:  339,
+		RealTime: 1,
+		Valid:    1,
+		Source:   13,
+	}
+	return &SubRecord{
+		Type: EgtsSrPosData,
+		Data: &posData,
+	}
+}
+
+var _ general.NavProtocol = (*Packet)(nil)
+
+func TestSensorsAndCounters(t *testing.T) {
+	gen := []general.Subrecord{
+		&general.SensorData{
+			Digital: map[byte]byte{1: 0x81, 3: 0x02},
+			Outputs: 0x10,
+			Analog:  map[byte]uint32{2: 0x123456, 8: 7},
+		},
+		&general.CounterData{Counters: map[byte]uint32{1: 100, 5: 0xFFFFFF}},
+	}
+	subrecords := make([]*SubRecord, 0, len(gen))
+	for _, sub := range gen {
+		egtsSub, err := FromGeneral(sub)
+		if err != nil {
+			t.Fatalf("FromGeneral() error = %v", err)
+		}
+		subrecords = append(subrecords, egtsSub)
+	}
+	packet := &Packet{Type: EgtsPtAppdata, Records: []*Record{{
+		RecNum:  1,
+		ID:      239,
+		Service: EgtsTeledataService,
+		Data:    subrecords,
+	}}}
+	message, err := packet.Form()
+	if err != nil {
+		t.Fatalf("Form() error = %v", err)
+	}
+	parsed := new(Packet)
+	if _, err = parsed.Parse(message); err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	got, err := parsed.ToGeneral()
+	if err != nil {
+		t.Fatalf("ToGeneral() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, gen) {
+		t.Errorf("ToGeneral() = %v, want %v", got, gen)
+	}
+}
+
+func TestTimeAccessors(t *testing.T) {
+	at := time.Date(2018, 4, 5, 20, 55, 0, 0, time.UTC)
+	var pos PosData
+	if err := pos.SetTime(at); err != nil || pos.Time != 260657700 || !pos.GetTime().Equal(at) {
+		t.Errorf("PosData time = %d, %v, error = %v", pos.Time, pos.GetTime(), err)
+	}
+	if err := pos.SetTime(Epoch.Add(-time.Second)); err != general.ErrTimeOutOfRange {
+		t.Errorf("PosData.SetTime() error = %v, want %v", err, general.ErrTimeOutOfRange)
+	}
+	var rec Record
+	if !rec.GetTime().IsZero() {
+		t.Errorf("Record.GetTime() = %v, want zero time", rec.GetTime())
+	}
+	if err := rec.SetTime(at); err != nil || rec.Time != 260657700 || !rec.HasTime {
+		t.Errorf("Record.Time = %d, HasTime = %t, error = %v", rec.Time, rec.HasTime, err)
+	}
+	// time of EGTS epoch is not confused with absent time
+	if err := rec.SetTime(Epoch); err != nil || rec.Time != 0 || !rec.GetTime().Equal(Epoch) {
+		t.Errorf("Record.GetTime() = %v, error = %v, want %v", rec.GetTime(), err, Epoch)
+	}
+	if err := rec.SetTime(time.Time{}); err != nil || rec.Time != 0 || rec.HasTime {
+		t.Errorf("Record.Time = %d, HasTime = %t, error = %v", rec.Time, rec.HasTime, err)
+	}
+	nav := general.NavData{Time: 1522961700}
+	if !nav.GetTime().Equal(at) {
+		t.Errorf("NavData.GetTime() = %v, want %v", nav.GetTime(), at)
+	}
+	if err := nav.SetTime(time.Unix(math.MaxUint32+1, 0)); err != general.ErrTimeOutOfRange {
+		t.Errorf("NavData.SetTime() error = %v, want %v", err, general.ErrTimeOutOfRange)
+	}
+}
@@ -14,13 +14,13 @@ func (packetData *Packet) parseHeader(message []byte) (body, restBuf []byte, err
 	}
 	messageLen := len(message) - index
 	if messageLen < minEgtsHeaderLen {
-		restBuf = append([]byte(nil), message...)
+		restBuf = message
 		err = errors.New("message is too short")
 		return
 	}
 	headerLen := int(message[index+3])
 	if messageLen < headerLen {
-		restBuf = append([]byte(nil), message...)
+		restBuf = message
 		err = errors.New("message is too short")
 		return
 	}
@@ -38,7 +38,7 @@ func (packetData *Packet) parseHeader(message []byte) (body, restBuf []byte, err
 	startBody := index + headerLen
 	bodyLen := int(binary.LittleEndian.Uint16(header[5:7]))
 	if len(message[startBody:]) < bodyLen+2 {
-		restBuf = append([]byte(nil), message...)
+		restBuf = message
 		err = errors.New("message is too short")
 		return
 	}
@@ -51,6 +51,8 @@ func (packetData *Packet) parseHeader(message []byte) (body, restBuf []byte, err
 	}
 	packetData.Type = message[index+9]
 	packetData.ID = binary.LittleEndian.Uint16(message[index+7 : index+9])
-	restBuf = append([]byte(nil), message[index+headerLen+bodyLen+2:]...)
+	if end := index + headerLen + bodyLen + 2; end < len(message) {
+		restBuf = message[end:]
+	}
 	return
 }
@@ -0,0 +1,146 @@
+package egts
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Discriminators of Packet.Data and SubRecord.Data in JSON
+const (
+	jsonDataResponse          = "response"
+	jsonDataRecordResponse    = "record_response"
+	jsonDataPosData           = "pos_data"
+	jsonDataLiquidLevelSensor = "liquid_level_sensor"
+	jsonDataAdSensorsData     = "ad_sensors_data"
+	jsonDataCountersData      = "counters_data"
+	jsonDataTermIdentity      = "term_identity"
+	jsonDataResultCode        = "result_code"
+)
+
+type packetJSON struct {
+	Type     byte            `json:"type"`
+	ID       uint16          `json:"id"`
+	Records  []*Record       `json:"records"`
+	DataType string          `json:"data_type,omitempty"`
+	Data     json.RawMessage `json:"data,omitempty"`
+}
+
+type subRecordJSON struct {
+	Type     byte            `json:"type"`
+	DataType string          `json:"data_type,omitempty"`
+	Data     json.RawMessage `json:"data,omitempty"`
+}
+
+// MarshalJSON encodes packet with type of Data in data_type field, it's "response" for *Response
+func (packetData *Packet) MarshalJSON() ([]byte, error) {
+	v := packetJSON{
+		Type:    packetData.Type,
+		ID:      packetData.ID,
+		Records: packetData.Records,
+	}
+	switch data := packetData.Data.(type) {
+	case nil:
+	case *Response:
+		v.DataType = jsonDataResponse
+		var err error
+		if v.Data, err = json.Marshal(data); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported packet data type %T", packetData.Data)
+	}
+	return json.Marshal(v)
+}
+
+// UnmarshalJSON decodes packet encoded by MarshalJSON
+func (packetData *Packet) UnmarshalJSON(b []byte) error {
+	var v packetJSON
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	packetData.Reset()
+	packetData.Type = v.Type
+	packetData.ID = v.ID
+	packetData.Records = v.Records
+	switch v.DataType {
+	case "":
+	case jsonDataResponse:
+		resp := new(Response)
+		if err := json.Unmarshal(v.Data, resp); err != nil {
+			return err
+		}
+		packetData.Data = resp
+	default:
+		return fmt.Errorf("unknown packet data type %q", v.DataType)
+	}
+	return nil
+}
+
+// MarshalJSON encodes subrecord with type of Data in data_type field:
+// "record_response", "pos_data", "liquid_level_sensor", "ad_sensors_data", "counters_data",
+// "term_identity" or "result_code".
+func (subData *SubRecord) MarshalJSON() ([]byte, error) {
+	v := subRecordJSON{Type: subData.Type}
+	switch subData.Data.(type) {
+	case nil:
+	case *Confirmation:
+		v.DataType = jsonDataRecordResponse
+	case *PosData:
+		v.DataType = jsonDataPosData
+	case *FuelData:
+		v.DataType = jsonDataLiquidLevelSensor
+	case *SensorsData:
+		v.DataType = jsonDataAdSensorsData
+	case *CountersData:
+		v.DataType = jsonDataCountersData
+	case *TermIdentity:
+		v.DataType = jsonDataTermIdentity
+	case *ResultCode:
+		v.DataType = jsonDataResultCode
+	default:
+		return nil, fmt.Errorf("unsupported subrecord data type %T", subData.Data)
+	}
+	if subData.Data != nil {
+		var err error
+		if v.Data, err = json.Marshal(subData.Data); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(v)
+}
+
+// UnmarshalJSON decodes subrecord encoded by MarshalJSON
+func (subData *SubRecord) UnmarshalJSON(b []byte) error {
+	var v subRecordJSON
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	subData.Type = v.Type
+	subData.Data = nil
+	var data interface{}
+	switch v.DataType {
+	case "":
+		return nil
+	case jsonDataRecordResponse:
+		data = new(Confirmation)
+	case jsonDataPosData:
+		data = new(PosData)
+	case jsonDataLiquidLevelSensor:
+		data = new(FuelData)
+	case jsonDataAdSensorsData:
+		data = new(SensorsData)
+	case jsonDataCountersData:
+		data = new(CountersData)
+	case jsonDataTermIdentity:
+		data = new(TermIdentity)
+	case jsonDataResultCode:
+		data = new(ResultCode)
+	default:
+		return fmt.Errorf("unknown subrecord data type %q", v.DataType)
+	}
+	if err := json.Unmarshal(v.Data, data); err != nil {
+		return err
+	}
+	subData.Data = data
+	return nil
+}
@@ -0,0 +1,76 @@
+package egts
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestPacket_JSON(t *testing.T) {
+	tests := []struct {
+		name       string
+		packetData *Packet
+		want       []byte
+	}{
+		{"response", responsePacket(), wantResponseData()},
+		{"navData", navPacket(), wantNavData()},
+		{"fuelData", fuelPacket(), wantFuelData()},
+		{"navAndFuelData", navAndFuelPacket(), wantNavAndFuelData()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := json.Marshal(tt.packetData)
+			if err != nil {
+				t.Fatalf("Marshal() error = %v", err)
+			}
+			var got Packet
+			if err = json.Unmarshal(b, &got); err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+			if !reflect.DeepEqual(got.Data, tt.packetData.Data) {
+				t.Errorf("Unmarshal() Data = %v, want %v", got.Data, tt.packetData.Data)
+			}
+			message, err := got.Form()
+			if err != nil {
+				t.Fatalf("Form() error = %v", err)
+			}
+			if !reflect.DeepEqual(message, tt.want) {
+				t.Errorf("Form() = %v, want %v", message, tt.want)
+			}
+		})
+	}
+}
+
+func TestSubRecord_JSON(t *testing.T) {
+	subs := []*SubRecord{
+		{Type: EgtsSrResponse, Data: &Confirmation{CRN: 1, RST: Success}},
+		{Type: EgtsSrPosData, Data: &PosData{Time: 260657700, Lon: 37.6925783, Lat: 55.7890249, Speed: 12.3, Mv: 1}},
+		{Type: EgtsSrLiquidLevelSensor, Data: &FuelData{Type: 2, Fuel: 30, Number: 1, Address: 3}},
+		{Type: EgtsSrAdSensorsData, Data: &SensorsData{DigitalInputsMask: 1, DigitalInputs: [8]byte{0x81}}},
+		{Type: EgtsSrCountersData, Data: &CountersData{CountersMask: 2, Counters: [8]uint32{0, 100}}},
+		{Type: EgtsSrTermIdentity, Data: &TermIdentity{TID: 1024, IMEI: "123456789012345"}},
+		{Type: EgtsSrResultCode, Data: &ResultCode{RCD: EgtsPcAuthDenied}},
+	}
+	b, err := json.Marshal(subs)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	var got []*SubRecord
+	if err = json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, subs) {
+		t.Errorf("Unmarshal() = %v, want %v", got, subs)
+	}
+	b, err = json.Marshal(subs[2])
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	want := `{"type":27,"data_type":"liquid_level_sensor","data":{"type":2,"fuel":30,"number":1,"address":3}}`
+	if string(b) != want {
+		t.Errorf("Marshal() = %s, want %s", b, want)
+	}
+	if err = json.Unmarshal([]byte(`{"type":16,"data_type":"photo","data":{}}`), new(SubRecord)); err == nil {
+		t.Error("Unmarshal() of unknown data type succeeded")
+	}
+}
@@ -2,21 +2,50 @@ package egts
 
 import (
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"time"
+
+	"github.com/egorban/navprot/pkg/general"
 )
 
 // Record describes record of EGTS_PT_SIGNED_APPDATA packet
 type Record struct {
 	// Record Data
-	Data []*SubRecord
+	Data []*SubRecord `json:"subrecords"`
 	// Object Identifier
-	ID uint32
+	ID uint32 `json:"id"`
+	// Time of record formation, seconds since 2010-01-01 00:00:00 UTC (optional, formed if HasTime is set)
+	Time uint32 `json:"time"`
+	// HasTime is TMFE flag, it's set if record contains time
+	HasTime bool `json:"has_time"`
 	// Record Number
-	RecNum uint16
+	RecNum uint16 `json:"rec_num"`
 	// Source Service Type
-	Service byte
+	Service byte `json:"service"`
 	//Binary record
-	RecBin []byte
+	RecBin []byte `json:"-"`
+}
+
+// GetTime returns time of record formation in UTC, zero time is returned if record has no time
+func (recData *Record) GetTime() time.Time {
+	if !recData.HasTime {
+		return time.Time{}
+	}
+	return general.FromSeconds(Epoch, recData.Time)
+}
+
+// SetTime sets time of record formation, zero t removes time from record.
+// general.ErrTimeOutOfRange is returned, if t is before 2010 or after 2146.
+func (recData *Record) SetTime(t time.Time) (err error) {
+	if t.IsZero() {
+		recData.Time, recData.HasTime = 0, false
+		return
+	}
+	if recData.Time, err = general.Seconds(Epoch, t); err == nil {
+		recData.HasTime = true
+	}
+	return
 }
 
 func (recData *Record) form() (record []byte, err error) {
@@ -29,7 +58,13 @@ func (recData *Record) form() (record []byte, err error) {
 	binary.LittleEndian.PutUint16(headerRec[2:4], recData.RecNum)
 	headerRec[4] = 0x01
 	binary.LittleEndian.PutUint32(headerRec[5:9], recData.ID)
-	headerRec = append(headerRec[:9], recData.Service, recData.Service)
+	headerRec = headerRec[:9]
+	if recData.HasTime {
+		headerRec[4] |= 0x04
+		headerRec = append(headerRec, 0, 0, 0, 0)
+		binary.LittleEndian.PutUint32(headerRec[9:13], recData.Time)
+	}
+	headerRec = append(headerRec, recData.Service, recData.Service)
 	record = append(headerRec, subrec...)
 	return record, nil
 }
@@ -48,32 +83,49 @@ func (recData *Record) formResponse() (record []byte, err error) {
 	return record, nil
 }
 
-func (recData *Record) parseRecord(body []byte) []byte {
+func (recData *Record) parseRecord(body []byte, st *storage) ([]byte, error) {
+	if len(body) < 7 {
+		return nil, errors.New("record header is too short")
+	}
 	dataLen := binary.LittleEndian.Uint16(body[:2])
 	recData.RecNum = binary.LittleEndian.Uint16(body[2:4])
 	tmfe := body[4] >> 2 & 1
 	evfe := body[4] >> 1 & 1
 	obfe := body[4] & 1
-	if obfe != 0 {
-		recData.ID = binary.LittleEndian.Uint32(body[5:9])
-	}
 	optLen := (tmfe + evfe + obfe) * 4
 	headerLen := 7 + int(optLen)
 	recordLen := headerLen + int(dataLen)
+	if len(body) < recordLen {
+		return nil, errors.New("record is too short")
+	}
+	if obfe != 0 {
+		recData.ID = binary.LittleEndian.Uint32(body[5:9])
+	}
+	if tmfe != 0 {
+		timeStart := 5 + (obfe+evfe)*4
+		recData.Time = binary.LittleEndian.Uint32(body[timeStart : timeStart+4])
+		recData.HasTime = true
+	}
 	recData.Service = body[5+optLen]
 	sub := body[headerLen:recordLen]
-	recData.parseSubRecords(sub)
 	recData.RecBin = body[:recordLen]
-	return body[recordLen:]
+	if st == nil {
+		recData.RecBin = append([]byte(nil), recData.RecBin...)
+	}
+	return body[recordLen:], recData.parseSubRecords(sub, st)
 }
 
-func (recData *Record) parseSubRecords(buff []byte) {
+func (recData *Record) parseSubRecords(buff []byte, st *storage) (err error) {
 	restBuff := buff
 	for len(restBuff) > 0 {
-		sub := new(SubRecord)
-		restBuff = sub.parse(recData.Service, restBuff)
-		recData.Data = append(recData.Data, sub)
+		sub := st.newSubRecord()
+		restBuff, err = sub.parse(recData.Service, restBuff, st)
+		if err != nil {
+			return
+		}
+		recData.Data = st.appendSubRecord(recData.Data, sub)
 	}
+	return
 }
 
 func (recData *Record) formSubrecords() ([]byte, error) {
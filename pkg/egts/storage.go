@@ -0,0 +1,161 @@
+package egts
+
+// storage keeps memory of parsed packet for reuse by Packet.ParseInto.
+// Methods of nil storage allocate new objects.
+type storage struct {
+	response Response
+	records  []*Record
+	recs     []Record
+	subs     []SubRecord
+	subPtrs  []*SubRecord
+	pos      []PosData
+	fuel     []FuelData
+	conf     []Confirmation
+	sensors  []SensorsData
+	counters []CountersData
+}
+
+func (st *storage) reset() {
+	st.records = st.records[:0]
+	st.recs = st.recs[:0]
+	st.subs = st.subs[:0]
+	st.subPtrs = st.subPtrs[:0]
+	st.pos = st.pos[:0]
+	st.fuel = st.fuel[:0]
+	st.conf = st.conf[:0]
+	st.sensors = st.sensors[:0]
+	st.counters = st.counters[:0]
+}
+
+func (st *storage) newResponse() *Response {
+	if st == nil {
+		return new(Response)
+	}
+	st.response = Response{}
+	return &st.response
+}
+
+func (st *storage) newRecords() []*Record {
+	if st == nil {
+		return make([]*Record, 0, 1)
+	}
+	return st.records[:0]
+}
+
+func (st *storage) setRecords(records []*Record) {
+	if st != nil {
+		st.records = records
+	}
+}
+
+// Slices of objects are not copied on growth, so pointers returned earlier stay valid.
+func (st *storage) newRecord() *Record {
+	if st == nil {
+		return new(Record)
+	}
+	if len(st.recs) == cap(st.recs) {
+		st.recs = make([]Record, 0, 2*cap(st.recs)+1)
+	}
+	st.recs = st.recs[:len(st.recs)+1]
+	rec := &st.recs[len(st.recs)-1]
+	*rec = Record{}
+	return rec
+}
+
+func (st *storage) newSubRecord() *SubRecord {
+	if st == nil {
+		return new(SubRecord)
+	}
+	if len(st.subs) == cap(st.subs) {
+		st.subs = make([]SubRecord, 0, 2*cap(st.subs)+1)
+	}
+	st.subs = st.subs[:len(st.subs)+1]
+	sub := &st.subs[len(st.subs)-1]
+	*sub = SubRecord{}
+	return sub
+}
+
+// appendSubRecord appends sub to subrecords of record. Subrecords of all records
+// share one array, subrecords of the last record are moved on growth.
+func (st *storage) appendSubRecord(subs []*SubRecord, sub *SubRecord) []*SubRecord {
+	if st == nil {
+		return append(subs, sub)
+	}
+	if len(subs) == 0 {
+		if len(st.subPtrs) == cap(st.subPtrs) {
+			st.subPtrs = make([]*SubRecord, 0, 2*cap(st.subPtrs)+1)
+		}
+	} else if len(st.subPtrs) == cap(st.subPtrs) {
+		subPtrs := make([]*SubRecord, len(subs), 2*cap(st.subPtrs)+1)
+		copy(subPtrs, subs)
+		st.subPtrs = subPtrs
+	}
+	st.subPtrs = append(st.subPtrs, sub)
+	start := len(st.subPtrs) - len(subs) - 1
+	return st.subPtrs[start:len(st.subPtrs):len(st.subPtrs)]
+}
+
+func (st *storage) newPosData() *PosData {
+	if st == nil {
+		return new(PosData)
+	}
+	if len(st.pos) == cap(st.pos) {
+		st.pos = make([]PosData, 0, 2*cap(st.pos)+1)
+	}
+	st.pos = st.pos[:len(st.pos)+1]
+	data := &st.pos[len(st.pos)-1]
+	*data = PosData{}
+	return data
+}
+
+func (st *storage) newFuelData() *FuelData {
+	if st == nil {
+		return new(FuelData)
+	}
+	if len(st.fuel) == cap(st.fuel) {
+		st.fuel = make([]FuelData, 0, 2*cap(st.fuel)+1)
+	}
+	st.fuel = st.fuel[:len(st.fuel)+1]
+	data := &st.fuel[len(st.fuel)-1]
+	*data = FuelData{}
+	return data
+}
+
+func (st *storage) newConfirmation() *Confirmation {
+	if st == nil {
+		return new(Confirmation)
+	}
+	if len(st.conf) == cap(st.conf) {
+		st.conf = make([]Confirmation, 0, 2*cap(st.conf)+1)
+	}
+	st.conf = st.conf[:len(st.conf)+1]
+	data := &st.conf[len(st.conf)-1]
+	*data = Confirmation{}
+	return data
+}
+
+func (st *storage) newSensorsData() *SensorsData {
+	if st == nil {
+		return new(SensorsData)
+	}
+	if len(st.sensors) == cap(st.sensors) {
+		st.sensors = make([]SensorsData, 0, 2*cap(st.sensors)+1)
+	}
+	st.sensors = st.sensors[:len(st.sensors)+1]
+	data := &st.sensors[len(st.sensors)-1]
+	*data = SensorsData{}
+	return data
+}
+
+func (st *storage) newCountersData() *CountersData {
+	if st == nil {
+		return new(CountersData)
+	}
+	if len(st.counters) == cap(st.counters) {
+		st.counters = make([]CountersData, 0, 2*cap(st.counters)+1)
+	}
+	st.counters = st.counters[:len(st.counters)+1]
+	data := &st.counters[len(st.counters)-1]
+	*data = CountersData{}
+	return data
+}
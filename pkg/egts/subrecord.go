@@ -2,8 +2,22 @@ package egts
 
 import (
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"math"
+	"time"
+
+	"github.com/egorban/navprot/pkg/general"
+)
+
+const (
+	// latScale and lonScale are EGTS coordinate units in degrees
+	latScale = 90.0 / 0xffffffff
+	lonScale = 180.0 / 0xffffffff
+	// speedScale is a number of EGTS speed units (0.1 km/h) in km/h
+	speedScale = 10
+	// maxSpeed is max speed in EGTS units, speed is stored in 14 bits
+	maxSpeed = 0x3FFF
 )
 
 // SubRecord describes subrecord of EGTS_PT_SIGNED_APPDATA packet
@@ -17,75 +31,139 @@ type SubRecord struct {
 // Confirmation describes confirmation subrecord
 type Confirmation struct {
 	// Confirmed Record Number
-	CRN uint16
+	CRN uint16 `json:"crn"`
 	// Record Status
-	RST byte
+	RST byte `json:"rst"`
 }
 
 // PosData describes EGTS_SR_POS_DATA subrecord
 type PosData struct {
-	Lon      float64
-	Lat      float64
-	Time     uint32
-	Bearing  uint16
-	Speed    uint16
-	Lohs     byte
-	Lahs     byte
-	Mv       byte
-	RealTime byte
-	Valid    byte
-	Source   byte
+	Lon     general.Degrees `json:"lon"`
+	Lat     general.Degrees `json:"lat"`
+	Time    uint32          `json:"time"`
+	Bearing uint16          `json:"bearing"`
+	// Speed is transmitted with 0.1 km/h resolution, it's limited to range 0-1638.3 km/h when formed
+	Speed    general.KmH `json:"speed"`
+	Lohs     byte        `json:"lohs"`
+	Lahs     byte        `json:"lahs"`
+	Mv       byte        `json:"mv"`
+	RealTime byte        `json:"real_time"`
+	Valid    byte        `json:"valid"`
+	Source   byte        `json:"source"`
+}
+
+// GetTime returns navigation time in UTC
+func (data *PosData) GetTime() time.Time {
+	return general.FromSeconds(Epoch, data.Time)
+}
+
+// SetTime sets navigation time. general.ErrTimeOutOfRange is returned, if t is before 2010 or after 2146.
+func (data *PosData) SetTime(t time.Time) (err error) {
+	data.Time, err = general.Seconds(Epoch, t)
+	return
 }
 
 // FuelData contains information about fuel level
 type FuelData struct {
-	Type byte
-	Fuel uint32
+	Type byte   `json:"type"`
+	Fuel uint32 `json:"fuel"`
+	// Liquid Level Sensor Number (LLSN), 2 is formed if zero
+	Number byte `json:"number"`
+	// Module Address (MADDR), 1 is formed if zero
+	Address uint16 `json:"address"`
+}
+
+// SensorsData describes EGTS_SR_AD_SENSORS_DATA subrecord
+type SensorsData struct {
+	// DigitalInputsMask defines which octets of DigitalInputs are present (DIOE)
+	DigitalInputsMask byte `json:"digital_inputs_mask"`
+	// States of digital inputs, bit per input (ADIO1-ADIO8)
+	DigitalInputs [8]byte `json:"digital_inputs"`
+	// States of digital outputs, bit per output (DOUT)
+	DigitalOutputs byte `json:"digital_outputs"`
+	// AnalogSensorsMask defines which AnalogSensors are present (ASFE)
+	AnalogSensorsMask byte `json:"analog_sensors_mask"`
+	// Values of analog sensors, 3 bytes each (ANS1-ANS8)
+	AnalogSensors [8]uint32 `json:"analog_sensors"`
 }
 
-func (subData *SubRecord) parse(service byte, buff []byte) []byte {
+// CountersData describes EGTS_SR_COUNTERS_DATA subrecord
+type CountersData struct {
+	// CountersMask defines which Counters are present (CFE)
+	CountersMask byte `json:"counters_mask"`
+	// Values of counters, 3 bytes each (CN1-CN8)
+	Counters [8]uint32 `json:"counters"`
+}
+
+func (subData *SubRecord) parse(service byte, buff []byte, st *storage) ([]byte, error) {
+	if len(buff) < 3 {
+		return nil, errors.New("subrecord header is too short")
+	}
 	subData.Type = buff[0]
 	srl := binary.LittleEndian.Uint16(buff[1:3])
-	subEnd := 3 + srl
-	if subData.Type == EgtsPtResponse {
-		subData.parseResponce(buff[3:subEnd])
+	subEnd := 3 + int(srl)
+	if len(buff) < subEnd {
+		return nil, errors.New("subrecord is too short")
 	}
-	if service == EgtsTeledataService {
-		subData.parseTeledataService(buff[3:subEnd])
+	var err error
+	if subData.Type == EgtsPtResponse {
+		err = subData.parseResponce(buff[3:subEnd], st)
+	} else if service == EgtsTeledataService {
+		err = subData.parseTeledataService(buff[3:subEnd], st)
+	} else if service == EgtsAuthService {
+		err = subData.parseAuthService(buff[3:subEnd])
 	}
-	return buff[subEnd:]
+	return buff[subEnd:], err
 }
 
-func (subData *SubRecord) parseResponce(buff []byte) {
-	conf := new(Confirmation)
+func (subData *SubRecord) parseResponce(buff []byte, st *storage) error {
+	if len(buff) < 3 {
+		return errors.New("EGTS_SR_RECORD_RESPONSE is too short")
+	}
+	conf := st.newConfirmation()
 	conf.CRN = binary.LittleEndian.Uint16(buff[:2])
 	conf.RST = buff[2]
 	subData.Data = conf
+	return nil
 }
 
-func (subData *SubRecord) parseTeledataService(buff []byte) {
+func (subData *SubRecord) parseTeledataService(buff []byte, st *storage) error {
 	switch subData.Type {
 	case EgtsSrPosData:
-		subData.parseSrPosData(buff)
+		if len(buff) < egtsSubrecDataLen {
+			return errors.New("EGTS_SR_POS_DATA is too short")
+		}
+		subData.parseSrPosData(buff, st)
 	case EgtsSrLiquidLevelSensor:
-		subData.parseSrLiquidLevelSensor(buff)
+		if len(buff) < egtsSubrecFuelDataLen {
+			return errors.New("EGTS_SR_LIQUID_LEVEL_SENSOR is too short")
+		}
+		subData.parseSrLiquidLevelSensor(buff, st)
+	case EgtsSrAdSensorsData:
+		return subData.parseSrAdSensorsData(buff, st)
+	case EgtsSrCountersData:
+		return subData.parseSrCountersData(buff, st)
 	}
-	//todo handle errors
+	return nil
 }
 
-func (subData *SubRecord) parseSrPosData(buff []byte) {
-	data := new(PosData)
+// parseSrPosData keeps flags LAHS, LOHS, MV and BB (RealTime), so parsed PosData is formed back unchanged.
+func (subData *SubRecord) parseSrPosData(buff []byte, st *storage) {
+	data := st.newPosData()
 	lahs := buff[12] >> 5 & 1
 	lohs := buff[12] >> 6 & 1
+	data.Lahs, data.Lohs = lahs, lohs
+	data.Mv = buff[12] >> 4 & 1
+	data.RealTime = buff[12] >> 3 & 1
 	if buff[12]&1 != 0 {
 		data.Valid = 1
 	}
 	data.Time = binary.LittleEndian.Uint32(buff[:4])
-	data.Lat = float64(binary.LittleEndian.Uint32(buff[4:8])) * 90 / 0xffffffff * (1 - 2*float64(lahs))
-	data.Lon = float64(binary.LittleEndian.Uint32(buff[8:12])) * 180 / 0xffffffff * (1 - 2*float64(lohs))
+	data.Lat = general.Degrees(float64(binary.LittleEndian.Uint32(buff[4:8])) * latScale * (1 - 2*float64(lahs)))
+	data.Lon = general.Degrees(float64(binary.LittleEndian.Uint32(buff[8:12])) * lonScale * (1 - 2*float64(lohs)))
 	spdHi := buff[14] & 63
 	spdLo := buff[13]
-	data.Speed = uint16(spdHi)*256 + uint16(spdLo)
+	data.Speed = general.KmH(uint16(spdHi)*256+uint16(spdLo)) / speedScale
 	dirHi := buff[14] >> 7
 	dirLo := buff[15]
 	data.Bearing = uint16(dirHi)*256 + uint16(dirLo)
@@ -93,8 +171,10 @@ func (subData *SubRecord) parseSrPosData(buff []byte) {
 	subData.Data = data
 }
 
-func (subData *SubRecord) parseSrLiquidLevelSensor(buff []byte) {
-	data := new(FuelData)
+func (subData *SubRecord) parseSrLiquidLevelSensor(buff []byte, st *storage) {
+	data := st.newFuelData()
+	data.Number = buff[0] & 7
+	data.Address = binary.LittleEndian.Uint16(buff[1:3])
 	rdf := buff[0] >> 3 & 1
 	if rdf == 0 {
 		llsef := buff[0] >> 6 & 1
@@ -115,6 +195,60 @@ func (subData *SubRecord) parseSrLiquidLevelSensor(buff []byte) {
 	}
 }
 
+func (subData *SubRecord) parseSrAdSensorsData(buff []byte, st *storage) error {
+	if len(buff) < 3 {
+		return errors.New("EGTS_SR_AD_SENSORS_DATA is too short")
+	}
+	data := st.newSensorsData()
+	data.DigitalInputsMask = buff[0]
+	data.DigitalOutputs = buff[1]
+	data.AnalogSensorsMask = buff[2]
+	pos := 3
+	for i := uint(0); i < 8; i++ {
+		if data.DigitalInputsMask&(1<<i) == 0 {
+			continue
+		}
+		if len(buff) < pos+1 {
+			return errors.New("EGTS_SR_AD_SENSORS_DATA is too short")
+		}
+		data.DigitalInputs[i] = buff[pos]
+		pos++
+	}
+	for i := uint(0); i < 8; i++ {
+		if data.AnalogSensorsMask&(1<<i) == 0 {
+			continue
+		}
+		if len(buff) < pos+3 {
+			return errors.New("EGTS_SR_AD_SENSORS_DATA is too short")
+		}
+		data.AnalogSensors[i] = uint24(buff[pos:])
+		pos += 3
+	}
+	subData.Data = data
+	return nil
+}
+
+func (subData *SubRecord) parseSrCountersData(buff []byte, st *storage) error {
+	if len(buff) < 1 {
+		return errors.New("EGTS_SR_COUNTERS_DATA is too short")
+	}
+	data := st.newCountersData()
+	data.CountersMask = buff[0]
+	pos := 1
+	for i := uint(0); i < 8; i++ {
+		if data.CountersMask&(1<<i) == 0 {
+			continue
+		}
+		if len(buff) < pos+3 {
+			return errors.New("EGTS_SR_COUNTERS_DATA is too short")
+		}
+		data.Counters[i] = uint24(buff[pos:])
+		pos += 3
+	}
+	subData.Data = data
+	return nil
+}
+
 func (subData *SubRecord) form(service byte) (sub []byte, err error) {
 	switch t := subData.Data.(type) {
 	case *PosData:
@@ -123,6 +257,14 @@ func (subData *SubRecord) form(service byte) (sub []byte, err error) {
 		sub = subData.formResponce()
 	case *FuelData:
 		sub = subData.formSrLiquidLevelSensor()
+	case *SensorsData:
+		sub = subData.formSrAdSensorsData()
+	case *CountersData:
+		sub = subData.formSrCountersData()
+	case *TermIdentity:
+		sub = subData.formTermIdentity()
+	case *ResultCode:
+		sub = subData.formResultCode()
 	default:
 		err = fmt.Errorf("subrecord type %T is not implemented", t)
 	}
@@ -135,13 +277,14 @@ func (subData *SubRecord) formPosData() (subrec []byte) {
 	subrec[0] = byte(EgtsSrPosData)
 	binary.LittleEndian.PutUint16(subrec[1:3], uint16(egtsSubrecDataLen))
 	binary.LittleEndian.PutUint32(subrec[3:7], data.Time)
-	lat := uint32(math.Abs(data.Lat) / 90 * 0xffffffff)
-	lon := uint32(math.Abs(data.Lon) / 180 * 0xffffffff)
+	lat := uint32(math.Round(math.Abs(float64(data.Lat)) / latScale))
+	lon := uint32(math.Round(math.Abs(float64(data.Lon)) / lonScale))
 	binary.LittleEndian.PutUint32(subrec[7:11], lat)
 	binary.LittleEndian.PutUint32(subrec[11:15], lon)
 	flags := data.Lohs*64 | data.Lahs*32 | data.Mv*16 | data.RealTime*8 | 0x02 | data.Valid
-	spdHi := data.Speed * 10 / 256
-	spdLo := data.Speed * 10 % 256
+	speed := uint16(math.Round(math.Max(0, math.Min(float64(data.Speed*speedScale), maxSpeed))))
+	spdHi := speed / 256
+	spdLo := speed % 256
 	bearHi := data.Bearing / 256
 	bearLo := data.Bearing % 256
 	flags2 := ((bearHi << 0x07) | (spdHi & 0x3F)) & 0xBF //bearHi:1,0:1,spdHi:6
@@ -172,12 +315,18 @@ func (subData *SubRecord) formSrLiquidLevelSensor() (subrec []byte) {
 	if data.Type != 0xFF {
 		llsvu = data.Type
 	}
-	llsn := byte(2)
-	maddr := uint16(1)
+	llsn := byte(defaultFuelNumber)
+	if data.Number != 0 {
+		llsn = data.Number & 7
+	}
+	maddr := uint16(defaultFuelAddress)
+	if data.Address != 0 {
+		maddr = data.Address
+	}
 	flags := (llsef << 0x06) | (llsvu << 0x04) | llsn
 	egtsFuel := data.Fuel
 	if data.Type == 2 {
-		egtsFuel = uint32(math.Round(float64(egtsFuel * 10)))
+		egtsFuel *= 10
 	}
 	subrec[3] = flags
 	binary.LittleEndian.PutUint16(subrec[4:6], maddr)
@@ -185,6 +334,43 @@ func (subData *SubRecord) formSrLiquidLevelSensor() (subrec []byte) {
 	return
 }
 
+func (subData *SubRecord) formSrAdSensorsData() (subrec []byte) {
+	data := subData.Data.(*SensorsData)
+	subrec = []byte{EgtsSrAdSensorsData, 0, 0, data.DigitalInputsMask, data.DigitalOutputs, data.AnalogSensorsMask}
+	for i := uint(0); i < 8; i++ {
+		if data.DigitalInputsMask&(1<<i) != 0 {
+			subrec = append(subrec, data.DigitalInputs[i])
+		}
+	}
+	for i := uint(0); i < 8; i++ {
+		if data.AnalogSensorsMask&(1<<i) != 0 {
+			subrec = appendUint24(subrec, data.AnalogSensors[i])
+		}
+	}
+	binary.LittleEndian.PutUint16(subrec[1:3], uint16(len(subrec)-3))
+	return
+}
+
+func (subData *SubRecord) formSrCountersData() (subrec []byte) {
+	data := subData.Data.(*CountersData)
+	subrec = []byte{EgtsSrCountersData, 0, 0, data.CountersMask}
+	for i := uint(0); i < 8; i++ {
+		if data.CountersMask&(1<<i) != 0 {
+			subrec = appendUint24(subrec, data.Counters[i])
+		}
+	}
+	binary.LittleEndian.PutUint16(subrec[1:3], uint16(len(subrec)-3))
+	return
+}
+
+func uint24(b []byte) uint32 {
+	return uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16
+}
+
+func appendUint24(b []byte, v uint32) []byte {
+	return append(b, byte(v), byte(v>>8), byte(v>>16))
+}
+
 func (subData *SubRecord) String() string {
 	header := fmt.Sprintf("{SubType: %d,", subData.Type)
 	var data string
@@ -195,6 +381,14 @@ func (subData *SubRecord) String() string {
 		data = subData.Data.(*PosData).String()
 	case *FuelData:
 		data = subData.Data.(*FuelData).String()
+	case *SensorsData:
+		data = subData.Data.(*SensorsData).String()
+	case *CountersData:
+		data = subData.Data.(*CountersData).String()
+	case *TermIdentity:
+		data = subData.Data.(*TermIdentity).String()
+	case *ResultCode:
+		data = subData.Data.(*ResultCode).String()
 	default:
 		data = fmt.Sprintf("%v", data)
 	}
@@ -213,6 +407,14 @@ func (sub *FuelData) String() string {
 	return stringDefault(*sub)
 }
 
+func (sub *SensorsData) String() string {
+	return stringDefault(*sub)
+}
+
+func (sub *CountersData) String() string {
+	return stringDefault(*sub)
+}
+
 func stringDefault(v interface{}) string {
 	return fmt.Sprintf("%+v", v)
 }
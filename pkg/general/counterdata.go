@@ -0,0 +1,9 @@
+package general
+
+// CounterData is a general type for storing values of counters
+type CounterData struct {
+	// Counters contains values of counters, key is number of counter starting from 1
+	Counters map[byte]uint32
+}
+
+func (data CounterData) subrecord() {}
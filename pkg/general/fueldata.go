@@ -1,22 +1,16 @@
 package general
 
-import "github.com/egorban/navprot/pkg/egts"
-
 // FuelData is a general type for storing fuel level information
 type FuelData struct {
 	Type byte
 	Fuel uint32
 }
 
-// ToEgtsSubrecord implement ToEGTS method of Subrecord interface
-func (data FuelData) ToEgtsSubrecord() *egts.SubRecord {
-	fuel := egts.FuelData{
-		Type: data.Type,
-		Fuel: data.Fuel,
-	}
-	sub := egts.SubRecord{
-		Type: egts.EgtsSrLiquidLevelSensor,
-		Data: &fuel,
-	}
-	return &sub
+func (data FuelData) subrecord() {}
+
+// ToEgtsSubrecord returns *egts.SubRecord of data, nil is returned if package egts isn't imported.
+//
+// Deprecated: use Encode with egts.ProtocolName or egts.FromGeneral.
+func (data FuelData) ToEgtsSubrecord() interface{} {
+	return toEgtsSubrecord(data)
 }
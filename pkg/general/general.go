@@ -1,10 +1,15 @@
 /*
-Package general provides general interfaces ant types for working with telematic data.
+Package general provides protocol-neutral interfaces and types for working with telematic data.
+Protocol packages register encoders and decoders of general types, so data can be converted
+between protocols without knowledge of each other.
+
+This is incompatible with earlier versions, where Subrecord required ToEgtsSubrecord method
+returning *egts.SubRecord. Package general doesn't import egts anymore, so deprecated ToEgtsSubrecord
+methods return interface{} and *egts.SubRecord is returned by egts.FromGeneral. Events have no
+separate type: alarm button is marked by NavData.Sos, other events can't be represented by supported protocols.
 */
 package general
 
-import "github.com/egorban/navprot/pkg/egts"
-
 // NavProtocol is an interface for arbitrary navigation protocol.
 type NavProtocol interface {
 	Parse([]byte) ([]byte, error)
@@ -12,7 +17,9 @@ type NavProtocol interface {
 	String() string
 }
 
-// Subrecord is an interface for data that can be converted into EGTS subrecord
+// Subrecord is an interface for general telematic data types:
+// NavData, FuelData, SensorData and CounterData. Set of types is closed, so encoders of protocols
+// know every type.
 type Subrecord interface {
-	ToEgtsSubrecord() *egts.SubRecord
+	subrecord()
 }
@@ -1,50 +1,39 @@
 package general
 
-import (
-	"github.com/egorban/navprot/pkg/egts"
-)
+import "time"
 
 // NavData is a general type for storing navigation information
 type NavData struct {
 	Time     uint32
-	Lon      float64
-	Lat      float64
+	Lon      Degrees
+	Lat      Degrees
 	Bearing  uint16
-	Speed    uint16
+	Speed    KmH
 	RealTime bool
 	Valid    bool
+	// Sos is set, if data is sent by alarm button
+	Sos bool
 	// Source 13 - sos
 	Source byte
 }
 
-// ToEgtsSubrecord implement ToEGTS method of Subrecord interface
-func (data NavData) ToEgtsSubrecord() *egts.SubRecord {
-	nav := egts.PosData{
-		Time:    data.Time - egts.Timestamp20100101utc,
-		Lon:     data.Lon,
-		Lat:     data.Lat,
-		Bearing: data.Bearing,
-		Speed:   data.Speed,
-		Source:  data.Source,
-	}
-	if data.Lat < 0 {
-		nav.Lahs = 1
-	}
-	if data.Lon < 0 {
-		nav.Lohs = 1
-	}
-	if data.Speed > 0 {
-		nav.Mv = 1
-	}
-	if data.RealTime {
-		nav.RealTime = 1
-	}
-	if data.Valid {
-		nav.Valid = 1
-	}
-	sub := egts.SubRecord{
-		Type: egts.EgtsSrPosData,
-		Data: &nav,
-	}
-	return &sub
+func (data NavData) subrecord() {}
+
+// ToEgtsSubrecord returns *egts.SubRecord of data, nil is returned if data can't be converted
+// or package egts isn't imported.
+//
+// Deprecated: use Encode with egts.ProtocolName or egts.FromGeneral, they report conversion errors.
+func (data NavData) ToEgtsSubrecord() interface{} {
+	return toEgtsSubrecord(data)
+}
+
+// GetTime returns Time as time.Time in UTC
+func (data *NavData) GetTime() time.Time {
+	return FromSeconds(UnixEpoch, data.Time)
+}
+
+// SetTime sets Time to t. ErrTimeOutOfRange is returned, if t is before 1970 or after 2106.
+func (data *NavData) SetTime(t time.Time) (err error) {
+	data.Time, err = Seconds(UnixEpoch, t)
+	return
 }
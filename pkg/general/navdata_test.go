@@ -1,19 +1,20 @@
-package general
+package general_test
 
 import (
 	"reflect"
 	"testing"
 
 	"github.com/egorban/navprot/pkg/egts"
+	"github.com/egorban/navprot/pkg/general"
 )
 
 func TestNavData_ToEgtsSubrecord(t *testing.T) {
 	type fields struct {
 		Time     uint32
-		Lon      float64
-		Lat      float64
+		Lon      general.Degrees
+		Lat      general.Degrees
 		Bearing  uint16
-		Speed    uint16
+		Speed    general.KmH
 		RealTime bool
 		Valid    bool
 		Source   byte
@@ -21,7 +22,7 @@ func TestNavData_ToEgtsSubrecord(t *testing.T) {
 	tests := []struct {
 		name   string
 		fields fields
-		want   *egts.SubRecord
+		want   interface{}
 	}{
 		{name: "navData", fields: fields{
 			Time:     1522961700,
@@ -32,10 +33,11 @@ func TestNavData_ToEgtsSubrecord(t *testing.T) {
 			Valid:    true,
 			Source:   13,
 		}, want: egtsExpected()},
+		{name: "before2010", fields: fields{Time: 1}, want: nil},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			data := NavData{
+			data := general.NavData{
 				Time:     tt.fields.Time,
 				Lon:      tt.fields.Lon,
 				Lat:      tt.fields.Lat,
@@ -52,6 +54,13 @@ func TestNavData_ToEgtsSubrecord(t *testing.T) {
 	}
 }
 
+func TestFuelData_ToEgtsSubrecord(t *testing.T) {
+	want := &egts.SubRecord{Type: egts.EgtsSrLiquidLevelSensor, Data: &egts.FuelData{Type: 2, Fuel: 150}}
+	if got := (general.FuelData{Type: 2, Fuel: 150}).ToEgtsSubrecord(); !reflect.DeepEqual(got, want) {
+		t.Errorf("ToEgtsSubrecord() = %v, want %v", got, want)
+	}
+}
+
 func egtsExpected() *egts.SubRecord {
 	posData := egts.PosData{
 		Time:     260657700,
@@ -0,0 +1,96 @@
+package general
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrNotSupported is returned, when protocol or general type is not supported
+var ErrNotSupported = errors.New("not supported")
+
+// Encoder converts general subrecord into subrecord of specific protocol.
+// It returns ErrNotSupported for types, which can't be represented in protocol.
+type Encoder func(sub Subrecord) (interface{}, error)
+
+// Decoder creates empty packet of specific protocol
+type Decoder func() NavProtocol
+
+var (
+	registryMu sync.RWMutex
+	encoders   = make(map[string]Encoder)
+	decoders   = make(map[string]Decoder)
+)
+
+// RegisterEncoder makes encoder available by protocol name.
+// It panics, if encoder is nil or encoder of protocol is already registered.
+func RegisterEncoder(protocol string, encoder Encoder) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if encoder == nil {
+		panic("general: encoder is nil")
+	}
+	if _, ok := encoders[protocol]; ok {
+		panic("general: encoder is registered twice for " + protocol)
+	}
+	encoders[protocol] = encoder
+}
+
+// RegisterDecoder makes decoder available by protocol name.
+// It panics, if decoder is nil or decoder of protocol is already registered.
+func RegisterDecoder(protocol string, decoder Decoder) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if decoder == nil {
+		panic("general: decoder is nil")
+	}
+	if _, ok := decoders[protocol]; ok {
+		panic("general: decoder is registered twice for " + protocol)
+	}
+	decoders[protocol] = decoder
+}
+
+// toEgtsSubrecord supports deprecated ToEgtsSubrecord methods, which existed before registries.
+// Protocol name is the same as egts.ProtocolName, package egts can't be imported because of import cycle.
+func toEgtsSubrecord(sub Subrecord) interface{} {
+	egtsSub, err := Encode("egts", sub)
+	if err != nil {
+		return nil
+	}
+	return egtsSub
+}
+
+// Encode converts sub into subrecord of protocol
+func Encode(protocol string, sub Subrecord) (interface{}, error) {
+	registryMu.RLock()
+	encoder, ok := encoders[protocol]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, ErrNotSupported
+	}
+	return encoder(sub)
+}
+
+// NewPacket creates empty packet of protocol
+func NewPacket(protocol string) (NavProtocol, error) {
+	registryMu.RLock()
+	decoder, ok := decoders[protocol]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, ErrNotSupported
+	}
+	return decoder(), nil
+}
+
+// Decode parses packet of protocol from message and converts it to general subrecords
+func Decode(protocol string, message []byte) (subrecords []Subrecord, restBuf []byte, err error) {
+	packet, err := NewPacket(protocol)
+	if err != nil {
+		return
+	}
+	restBuf, err = packet.Parse(message)
+	if err != nil {
+		return
+	}
+	subrecords, err = packet.ToGeneral()
+	return
+}
@@ -0,0 +1,83 @@
+package general
+
+import (
+	"reflect"
+	"testing"
+)
+
+type testPacket struct {
+	data []Subrecord
+}
+
+func (p *testPacket) Parse(message []byte) ([]byte, error) {
+	p.data = []Subrecord{&FuelData{Type: 2, Fuel: uint32(message[0])}}
+	return message[1:], nil
+}
+
+func (p *testPacket) ToGeneral() ([]Subrecord, error) {
+	return p.data, nil
+}
+
+func (p *testPacket) String() string {
+	return "test"
+}
+
+func init() {
+	RegisterEncoder("test", func(sub Subrecord) (interface{}, error) {
+		if fuel, ok := sub.(*FuelData); ok {
+			return fuel.Fuel, nil
+		}
+		return nil, ErrNotSupported
+	})
+	RegisterDecoder("test", func() NavProtocol {
+		return new(testPacket)
+	})
+}
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		name     string
+		protocol string
+		sub      Subrecord
+		want     interface{}
+		wantErr  error
+	}{
+		{name: "fuel", protocol: "test", sub: &FuelData{Fuel: 5}, want: uint32(5)},
+		{name: "notSupportedType", protocol: "test", sub: &CounterData{}, wantErr: ErrNotSupported},
+		{name: "notSupportedProtocol", protocol: "unknown", sub: &FuelData{}, wantErr: ErrNotSupported},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Encode(tt.protocol, tt.sub)
+			if err != tt.wantErr {
+				t.Fatalf("Encode() error = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Encode() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecode(t *testing.T) {
+	subrecords, rest, err := Decode("test", []byte{7, 1})
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	want := []Subrecord{&FuelData{Type: 2, Fuel: 7}}
+	if !reflect.DeepEqual(subrecords, want) || !reflect.DeepEqual(rest, []byte{1}) {
+		t.Errorf("Decode() = %v, %v; want %v, %v", subrecords, rest, want, []byte{1})
+	}
+	if _, _, err = Decode("unknown", nil); err != ErrNotSupported {
+		t.Errorf("Decode() error = %v, want %v", err, ErrNotSupported)
+	}
+}
+
+func TestRegisterEncoder_twice(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("RegisterEncoder() didn't panic")
+		}
+	}()
+	RegisterEncoder("test", func(Subrecord) (interface{}, error) { return nil, nil })
+}
@@ -0,0 +1,13 @@
+package general
+
+// SensorData is a general type for storing states of digital inputs and outputs and values of analog sensors
+type SensorData struct {
+	// Digital contains states of digital inputs (bit per input), key is number of octet starting from 1
+	Digital map[byte]byte
+	// Outputs contains states of digital outputs (bit per output)
+	Outputs byte
+	// Analog contains values of analog sensors, key is number of sensor starting from 1
+	Analog map[byte]uint32
+}
+
+func (data SensorData) subrecord() {}
@@ -0,0 +1,31 @@
+package general
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+// ErrTimeOutOfRange is returned, when time can't be represented in protocol
+var ErrTimeOutOfRange = errors.New("time is out of range")
+
+// UnixEpoch is initial time of NDTP and general timestamps
+var UnixEpoch = time.Unix(0, 0).UTC()
+
+// Seconds returns number of whole seconds from epoch to t.
+// ErrTimeOutOfRange is returned, if t is before epoch or the number doesn't fit uint32.
+func Seconds(epoch, t time.Time) (uint32, error) {
+	if t.Before(epoch) {
+		return 0, ErrTimeOutOfRange
+	}
+	sec := t.Unix() - epoch.Unix()
+	if sec > math.MaxUint32 {
+		return 0, ErrTimeOutOfRange
+	}
+	return uint32(sec), nil
+}
+
+// FromSeconds returns time, which is sec seconds after epoch, in UTC
+func FromSeconds(epoch time.Time, sec uint32) time.Time {
+	return epoch.Add(time.Duration(sec) * time.Second).UTC()
+}
@@ -0,0 +1,28 @@
+package general
+
+import "math"
+
+// Degrees is an angle in degrees, it's used for latitude and longitude
+type Degrees float64
+
+// KmH is a speed in kilometers per hour
+type KmH float64
+
+// Tolerances of conversion NDTP -> general -> EGTS -> general.
+// NDTP stores coordinates in 1e-7 degrees and speed in km/h, EGTS stores latitude in 90/0xffffffff degrees,
+// longitude in 180/0xffffffff degrees and speed in 0.1 km/h. Coordinates are rounded to the nearest EGTS value,
+// so they differ from the source by no more than half of EGTS unit. Speed is converted exactly.
+const (
+	CoordTolerance Degrees = 180.0 / 0xffffffff / 2
+	SpeedTolerance KmH     = 0
+)
+
+// Equal reports whether d and other differ by no more than CoordTolerance
+func (d Degrees) Equal(other Degrees) bool {
+	return math.Abs(float64(d-other)) <= float64(CoordTolerance)
+}
+
+// Equal reports whether s and other differ by no more than SpeedTolerance
+func (s KmH) Equal(other KmH) bool {
+	return math.Abs(float64(s-other)) <= float64(SpeedTolerance)
+}
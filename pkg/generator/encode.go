@@ -0,0 +1,128 @@
+package generator
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/egorban/navprot/pkg/egts"
+	"github.com/egorban/navprot/pkg/ndtp"
+)
+
+// NDTPPacket creates NPH_SND_REALTIME or NPH_SND_HISTORY packet of sample, vehicle identifier is stored
+// in NPL peer address. Request IDs are not set, ndtp.Terminal or Encoder sets them.
+func NDTPPacket(s *Sample) (*ndtp.Packet, error) {
+	cells := make([]ndtp.Subrecord, 0, 2)
+	for _, sub := range s.Subrecords() {
+		cell, err := ndtp.FromGeneral(sub)
+		if err != nil {
+			return nil, err
+		}
+		cells = append(cells, cell)
+	}
+	packet := ndtp.NewNavData(s.Nav.RealTime, cells)
+	binary.LittleEndian.PutUint32(packet.Npl.PeerAddress, s.ID)
+	return packet, nil
+}
+
+// EGTSPacket creates EGTS_PT_APPDATA packet with teledata record of sample.
+// Packet ID is not set, egts.Client or Encoder sets it.
+func EGTSPacket(s *Sample, recNum uint16) (*egts.Packet, error) {
+	record := &egts.Record{
+		RecNum:  recNum,
+		ID:      s.ID,
+		Service: egts.EgtsTeledataService,
+	}
+	for _, sub := range s.Subrecords() {
+		egtsSub, err := egts.FromGeneral(sub)
+		if err != nil {
+			return nil, err
+		}
+		record.Data = append(record.Data, egtsSub)
+	}
+	if err := record.SetTime(s.Nav.GetTime()); err != nil {
+		return nil, err
+	}
+	return &egts.Packet{Type: egts.EgtsPtAppdata, Records: []*egts.Record{record}}, nil
+}
+
+// EGTSAuthPacket creates EGTS_PT_APPDATA packet with EGTS_SR_TERM_IDENTITY of vehicle
+func EGTSAuthPacket(id uint32, recNum uint16) *egts.Packet {
+	return &egts.Packet{
+		Type: egts.EgtsPtAppdata,
+		Records: []*egts.Record{{
+			RecNum:  recNum,
+			ID:      id,
+			Service: egts.EgtsAuthService,
+			Data:    []*egts.SubRecord{{Type: egts.EgtsSrTermIdentity, Data: &egts.TermIdentity{TID: id}}},
+		}},
+	}
+}
+
+// Encoder writes samples to stream as NDTP or EGTS packets with sequential request IDs or packet IDs
+type Encoder struct {
+	w        io.Writer
+	protocol string
+	nplReqID uint16
+	nphReqID uint32
+	packetID uint16
+	recNum   uint16
+}
+
+// NewEncoder creates Encoder of protocol ndtp.ProtocolName or egts.ProtocolName
+func NewEncoder(w io.Writer, protocol string) (*Encoder, error) {
+	if protocol != ndtp.ProtocolName && protocol != egts.ProtocolName {
+		return nil, fmt.Errorf("unknown protocol %q", protocol)
+	}
+	return &Encoder{w: w, protocol: protocol}, nil
+}
+
+// EncodeAuth writes NPH_SGC_CONN_REQUEST or EGTS_SR_TERM_IDENTITY packet of vehicle
+func (e *Encoder) EncodeAuth(id uint32) error {
+	if e.protocol == ndtp.ProtocolName {
+		return e.writeNDTP(ndtp.NewConnRequest(id))
+	}
+	e.recNum++
+	return e.writeEGTS(EGTSAuthPacket(id, e.recNum-1))
+}
+
+// Encode writes sample
+func (e *Encoder) Encode(s *Sample) error {
+	if e.protocol == ndtp.ProtocolName {
+		packet, err := NDTPPacket(s)
+		if err != nil {
+			return err
+		}
+		return e.writeNDTP(packet)
+	}
+	packet, err := EGTSPacket(s, e.recNum)
+	if err != nil {
+		return err
+	}
+	e.recNum++
+	return e.writeEGTS(packet)
+}
+
+func (e *Encoder) writeNDTP(packet *ndtp.Packet) error {
+	packet.Npl.ReqID = e.nplReqID
+	packet.Nph.ReqID = e.nphReqID
+	data, err := packet.Form()
+	if err != nil {
+		return err
+	}
+	e.nplReqID++
+	e.nphReqID++
+	_, err = e.w.Write(data)
+	return err
+}
+
+func (e *Encoder) writeEGTS(packet *egts.Packet) error {
+	packet.ID = e.packetID
+	data, err := packet.Form()
+	if err != nil {
+		return err
+	}
+	e.packetID++
+	_, err = e.w.Write(data)
+	return err
+}
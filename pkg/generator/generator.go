@@ -0,0 +1,314 @@
+/*
+Package generator produces synthetic tracks of virtual vehicles for load tests.
+Every vehicle moves along route with varying speed and stops, its speed and bearing are derived
+from geometry of track, fuel level decreases with distance. Samples are encoded as NDTP or EGTS packets.
+*/
+package generator
+
+import (
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/egorban/navprot/pkg/egts"
+	"github.com/egorban/navprot/pkg/general"
+)
+
+// Default values of Config
+const (
+	DefaultInterval     = 10 * time.Second
+	DefaultPoints       = 100
+	DefaultRadius       = 10.0
+	DefaultSpeed        = 40.0
+	DefaultFuelCapacity = 400
+	DefaultFuelPerKm    = 0.3
+)
+
+// DefaultCenter is default center of area of random routes
+var DefaultCenter = Point{Lat: 55.7558, Lon: 37.6173}
+
+const (
+	// stopRate is probability of stop at every point
+	stopRate = 0.02
+	// maxStop is max number of intervals of stop
+	maxStop = 5
+	// refuelLevel is part of capacity, below which vehicle is refueled
+	refuelLevel = 0.1
+	// fuelTypeLiters is type of fuel level in liters
+	fuelTypeLiters = 2
+)
+
+// Config contains parameters of tracks. Zero values are replaced by default values.
+type Config struct {
+	// Vehicles is number of vehicles, 1 by default
+	Vehicles int
+	// FirstID is identifier of the first vehicle, other vehicles are numbered sequentially, 1 by default
+	FirstID uint32
+	// Start is time of the first point, current time by default
+	Start time.Time
+	// Interval is time between points of vehicle
+	Interval time.Duration
+	// Points is number of points of every vehicle
+	Points int
+	// Route is cyclic list of waypoints, vehicles start from different waypoints.
+	// If it's empty, random waypoints within Radius km from Center are used.
+	Route  []Point
+	Center Point
+	Radius float64
+	// Speed is mean speed of moving vehicle
+	Speed general.KmH
+	// FuelCapacity is tank capacity in liters, vehicle is refueled when level is below 10%
+	FuelCapacity uint32
+	// FuelPerKm is fuel consumption in liters per km
+	FuelPerKm float64
+	// SosRate is probability of SOS at every point
+	SosRate float64
+	// HistoryRate is probability of history (not real time) point
+	HistoryRate float64
+	// Seed initializes random generators, tracks are reproducible for the same Config
+	Seed int64
+}
+
+// Sample is a point of vehicle track
+type Sample struct {
+	// ID is vehicle identifier
+	ID   uint32
+	Nav  general.NavData
+	Fuel general.FuelData
+}
+
+// Subrecords returns navigation and fuel data of sample
+func (s *Sample) Subrecords() []general.Subrecord {
+	return []general.Subrecord{&s.Nav, &s.Fuel}
+}
+
+// Generator produces samples of all vehicles in order of time
+type Generator struct {
+	vehicles []*Vehicle
+	heads    []*Sample
+	// err is error of vehicle, which stops generator
+	err error
+}
+
+// New creates Generator
+func New(conf Config) (*Generator, error) {
+	if err := conf.setDefaults(); err != nil {
+		return nil, err
+	}
+	g := &Generator{
+		vehicles: make([]*Vehicle, conf.Vehicles),
+		heads:    make([]*Sample, conf.Vehicles),
+	}
+	for i := range g.vehicles {
+		g.vehicles[i] = newVehicle(&conf, conf.FirstID+uint32(i), i)
+	}
+	return g, nil
+}
+
+func (conf *Config) setDefaults() error {
+	if conf.Vehicles < 0 || conf.Points < 0 || conf.Interval < 0 || conf.Radius < 0 || conf.Speed < 0 ||
+		conf.FuelPerKm < 0 {
+		return errors.New("negative generator parameter")
+	}
+	if len(conf.Route) == 1 {
+		return errors.New("route must contain at least 2 waypoints")
+	}
+	for i, p := range conf.Route {
+		if distance(p, conf.Route[(i+1)%len(conf.Route)]) == 0 {
+			return errors.New("route contains identical consecutive waypoints")
+		}
+	}
+	if conf.Vehicles == 0 {
+		conf.Vehicles = 1
+	}
+	if conf.FirstID == 0 {
+		conf.FirstID = 1
+	}
+	if conf.Start.IsZero() {
+		conf.Start = time.Now().Truncate(time.Second)
+	}
+	if conf.Interval == 0 {
+		conf.Interval = DefaultInterval
+	}
+	if conf.Points == 0 {
+		conf.Points = DefaultPoints
+	}
+	if conf.Center == (Point{}) {
+		conf.Center = DefaultCenter
+	}
+	if conf.Radius == 0 {
+		conf.Radius = DefaultRadius
+	}
+	if conf.Speed == 0 {
+		conf.Speed = DefaultSpeed
+	}
+	if conf.FuelCapacity == 0 {
+		conf.FuelCapacity = DefaultFuelCapacity
+	}
+	if conf.FuelPerKm == 0 {
+		conf.FuelPerKm = DefaultFuelPerKm
+	}
+	return nil
+}
+
+// Vehicles returns vehicles of generator, their tracks can be read independently instead of Next
+func (g *Generator) Vehicles() []*Vehicle {
+	return g.vehicles
+}
+
+// Next returns the next sample in order of time, samples of the same time are ordered by vehicle.
+// io.EOF is returned after the last sample. Error of any vehicle, e.g. general.ErrTimeOutOfRange,
+// stops generator, it's returned by all further calls.
+func (g *Generator) Next() (*Sample, error) {
+	if g.err != nil {
+		return nil, g.err
+	}
+	best := -1
+	for i, v := range g.vehicles {
+		if g.heads[i] == nil {
+			var err error
+			if g.heads[i], err = v.Next(); err != nil && err != io.EOF {
+				g.err = err
+				return nil, err
+			}
+		}
+		if g.heads[i] != nil && (best < 0 || g.heads[i].Nav.Time < g.heads[best].Nav.Time) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return nil, io.EOF
+	}
+	s := g.heads[best]
+	g.heads[best] = nil
+	return s, nil
+}
+
+// Vehicle is a virtual vehicle moving along route
+type Vehicle struct {
+	ID uint32
+
+	conf  *Config
+	rnd   *rand.Rand
+	time  time.Time
+	left  int
+	pos   Point
+	route []Point
+	// next is index of the next waypoint in route
+	next    int
+	cruise  float64
+	stop    int
+	bearing float64
+	fuel    float64
+}
+
+func newVehicle(conf *Config, id uint32, n int) *Vehicle {
+	v := &Vehicle{
+		ID:     id,
+		conf:   conf,
+		rnd:    rand.New(rand.NewSource(conf.Seed + int64(id))),
+		time:   conf.Start,
+		left:   conf.Points,
+		route:  conf.Route,
+		cruise: float64(conf.Speed),
+	}
+	v.fuel = float64(conf.FuelCapacity) * (refuelLevel + (1-refuelLevel)*v.rnd.Float64())
+	if len(v.route) > 0 {
+		start := n % len(v.route)
+		v.pos = v.route[start]
+		v.next = (start + 1) % len(v.route)
+	} else {
+		v.pos = v.randomPoint()
+		v.route = []Point{v.randomPoint()}
+	}
+	return v
+}
+
+// Next returns the next sample of vehicle track, io.EOF is returned after the last sample
+func (v *Vehicle) Next() (*Sample, error) {
+	if v.left == 0 {
+		return nil, io.EOF
+	}
+	var speed float64
+	if v.left < v.conf.Points {
+		prev := v.pos
+		v.move(v.speedKmH() * v.conf.Interval.Hours())
+		dist := distance(prev, v.pos)
+		speed = dist / v.conf.Interval.Hours()
+		if dist > 0.001 {
+			v.bearing = bearing(prev, v.pos)
+		}
+		v.fuel -= dist * v.conf.FuelPerKm
+		if v.fuel < float64(v.conf.FuelCapacity)*refuelLevel {
+			v.fuel = float64(v.conf.FuelCapacity)
+		}
+		v.time = v.time.Add(v.conf.Interval)
+	}
+	v.left--
+	s := &Sample{
+		ID: v.ID,
+		Nav: general.NavData{
+			Lat:      v.pos.Lat,
+			Lon:      v.pos.Lon,
+			Bearing:  uint16(math.Round(v.bearing)) % 360,
+			Speed:    general.KmH(math.Round(speed*10) / 10),
+			RealTime: v.rnd.Float64() >= v.conf.HistoryRate,
+			Valid:    true,
+		},
+		Fuel: general.FuelData{Type: fuelTypeLiters, Fuel: uint32(math.Round(v.fuel))},
+	}
+	if v.rnd.Float64() < v.conf.SosRate {
+		s.Nav.Sos = true
+		s.Nav.Source = egts.SourceSos
+	}
+	if err := s.Nav.SetTime(v.time); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// speedKmH returns speed till the next point, vehicle stops sometimes and its cruise speed drifts
+func (v *Vehicle) speedKmH() float64 {
+	if v.stop > 0 {
+		v.stop--
+		return 0
+	}
+	if v.rnd.Float64() < stopRate {
+		v.stop = v.rnd.Intn(maxStop)
+		return 0
+	}
+	base := float64(v.conf.Speed)
+	v.cruise += v.rnd.NormFloat64() * 0.1 * base
+	v.cruise = math.Max(0.5*base, math.Min(1.5*base, v.cruise))
+	return v.cruise
+}
+
+// move moves vehicle along route by dist km. Vehicle stays, if the whole route is passed without progress.
+func (v *Vehicle) move(dist float64) {
+	for idle := 0; dist > 0 && idle <= len(v.route); {
+		target := v.route[v.next]
+		d := distance(v.pos, target)
+		if d > dist {
+			v.pos = destination(v.pos, bearing(v.pos, target), dist)
+			return
+		}
+		if d == 0 {
+			idle++
+		} else {
+			idle = 0
+		}
+		v.pos = target
+		dist -= d
+		if len(v.conf.Route) > 0 {
+			v.next = (v.next + 1) % len(v.route)
+		} else {
+			v.route[0] = v.randomPoint()
+		}
+	}
+}
+
+func (v *Vehicle) randomPoint() Point {
+	return destination(v.conf.Center, 360*v.rnd.Float64(), v.conf.Radius*math.Sqrt(v.rnd.Float64()))
+}
@@ -0,0 +1,205 @@
+package generator
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/egorban/navprot/pkg/egts"
+	"github.com/egorban/navprot/pkg/general"
+	"github.com/egorban/navprot/pkg/ndtp"
+)
+
+func TestGeometry(t *testing.T) {
+	moscow := Point{Lat: 55.7558, Lon: 37.6173}
+	spb := Point{Lat: 59.9343, Lon: 30.3351}
+	if d := distance(moscow, spb); math.Abs(d-634) > 2 {
+		t.Errorf("distance() = %v, want about 634 km", d)
+	}
+	if b := bearing(moscow, Point{Lat: 56, Lon: 37.6173}); b > 0.001 && b < 359.999 {
+		t.Errorf("bearing() to north = %v, want 0", b)
+	}
+	if b := bearing(moscow, Point{Lat: 55.7558, Lon: 38}); math.Abs(b-90) > 1 {
+		t.Errorf("bearing() to east = %v, want about 90", b)
+	}
+	dst := destination(moscow, bearing(moscow, spb), distance(moscow, spb))
+	if distance(dst, spb) > 0.001 {
+		t.Errorf("destination() = %v, want %v", dst, spb)
+	}
+}
+
+func samples(t *testing.T, conf Config) []*Sample {
+	g, err := New(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var res []*Sample
+	for {
+		s, err := g.Next()
+		if err == io.EOF {
+			return res
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		res = append(res, s)
+	}
+}
+
+func TestGenerator(t *testing.T) {
+	start := time.Date(2020, 5, 1, 10, 0, 0, 0, time.UTC)
+	conf := Config{Vehicles: 3, FirstID: 100, Start: start, Interval: 30 * time.Second, Points: 50,
+		SosRate: 0.1, HistoryRate: 0.3, Seed: 1}
+	got := samples(t, conf)
+	if len(got) != 150 {
+		t.Fatalf("generated %d samples, want 150", len(got))
+	}
+	if !reflect.DeepEqual(got, samples(t, conf)) {
+		t.Error("tracks with the same seed differ")
+	}
+	last := make(map[uint32]*Sample)
+	var sos, history int
+	for i, s := range got {
+		if i > 0 && s.Nav.Time < got[i-1].Nav.Time {
+			t.Fatalf("sample %d is out of order", i)
+		}
+		if s.Nav.Sos {
+			sos++
+		}
+		if !s.Nav.RealTime {
+			history++
+		}
+		prev, ok := last[s.ID]
+		last[s.ID] = s
+		if !ok {
+			if s.Nav.GetTime() != start || s.Nav.Speed != 0 {
+				t.Errorf("incorrect first sample %+v", s.Nav)
+			}
+			continue
+		}
+		a, b := Point{Lat: prev.Nav.Lat, Lon: prev.Nav.Lon}, Point{Lat: s.Nav.Lat, Lon: s.Nav.Lon}
+		speed := distance(a, b) / conf.Interval.Hours()
+		if math.Abs(speed-float64(s.Nav.Speed)) > 0.06 {
+			t.Errorf("speed %v doesn't match distance between points, want %v", s.Nav.Speed, speed)
+		}
+		if speed > 1 && math.Abs(bearing(a, b)-float64(s.Nav.Bearing)) > 0.5 {
+			t.Errorf("bearing %v doesn't match direction between points, want %v", s.Nav.Bearing, bearing(a, b))
+		}
+		if speed > 3*DefaultSpeed || distance(DefaultCenter, b) > DefaultRadius+0.01 {
+			t.Errorf("incorrect sample %+v", s.Nav)
+		}
+		if s.Fuel.Fuel > prev.Fuel.Fuel && s.Fuel.Fuel != DefaultFuelCapacity {
+			t.Errorf("fuel increased from %d to %d", prev.Fuel.Fuel, s.Fuel.Fuel)
+		}
+	}
+	if len(last) != 3 || last[100] == nil || last[102] == nil {
+		t.Errorf("incorrect vehicle IDs %v", last)
+	}
+	if sos == 0 || history == 0 || history == len(got) {
+		t.Errorf("%d SOS and %d history samples", sos, history)
+	}
+}
+
+func TestGenerator_error(t *testing.T) {
+	g, err := New(Config{Start: time.Date(1960, 1, 1, 0, 0, 0, 0, time.UTC), Points: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err = g.Next(); err != general.ErrTimeOutOfRange {
+			t.Errorf("Next() error = %v, want %v", err, general.ErrTimeOutOfRange)
+		}
+	}
+}
+
+func TestGenerator_route(t *testing.T) {
+	route := []Point{{Lat: 55.75, Lon: 37.60}, {Lat: 55.75, Lon: 37.62}, {Lat: 55.76, Lon: 37.62}}
+	got := samples(t, Config{Vehicles: 2, Route: route, Points: 20, Start: time.Unix(1600000000, 0)})
+	if p := (Point{Lat: got[0].Nav.Lat, Lon: got[0].Nav.Lon}); p != route[0] {
+		t.Errorf("the first vehicle starts at %v, want %v", p, route[0])
+	}
+	if p := (Point{Lat: got[1].Nav.Lat, Lon: got[1].Nav.Lon}); p != route[1] {
+		t.Errorf("the second vehicle starts at %v, want %v", p, route[1])
+	}
+	if _, err := New(Config{Route: route[:1]}); err == nil {
+		t.Error("New() accepted route of one waypoint")
+	}
+	if _, err := New(Config{Route: []Point{route[0], route[1], route[1]}}); err == nil {
+		t.Error("New() accepted route with identical consecutive waypoints")
+	}
+	// move must return even if route has no length
+	conf := Config{Route: []Point{route[0], route[0]}}
+	v := newVehicle(&conf, 1, 0)
+	v.move(10)
+	if v.pos != route[0] {
+		t.Errorf("vehicle moved to %v on route without length", v.pos)
+	}
+}
+
+func TestEncoder(t *testing.T) {
+	got := samples(t, Config{Vehicles: 2, Points: 3, Start: time.Unix(1600000000, 0), Seed: 2})
+	for _, proto := range []string{ndtp.ProtocolName, egts.ProtocolName} {
+		var buf bytes.Buffer
+		enc, err := NewEncoder(&buf, proto)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := enc.EncodeAuth(1); err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range got {
+			if err := enc.Encode(s); err != nil {
+				t.Fatal(err)
+			}
+		}
+		var data [][]general.Subrecord
+		if proto == ndtp.ProtocolName {
+			dec := ndtp.NewDecoder(&buf)
+			for n := 0; ; n++ {
+				packet, err := dec.Decode()
+				if err == io.EOF {
+					break
+				}
+				if err != nil || packet.Nph.ReqID != uint32(n) {
+					t.Fatalf("ndtp packet %d: %v, %v", n, packet, err)
+				}
+				if n > 0 {
+					sub, _ := packet.ToGeneral()
+					data = append(data, sub)
+				}
+			}
+		} else {
+			dec := egts.NewDecoder(&buf)
+			for n := 0; ; n++ {
+				packet, err := dec.Decode()
+				if err == io.EOF {
+					break
+				}
+				if err != nil || packet.ID != uint16(n) {
+					t.Fatalf("egts packet %d: %v, %v", n, packet, err)
+				}
+				if n > 0 {
+					sub, _ := packet.ToGeneral()
+					data = append(data, sub)
+				}
+			}
+		}
+		if len(data) != len(got) {
+			t.Fatalf("%s: decoded %d packets, want %d", proto, len(data), len(got))
+		}
+		for i, sub := range data {
+			nav := sub[0].(*general.NavData)
+			fuel := sub[1].(*general.FuelData)
+			want := got[i]
+			// NDTP stores coordinates in 1e-7 degrees and speed in km/h
+			if nav.Time != want.Nav.Time || math.Abs(float64(nav.Lat-want.Nav.Lat)) > 1e-7 ||
+				math.Abs(float64(nav.Speed-want.Nav.Speed)) > 0.5 || nav.RealTime != want.Nav.RealTime ||
+				fuel.Fuel != want.Fuel.Fuel {
+				t.Errorf("%s: packet %d contains %+v %+v, want %+v %+v", proto, i, nav, fuel, want.Nav, want.Fuel)
+			}
+		}
+	}
+}
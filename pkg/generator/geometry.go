@@ -0,0 +1,51 @@
+package generator
+
+import (
+	"math"
+
+	"github.com/egorban/navprot/pkg/general"
+)
+
+// earthRadius is mean radius of the Earth in km
+const earthRadius = 6371.0
+
+// Point is geographic position
+type Point struct {
+	Lat general.Degrees `json:"lat"`
+	Lon general.Degrees `json:"lon"`
+}
+
+func radians(d general.Degrees) float64 {
+	return float64(d) * math.Pi / 180
+}
+
+func degrees(r float64) general.Degrees {
+	return general.Degrees(r * 180 / math.Pi)
+}
+
+// distance returns great-circle distance between a and b in km
+func distance(a, b Point) float64 {
+	lat1, lat2 := radians(a.Lat), radians(b.Lat)
+	dLat, dLon := lat2-lat1, radians(b.Lon-a.Lon)
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// bearing returns initial bearing from a to b in degrees clockwise from north, in range [0, 360)
+func bearing(a, b Point) float64 {
+	lat1, lat2 := radians(a.Lat), radians(b.Lat)
+	dLon := radians(b.Lon - a.Lon)
+	y := math.Sin(dLon) * math.Cos(lat2)
+	x := math.Cos(lat1)*math.Sin(lat2) - math.Sin(lat1)*math.Cos(lat2)*math.Cos(dLon)
+	return math.Mod(float64(degrees(math.Atan2(y, x)))+360, 360)
+}
+
+// destination returns point at distance dist km from p along initial bearing brng degrees
+func destination(p Point, brng, dist float64) Point {
+	lat1, lon1 := radians(p.Lat), radians(p.Lon)
+	theta, delta := brng*math.Pi/180, dist/earthRadius
+	lat2 := math.Asin(math.Sin(lat1)*math.Cos(delta) + math.Cos(lat1)*math.Sin(delta)*math.Cos(theta))
+	lon2 := lon1 + math.Atan2(math.Sin(theta)*math.Sin(delta)*math.Cos(lat1), math.Cos(delta)-math.Sin(lat1)*math.Sin(lat2))
+	lon := math.Mod(float64(degrees(lon2))+540, 360) - 180
+	return Point{Lat: degrees(lat2), Lon: general.Degrees(lon)}
+}
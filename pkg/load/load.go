@@ -0,0 +1,237 @@
+/*
+Package load benchmarks NDTP and EGTS servers. It opens many concurrent connections, every connection
+authenticates and sends generated navigation data at configured rate. Replies are checked by package replay,
+results of all connections are combined into latency percentiles, error counts and throughput.
+*/
+package load
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/egorban/navprot/pkg/egts"
+	"github.com/egorban/navprot/pkg/generator"
+	"github.com/egorban/navprot/pkg/ndtp"
+	"github.com/egorban/navprot/pkg/replay"
+)
+
+// Default values of Config
+const (
+	DefaultRate        = 1.0
+	DefaultDuration    = 10 * time.Second
+	DefaultDialTimeout = 10 * time.Second
+)
+
+// Config contains load parameters
+type Config struct {
+	// Addr is server address host:port
+	Addr string
+	// Protocol is ndtp.ProtocolName or egts.ProtocolName
+	Protocol string
+	// Connections is number of concurrent connections, every connection is a vehicle of Track
+	Connections int
+	// Rate is number of packets per second sent over every connection, DefaultRate is used if it's zero
+	Rate float64
+	// Duration is time of sending packets, DefaultDuration is used if it's zero
+	Duration time.Duration
+	// RampUp is time, during which connections are opened evenly
+	RampUp time.Duration
+	// ReplyTimeout is time to wait for reply, replay.DefaultReplyTimeout is used if it's zero
+	ReplyTimeout time.Duration
+	// DialTimeout is timeout of connecting, DefaultDialTimeout is used if it's zero
+	DialTimeout time.Duration
+	// Track contains parameters of generated tracks, Vehicles and Points are set according to
+	// Connections, Rate and Duration. Interval between points is 1/Rate by default.
+	Track generator.Config
+}
+
+// Report contains results of load
+type Report struct {
+	// Connections is number of established connections
+	Connections int
+	// ConnectErrors is number of failed connection attempts
+	ConnectErrors int
+	// AuthErrors is number of connections with unsuccessful or unanswered authorization
+	AuthErrors int
+	// Disconnects is number of connections closed by server or failed during sending
+	Disconnects int
+	// Summary of data packets of all connections, authorization packets are not included
+	replay.Summary
+	// Elapsed is time from the start till the last reply or timeout
+	Elapsed time.Duration
+	// Err is the last connection error
+	Err error
+}
+
+// Throughput returns number of replied packets per second
+func (r *Report) Throughput() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(r.Replied) / r.Elapsed.Seconds()
+}
+
+func (r *Report) String() string {
+	return fmt.Sprintf("connections %d, connect errors %d, auth errors %d, disconnects %d\n%v\nelapsed %v, throughput %.1f packets/s",
+		r.Connections, r.ConnectErrors, r.AuthErrors, r.Disconnects, r.Summary, r.Elapsed.Round(time.Millisecond),
+		r.Throughput())
+}
+
+// Run applies load to server and returns report after all connections are finished
+func Run(conf Config) (*Report, error) {
+	if err := conf.setDefaults(); err != nil {
+		return nil, err
+	}
+	g, err := generator.New(conf.Track)
+	if err != nil {
+		return nil, err
+	}
+	l := &loader{conf: conf, combined: new(replay.Report), report: new(Report)}
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i, v := range g.Vehicles() {
+		wg.Add(1)
+		delay := time.Duration(int64(conf.RampUp) * int64(i) / int64(conf.Connections))
+		go func(v *generator.Vehicle) {
+			defer wg.Done()
+			time.Sleep(time.Until(start.Add(delay)))
+			l.connection(v)
+		}(v)
+	}
+	wg.Wait()
+	l.report.Elapsed = time.Since(start)
+	l.report.Summary = l.combined.Summary()
+	return l.report, nil
+}
+
+func (conf *Config) setDefaults() error {
+	if conf.Protocol != ndtp.ProtocolName && conf.Protocol != egts.ProtocolName {
+		return fmt.Errorf("unknown protocol %q", conf.Protocol)
+	}
+	if conf.Connections <= 0 || conf.Rate < 0 || conf.Duration < 0 || conf.RampUp < 0 {
+		return errors.New("incorrect load parameters")
+	}
+	if conf.Rate == 0 {
+		conf.Rate = DefaultRate
+	}
+	if conf.Duration == 0 {
+		conf.Duration = DefaultDuration
+	}
+	if conf.DialTimeout <= 0 {
+		conf.DialTimeout = DefaultDialTimeout
+	}
+	conf.Track.Vehicles = conf.Connections
+	conf.Track.Points = int(conf.Rate * conf.Duration.Seconds())
+	if conf.Track.Points == 0 {
+		conf.Track.Points = 1
+	}
+	if conf.Track.Interval == 0 {
+		conf.Track.Interval = time.Duration(float64(time.Second) / conf.Rate)
+	}
+	return nil
+}
+
+type loader struct {
+	conf     Config
+	mu       sync.Mutex
+	combined *replay.Report
+	report   *Report
+}
+
+// connection sends authorization and track of vehicle over new connection
+func (l *loader) connection(v *generator.Vehicle) {
+	records, err := l.records(v)
+	if err != nil {
+		l.mu.Lock()
+		l.report.Err = err
+		l.mu.Unlock()
+		return
+	}
+	conn, err := net.DialTimeout("tcp", l.conf.Addr, l.conf.DialTimeout)
+	if err != nil {
+		l.finish(nil, err, false)
+		return
+	}
+	defer conn.Close()
+	report, err := replay.Run(conn, records, replay.Config{
+		Protocol:     l.conf.Protocol,
+		Speed:        1,
+		ReplyTimeout: l.conf.ReplyTimeout,
+	})
+	l.finish(report, err, true)
+}
+
+// records creates authorization packet and packets of vehicle track sent with interval 1/Rate
+func (l *loader) records(v *generator.Vehicle) ([]replay.Record, error) {
+	var auth []byte
+	var err error
+	if l.conf.Protocol == ndtp.ProtocolName {
+		auth, err = ndtp.NewConnRequest(v.ID).Form()
+	} else {
+		auth, err = generator.EGTSAuthPacket(v.ID, 0).Form()
+	}
+	if err != nil {
+		return nil, err
+	}
+	records := []replay.Record{{Data: auth}}
+	base := time.Now()
+	interval := time.Duration(float64(time.Second) / l.conf.Rate)
+	for i := 0; ; i++ {
+		s, err := v.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		var data []byte
+		if l.conf.Protocol == ndtp.ProtocolName {
+			var packet *ndtp.Packet
+			if packet, err = generator.NDTPPacket(s); err == nil {
+				data, err = packet.Form()
+			}
+		} else {
+			var packet *egts.Packet
+			if packet, err = generator.EGTSPacket(s, uint16(i+1)); err == nil {
+				data, err = packet.Form()
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, replay.Record{Time: base.Add(time.Duration(i) * interval), Data: data})
+	}
+	return records, nil
+}
+
+// finish adds results of connection to report, report is nil if connection is not established
+func (l *loader) finish(report *replay.Report, err error, connected bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !connected {
+		l.report.ConnectErrors++
+		l.report.Err = err
+		return
+	}
+	l.report.Connections++
+	if err != nil {
+		l.report.Disconnects++
+		l.report.Err = err
+	}
+	if report == nil {
+		return
+	}
+	results := report.Results
+	if len(results) > 0 && results[0].Index == 0 {
+		if results[0].Err != nil {
+			l.report.AuthErrors++
+		}
+		results = results[1:]
+	}
+	l.combined.Results = append(l.combined.Results, results...)
+	l.combined.Unexpected += report.Unexpected
+}
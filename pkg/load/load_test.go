@@ -0,0 +1,86 @@
+package load
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/egorban/navprot/internal/testserver"
+	"github.com/egorban/navprot/pkg/egts"
+	"github.com/egorban/navprot/pkg/ndtp"
+)
+
+func TestRun_NDTP(t *testing.T) {
+	// terminal 3 is not authorized, the 2nd packet of terminal 2 is not answered
+	l := testserver.Listen(t, "127.0.0.1:0", func(conn net.Conn) {
+		var n int
+		ndtp.NewSession(conn, func(id int, packet *ndtp.Packet) uint32 {
+			n++
+			if id == 3 {
+				return ndtp.NphResultClientNotRegistered
+			}
+			if id == 2 && n == 3 {
+				time.Sleep(300 * time.Millisecond)
+			}
+			return ndtp.NphResultOk
+		}).Serve()
+	})
+	defer l.Close()
+	report, err := Run(Config{Addr: l.Addr().String(), Protocol: ndtp.ProtocolName, Connections: 20, Rate: 20,
+		Duration: 250 * time.Millisecond, RampUp: 50 * time.Millisecond, ReplyTimeout: 200 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if report.Connections != 20 || report.ConnectErrors != 0 || report.AuthErrors != 1 || report.Disconnects != 0 {
+		t.Errorf("incorrect connection counters %v", report)
+	}
+	if report.Sent != 100 || report.Lost < 1 || report.Failed != 5 || report.Replied+report.Lost != 100 {
+		t.Errorf("incorrect packet counters %v", report)
+	}
+	if report.Max < report.P50 || report.Throughput() <= 0 {
+		t.Errorf("incorrect statistics %v", report)
+	}
+}
+
+func TestRun_EGTS(t *testing.T) {
+	l := testserver.Listen(t, "127.0.0.1:0", func(conn net.Conn) {
+		dec := egts.NewDecoder(conn)
+		for {
+			packet, err := dec.Decode()
+			if err != nil {
+				return
+			}
+			reply, _ := (&egts.Packet{
+				Type: egts.EgtsPtResponse,
+				ID:   packet.ID,
+				Data: &egts.Response{RPID: packet.ID, ProcRes: egts.Success},
+			}).Form()
+			conn.Write(reply)
+		}
+	})
+	defer l.Close()
+	report, err := Run(Config{Addr: l.Addr().String(), Protocol: egts.ProtocolName, Connections: 5, Rate: 50,
+		Duration: 100 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if report.Connections != 5 || report.AuthErrors != 0 || report.Sent != 25 || report.Replied != 25 {
+		t.Errorf("incorrect report %v", report)
+	}
+}
+
+func TestRun_connectErrors(t *testing.T) {
+	l := testserver.Listen(t, "127.0.0.1:0", func(conn net.Conn) {})
+	addr := l.Addr().String()
+	l.Close()
+	report, err := Run(Config{Addr: addr, Protocol: ndtp.ProtocolName, Connections: 3, Duration: time.Second})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if report.Connections != 0 || report.ConnectErrors != 3 || report.Err == nil {
+		t.Errorf("incorrect report %v", report)
+	}
+	if _, err = Run(Config{Addr: addr, Protocol: "unknown", Connections: 1}); err == nil {
+		t.Error("Run() accepted unknown protocol")
+	}
+}
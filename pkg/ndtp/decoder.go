@@ -0,0 +1,117 @@
+package ndtp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/egorban/navprot/internal/framer"
+)
+
+const (
+	// DefaultMaxPacketSize is default max size of NDTP packet accepted by Decoder,
+	// it's size of the largest packet: NPL header and 65535 bytes of data
+	DefaultMaxPacketSize = nplHeaderLen + 0xFFFF
+
+	decoderBufLen = 4096
+)
+
+var (
+	// ErrCRC is returned by Decoder when packet has incorrect checksum
+	ErrCRC = errors.New("ndtp: crc incorrect")
+	// ErrPacketTooLarge is returned by Decoder when packet length exceeds MaxPacketSize
+	ErrPacketTooLarge = errors.New("ndtp: packet is too large")
+)
+
+// Decoder reads NDTP packets from input stream. After garbage, incorrect checksum
+// or too large packet Decoder looks for the next NPL signature.
+type Decoder struct {
+	// MaxPacketSize is max size of packet including NPL header
+	MaxPacketSize int
+
+	f *framer.Reader
+}
+
+// NewDecoder creates Decoder, which reads packets from r
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{
+		MaxPacketSize: DefaultMaxPacketSize,
+		f:             framer.NewReader(r, decoderBufLen),
+	}
+}
+
+// Decode returns next packet from stream. Packet is returned together with parsing error,
+// if NPL layer is correct, but NPH layer can't be parsed. ErrCRC and ErrPacketTooLarge are not fatal,
+// decoding can be continued. Read errors are returned as is, io.EOF means end of stream.
+func (d *Decoder) Decode() (*Packet, error) {
+	frame, err := d.Next()
+	if err != nil {
+		return nil, err
+	}
+	// Parse copies data referenced by packet, so frame can be reused by the next Next call
+	packet := new(Packet)
+	_, err = packet.Parse(frame)
+	return packet, err
+}
+
+// MatchHeader reports whether data starts with NPL signature. If data is too short to decide,
+// false and number of required bytes are returned.
+func MatchHeader(data []byte) (ok bool, need int) {
+	if len(data) < len(nplSignature) {
+		if !bytes.HasPrefix(nplSignature, data) {
+			return false, 0
+		}
+		return false, len(nplSignature)
+	}
+	return bytes.HasPrefix(data, nplSignature), 0
+}
+
+// Next returns next binary packet from stream without parsing and copying. Returned slice
+// references internal buffer and is valid until the next call of Next or Decode, so it can be
+// parsed by Packet.ParseInto without memory allocation. Errors are the same as in Decode.
+func (d *Decoder) Next() ([]byte, error) {
+	d.f.ResetSkipped()
+	for {
+		data := d.f.Data()
+		first := bytes.Index(data, nplSignature)
+		if first == -1 {
+			if len(data) > 0 && data[len(data)-1] == nplSignature[0] {
+				d.f.Skip(len(data) - 1)
+			} else {
+				d.f.Skip(len(data))
+			}
+		} else if first > 0 {
+			d.f.Skip(first)
+			continue
+		}
+		if first != 0 || len(data) < nplHeaderLen {
+			if err := d.f.Fill(nplHeaderLen); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		size := nplHeaderLen + int(binary.LittleEndian.Uint16(data[2:4]))
+		if size > d.MaxPacketSize {
+			d.f.Skip(1)
+			return nil, ErrPacketTooLarge
+		}
+		if len(data) < size {
+			if err := d.f.Fill(size); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if binary.LittleEndian.Uint16(data[4:6])&nplFlagCrc != 0 &&
+			binary.BigEndian.Uint16(data[6:8]) != crc16(data[nplHeaderLen:size]) {
+			d.f.Skip(1)
+			return nil, ErrCRC
+		}
+		return d.f.Take(size), nil
+	}
+}
+
+// Skipped returns number of bytes skipped before packet or error returned by the last Decode call
+func (d *Decoder) Skipped() int {
+	return d.f.Skipped()
+}
@@ -0,0 +1,118 @@
+package ndtp
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+	"testing/iotest"
+)
+
+func TestDecoder_Decode(t *testing.T) {
+	nav := ndtpNav().Packet
+	badCrc := append([]byte(nil), nav...)
+	badCrc[len(badCrc)-1]++
+	tooLarge := []byte{126, 126, 255, 255, 2, 0}
+	tests := []struct {
+		name        string
+		stream      [][]byte
+		wantPackets []*Packet
+		wantErrs    []error
+		wantSkipped []int
+	}{
+		{"packets", [][]byte{nav, nav}, []*Packet{ndtpNav(), ndtpNav(), nil},
+			[]error{nil, nil, io.EOF}, []int{0, 0, 0}},
+		{"garbage", [][]byte{{1, 2, 3}, nav, {3, 4}}, []*Packet{ndtpNav(), nil},
+			[]error{nil, io.EOF}, []int{3, 2}},
+		{"crc", [][]byte{{1}, badCrc, {0}, nav}, []*Packet{nil, ndtpNav(), nil},
+			[]error{ErrCRC, nil, io.EOF}, []int{2, len(badCrc), 0}},
+		{"tooLarge", [][]byte{tooLarge, nav}, []*Packet{nil, ndtpNav(), nil},
+			[]error{ErrPacketTooLarge, nil, io.EOF}, []int{1, len(tooLarge) - 1, 0}},
+		{"truncated", [][]byte{nav[:20]}, []*Packet{nil},
+			[]error{io.ErrUnexpectedEOF}, []int{20}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stream := bytes.Join(tt.stream, nil)
+			decoder := NewDecoder(iotest.OneByteReader(bytes.NewReader(stream)))
+			decoder.MaxPacketSize = 1024
+			for i, want := range tt.wantPackets {
+				got, err := decoder.Decode()
+				if err != tt.wantErrs[i] {
+					t.Fatalf("Decode() #%d error = %v, want %v", i, err, tt.wantErrs[i])
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("Decode() #%d = %v, want %v", i, got, want)
+				}
+				if i < len(tt.wantSkipped) && decoder.Skipped() != tt.wantSkipped[i] {
+					t.Errorf("Skipped() #%d = %d, want %d", i, decoder.Skipped(), tt.wantSkipped[i])
+				}
+			}
+		})
+	}
+}
+
+func TestDecoder_Next(t *testing.T) {
+	nav := ndtpNav().Packet
+	stream := bytes.Join([][]byte{{1, 2}, nav, nav}, nil)
+	decoder := NewDecoder(bytes.NewReader(stream))
+	packet := new(Packet)
+	for i := 0; i < 2; i++ {
+		frame, err := decoder.Next()
+		if err != nil {
+			t.Fatalf("Next() #%d error = %v", i, err)
+		}
+		if !bytes.Equal(frame, nav) {
+			t.Errorf("Next() #%d = %v, want %v", i, frame, nav)
+		}
+		if _, err = packet.ParseInto(frame); err != nil {
+			t.Errorf("ParseInto() #%d error = %v", i, err)
+		}
+	}
+	if _, err := decoder.Next(); err != io.EOF {
+		t.Errorf("Next() error = %v, want %v", err, io.EOF)
+	}
+}
+
+func TestMatchHeader(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		wantOk   bool
+		wantNeed int
+	}{
+		{"empty", nil, false, 2},
+		{"firstByte", []byte{0x7E}, false, 2},
+		{"packet", ndtpNav().Packet, true, 0},
+		{"garbageBefore", packetNav(), false, 0},
+		{"withoutSignature", ndtpWithoutSignature(), false, 0},
+		{"egts", []byte{1, 0, 0, 11}, false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, need := MatchHeader(tt.data)
+			if ok != tt.wantOk || need != tt.wantNeed {
+				t.Errorf("MatchHeader() = %v, %d, want %v, %d", ok, need, tt.wantOk, tt.wantNeed)
+			}
+		})
+	}
+}
+
+func TestDecoder_decodedPacketIsKept(t *testing.T) {
+	conn, err := NewConnRequest(1024).Form()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoder := NewDecoder(bytes.NewReader(append(append([]byte(nil), ndtpNav().Packet...), conn...)))
+	first, err := decoder.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the next packet reuses buffer of decoder
+	if _, err = decoder.Decode(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(first, ndtpNav()) {
+		t.Errorf("packet changed after the next Decode() = %v, want %v", first, ndtpNav())
+	}
+}
@@ -0,0 +1,57 @@
+package ndtp
+
+import "github.com/egorban/navprot/pkg/general"
+
+// ProtocolName is name of NDTP protocol in general registries
+const ProtocolName = "ndtp"
+
+func init() {
+	general.RegisterEncoder(ProtocolName, func(sub general.Subrecord) (interface{}, error) {
+		return FromGeneral(sub)
+	})
+	general.RegisterDecoder(ProtocolName, func() general.NavProtocol {
+		return new(Packet)
+	})
+}
+
+// FromGeneral creates NDTP navigation cell from general subrecord.
+// Only NavData and FuelData are represented in NDTP, general.ErrNotSupported is returned for other types.
+func FromGeneral(sub general.Subrecord) (Subrecord, error) {
+	switch data := sub.(type) {
+	case general.NavData:
+		return fromNavData(&data), nil
+	case *general.NavData:
+		return fromNavData(data), nil
+	case general.FuelData:
+		return fromFuelData(&data), nil
+	case *general.FuelData:
+		return fromFuelData(data), nil
+	}
+	return nil, general.ErrNotSupported
+}
+
+func fromNavData(data *general.NavData) *NavData {
+	nav := &NavData{
+		Time:    data.Time,
+		Lon:     data.Lon,
+		Lat:     data.Lat,
+		Bearing: data.Bearing,
+		Speed:   data.Speed,
+		Valid:   data.Valid,
+		Sos:     data.Sos,
+	}
+	if data.Lon >= 0 {
+		nav.Lohs = 1
+	}
+	if data.Lat >= 0 {
+		nav.Lahs = 1
+	}
+	return nav
+}
+
+func fromFuelData(data *general.FuelData) *FuelData {
+	return &FuelData{
+		Type: data.Type,
+		Fuel: uint16(data.Fuel),
+	}
+}
@@ -0,0 +1,33 @@
+package ndtp
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/egorban/navprot/pkg/general"
+)
+
+func TestFromGeneral(t *testing.T) {
+	tests := []struct {
+		name    string
+		sub     general.Subrecord
+		want    Subrecord
+		wantErr error
+	}{
+		{"navData", &general.NavData{Time: 1522961700, Lon: 37.6925783, Lat: -55.7890249, Speed: 60, Valid: true, Sos: true, Source: 13},
+			&NavData{Time: 1522961700, Lon: 37.6925783, Lat: -55.7890249, Speed: 60, Lohs: 1, Valid: true, Sos: true}, nil},
+		{"fuelData", general.FuelData{Type: 2, Fuel: 150}, &FuelData{Type: 2, Fuel: 150}, nil},
+		{"counterData", &general.CounterData{}, nil, general.ErrNotSupported},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FromGeneral(tt.sub)
+			if err != tt.wantErr {
+				t.Fatalf("FromGeneral() error = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FromGeneral() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package ndtp
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Discriminators of Nph.Data in JSON
+const (
+	jsonDataUint32    = "uint32"
+	jsonDataExtDevice = "ext_device"
+	jsonDataCells     = "cells"
+)
+
+// Discriminators of navigation cells in JSON
+const (
+	jsonCellNav  = "nav"
+	jsonCellFuel = "fuel"
+)
+
+type nphJSON struct {
+	ServiceID   uint16          `json:"service_id"`
+	PacketType  uint16          `json:"packet_type"`
+	RequestFlag bool            `json:"request_flag"`
+	ReqID       uint32          `json:"req_id"`
+	DataType    string          `json:"data_type,omitempty"`
+	Data        json.RawMessage `json:"data,omitempty"`
+}
+
+type cellJSON struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// MarshalJSON encodes NPH with type of Data in data_type field:
+// "uint32" for NPH_RESULT and NPH_SGC_CONN_REQUEST, "ext_device" for *ExtDevice
+// and "cells" for navigation cells, each of them has type "nav" or "fuel".
+func (nph *Nph) MarshalJSON() ([]byte, error) {
+	v := nphJSON{
+		ServiceID:   nph.ServiceID,
+		PacketType:  nph.PacketType,
+		RequestFlag: nph.RequestFlag,
+		ReqID:       nph.ReqID,
+	}
+	var data interface{}
+	switch d := nph.Data.(type) {
+	case nil:
+	case uint32:
+		v.DataType, data = jsonDataUint32, d
+	case *ExtDevice:
+		v.DataType, data = jsonDataExtDevice, d
+	case []Subrecord:
+		cells := make([]cellJSON, 0, len(d))
+		for _, cell := range d {
+			c, err := marshalCell(cell)
+			if err != nil {
+				return nil, err
+			}
+			cells = append(cells, c)
+		}
+		v.DataType, data = jsonDataCells, cells
+	default:
+		return nil, fmt.Errorf("unsupported NPH data type %T", nph.Data)
+	}
+	if data != nil {
+		var err error
+		if v.Data, err = json.Marshal(data); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(v)
+}
+
+// UnmarshalJSON decodes NPH encoded by MarshalJSON
+func (nph *Nph) UnmarshalJSON(b []byte) error {
+	var v nphJSON
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	nph.ServiceID = v.ServiceID
+	nph.PacketType = v.PacketType
+	nph.RequestFlag = v.RequestFlag
+	nph.ReqID = v.ReqID
+	nph.Data = nil
+	switch v.DataType {
+	case "":
+		return nil
+	case jsonDataUint32:
+		var d uint32
+		if err := json.Unmarshal(v.Data, &d); err != nil {
+			return err
+		}
+		nph.Data = d
+	case jsonDataExtDevice:
+		d := new(ExtDevice)
+		if err := json.Unmarshal(v.Data, d); err != nil {
+			return err
+		}
+		nph.Data = d
+	case jsonDataCells:
+		var cells []cellJSON
+		if err := json.Unmarshal(v.Data, &cells); err != nil {
+			return err
+		}
+		d := make([]Subrecord, 0, len(cells))
+		for _, c := range cells {
+			cell, err := unmarshalCell(c)
+			if err != nil {
+				return err
+			}
+			d = append(d, cell)
+		}
+		nph.Data = d
+	default:
+		return fmt.Errorf("unknown NPH data type %q", v.DataType)
+	}
+	return nil
+}
+
+func marshalCell(cell Subrecord) (c cellJSON, err error) {
+	switch cell.(type) {
+	case *NavData:
+		c.Type = jsonCellNav
+	case *FuelData:
+		c.Type = jsonCellFuel
+	default:
+		return c, fmt.Errorf("unsupported cell type %T", cell)
+	}
+	c.Data, err = json.Marshal(cell)
+	return
+}
+
+func unmarshalCell(c cellJSON) (Subrecord, error) {
+	var cell Subrecord
+	switch c.Type {
+	case jsonCellNav:
+		cell = new(NavData)
+	case jsonCellFuel:
+		cell = new(FuelData)
+	default:
+		return nil, fmt.Errorf("unknown cell type %q", c.Type)
+	}
+	if err := json.Unmarshal(c.Data, cell); err != nil {
+		return nil, err
+	}
+	return cell, nil
+}
@@ -0,0 +1,63 @@
+package ndtp
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestPacket_JSON(t *testing.T) {
+	tests := []struct {
+		name       string
+		packetData *Packet
+		want       []byte
+	}{
+		{"fuel8Several", ndtpFuel8Several(), ndtpFuel8Several().Packet},
+		{"fuel10", ndtpFuel10(), ndtpFuel10().Packet},
+		{"extResult", ndtpExtResult(), packetExtResult()},
+		{"connRequest", NewConnRequest(1024), connRequest(1024)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := json.Marshal(tt.packetData)
+			if err != nil {
+				t.Fatalf("Marshal() error = %v", err)
+			}
+			var got Packet
+			if err = json.Unmarshal(b, &got); err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+			if !reflect.DeepEqual(got.Nph, tt.packetData.Nph) {
+				t.Errorf("Unmarshal() Nph = %v, want %v", got.Nph, tt.packetData.Nph)
+			}
+			message, err := got.Form()
+			if err != nil {
+				t.Fatalf("Form() error = %v", err)
+			}
+			if !reflect.DeepEqual(message, tt.want) {
+				t.Errorf("Form() = %v, want %v", message, tt.want)
+			}
+		})
+	}
+}
+
+func TestNph_MarshalJSON(t *testing.T) {
+	nph := &Nph{ServiceID: NphSrvNavdata, PacketType: nphSndRealtime, RequestFlag: true, ReqID: 1, Data: []Subrecord{
+		&NavData{Time: 1522961700, Lon: 37.6925783, Lat: 55.7890249, Bearing: 339, Speed: 60, Lohs: 1, Lahs: 1, Valid: true},
+		&FuelData{Type: 2, Fuel: 30, LevelL: 30},
+	}}
+	want := `{"service_id":1,"packet_type":101,"request_flag":true,"req_id":1,"data_type":"cells","data":[` +
+		`{"type":"nav","data":{"time":1522961700,"lon":37.6925783,"lat":55.7890249,"bearing":339,"speed":60,` +
+		`"sos":false,"lohs":1,"lahs":1,"valid":true}},` +
+		`{"type":"fuel","data":{"type":2,"fuel":30,"level_mm":0,"level_l":30}}]}`
+	got, err := json.Marshal(nph)
+	if err != nil {
+		t.Fatalf("MarshalJSON() error = %v", err)
+	}
+	if string(got) != want {
+		t.Errorf("MarshalJSON() = %s, want %s", got, want)
+	}
+	if err = json.Unmarshal([]byte(`{"service_id":1,"data_type":"cells","data":[{"type":"photo"}]}`), new(Nph)); err == nil {
+		t.Error("UnmarshalJSON() of unknown cell type succeeded")
+	}
+}
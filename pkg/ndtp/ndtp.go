@@ -13,9 +13,11 @@ import (
 
 // Packet contains information about about NDTP (Navigation Data Transfer Protocol) packet
 type Packet struct {
-	Npl    *NplData
-	Nph    *Nph
-	Packet []byte
+	Npl    *NplData `json:"npl"`
+	Nph    *Nph     `json:"nph"`
+	Packet []byte   `json:"-"`
+
+	storage storage
 }
 
 const (
@@ -23,6 +25,12 @@ const (
 	nphHeaderLen     = 10
 	ndtpResultLen    = nphHeaderLen + nplHeaderLen + 4
 	ndtpExtResultLen = nphHeaderLen + nplHeaderLen + 8
+	connRequestLen   = 12
+	nplFlagCrc       = 2
+	nplTypeNph       = 2
+	protoVersionHigh = 6
+	protoVersionLow  = 2
+	maxPacketSize    = 1024
 
 	// Cell Types
 	cellTypeNav     = 0
@@ -82,19 +90,109 @@ const (
 
 	// NphResultOk means request was successfully completed
 	NphResultOk = 0
+	// NphResultServiceNotSupported means service of request is not supported
+	NphResultServiceNotSupported = 100
+	// NphResultServiceNotAvailable means service of request is temporarily not available
+	NphResultServiceNotAvailable = 101
+	// NphResultPacketNotSupported means type of request is not supported
+	NphResultPacketNotSupported = 200
+	// NphResultPacketInvalidSize means request has incorrect size
+	NphResultPacketInvalidSize = 201
+	// NphResultPacketInvalidFormat means request has incorrect format
+	NphResultPacketInvalidFormat = 202
+	// NphResultPacketInvalidParameter means request has incorrect parameter
+	NphResultPacketInvalidParameter = 203
+	// NphResultPacketUnexpected means request is not expected in current state
+	NphResultPacketUnexpected = 204
+	// NphResultProtoVerNotSupported means protocol version is not supported
+	NphResultProtoVerNotSupported = 300
+	// NphResultClientNotRegistered means client is not registered
+	NphResultClientNotRegistered = 301
+	// NphResultClientAuthFailed means client authentication failed
+	NphResultClientAuthFailed = 303
+	// NphResultClientAlreadyRegistered means client with the same identifier is already connected
+	NphResultClientAlreadyRegistered = 305
 )
 
 // Parse NDTP packet. Parsed information is stored in variable with NDTP type.
+// Packet and PeerAddress are copies, so message can be reused after Parse.
 func (packetData *Packet) Parse(message []byte) (restBuf []byte, err error) {
-	packetData.Npl, packetData.Packet, restBuf, err = parseNPL(message)
+	return packetData.parse(message, nil)
+}
+
+// ParseInto parses NDTP packet like Parse, but reuses memory of previously parsed packet.
+// Npl, Nph and navigation cells of previous packet are overwritten, Packet and PeerAddress
+// reference message. Parsing of navigation data doesn't allocate memory in steady state.
+func (packetData *Packet) ParseInto(message []byte) (restBuf []byte, err error) {
+	packetData.Reset()
+	return packetData.parse(message, &packetData.storage)
+}
+
+// Reset clears packet keeping memory for the next ParseInto call
+func (packetData *Packet) Reset() {
+	packetData.Npl = nil
+	packetData.Nph = nil
+	packetData.Packet = nil
+	packetData.storage.reset()
+}
+
+func (packetData *Packet) parse(message []byte, st *storage) (restBuf []byte, err error) {
+	packetData.Npl, packetData.Packet, restBuf, err = parseNPL(message, st.newNpl())
 	if err != nil {
 		return
 	}
-	packetData.Nph = new(Nph)
-	err = packetData.Nph.parse(packetData.Packet[nplHeaderLen:])
+	if st == nil {
+		// only ParseInto keeps references to message
+		packetData.Packet = append([]byte(nil), packetData.Packet...)
+		packetData.Npl.PeerAddress = packetData.Packet[9:13]
+	}
+	packetData.Nph = st.newNph()
+	err = packetData.Nph.parse(packetData.Packet[nplHeaderLen:], st)
 	return
 }
 
+// Form generates NDTP binary packet from Npl and Nph. Generated packet is stored in Packet field too.
+func (packetData *Packet) Form() ([]byte, error) {
+	if packetData.Npl == nil || packetData.Nph == nil {
+		return nil, errors.New("NPL or NPH is not set")
+	}
+	nph, err := packetData.Nph.form()
+	if err != nil {
+		return nil, err
+	}
+	packetData.Packet = packetData.Npl.form(nph)
+	return packetData.Packet, nil
+}
+
+// NewConnRequest creates NPH_SGC_CONN_REQUEST packet for terminal with specified id
+func NewConnRequest(id uint32) *Packet {
+	return newPacket(NphSrvGenericControls, nphSgcConnRequest, id)
+}
+
+// NewNavData creates NPH_SND_REALTIME or NPH_SND_HISTORY packet with specified cells
+func NewNavData(realTime bool, cells []Subrecord) *Packet {
+	packetType := uint16(nphSndHistory)
+	if realTime {
+		packetType = nphSndRealtime
+	}
+	return newPacket(NphSrvNavdata, packetType, cells)
+}
+
+func newPacket(service, packetType uint16, data interface{}) *Packet {
+	return &Packet{
+		Npl: &NplData{
+			PeerAddress: make([]byte, 4),
+			DataType:    nplTypeNph,
+		},
+		Nph: &Nph{
+			ServiceID:   service,
+			PacketType:  packetType,
+			RequestFlag: true,
+			Data:        data,
+		},
+	}
+}
+
 // String generate string with information about NDTP packet in readable format.
 func (packetData Packet) String() string {
 	sNPL := packetData.Npl.String()
@@ -147,8 +245,8 @@ func (packetData *Packet) Reply(result uint32) []byte {
 
 // ReplyExt creates NPH_SED_DEVICE_RESULT packet
 func (packetData *Packet) ReplyExt(result uint32) ([]byte, error) {
-	if packetData.Service() == NphSrvExternalDevice {
-		reply := packetData.Nph.Data.(*ExtDevice).reply(packetData.Packet, result)
+	if ext, ok := packetData.Nph.Data.(*ExtDevice); ok && packetData.Service() == NphSrvExternalDevice {
+		reply := ext.reply(packetData.Packet, result)
 		return reply, nil
 	}
 	return nil, errors.New("incorrect packet service")
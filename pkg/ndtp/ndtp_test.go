@@ -1,6 +1,7 @@
 package ndtp
 
 import (
+	"bytes"
 	"reflect"
 	"testing"
 )
@@ -91,14 +92,14 @@ func packetExtResult() []byte {
 
 func ndtpNav() *Packet {
 	data := []Subrecord{&NavData{1522961700, 37.6925783, 55.7890249, 339, 0, false, 1, 1, true},
-		&FuelData{255, 0}}
+		&FuelData{Type: 255, Fuel: 0}}
 	nph := Nph{1, 101, true, 5291, data}
 	npl := NplData{make([]byte, 4), 0x02, 0x00}
 	packExpected := []byte{126, 126, 74, 0, 2, 0, 107, 210, 2, 0, 0, 0, 0, 0, 0, 1, 0, 101, 0, 1, 0, 171,
 		20, 0, 0, 0, 0, 36, 141, 198, 90, 87, 110, 119, 22, 201, 186, 64, 33, 224, 203, 0, 0, 0, 0, 83, 1, 0,
 		0, 220, 0, 4, 0, 2, 0, 22, 0, 67, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 167, 97, 0, 0, 31, 6, 0, 0, 8,
 		0, 2, 0, 0, 0, 0, 0}
-	return &Packet{&npl, &nph, packExpected}
+	return &Packet{Npl: &npl, Nph: &nph, Packet: packExpected}
 }
 
 func ndtpExtTitle() *Packet {
@@ -106,14 +107,14 @@ func ndtpExtTitle() *Packet {
 	nph := Nph{NphSrvExternalDevice, nphSedDeviceTitleData, false, 1, &data}
 	npl := NplData{[]byte{0, 4, 0, 0}, 0x02, 1936}
 	packExpected := []byte{126, 126, 90, 1, 2, 0, 33, 134, 2, 0, 4, 0, 0, 144, 7, 5, 0, 100, 0, 0, 0, 1, 0, 0, 0, 18, 0, 0, 128, 0, 0, 0, 0, 1, 0, 0, 0, 60, 78, 65, 86, 83, 67, 82, 32, 118, 101, 114, 61, 49, 46, 48, 62, 60, 73, 68, 62, 49, 56, 60, 47, 73, 68, 62, 60, 70, 82, 79, 77, 62, 83, 69, 82, 86, 69, 82, 60, 47, 70, 82, 79, 77, 62, 60, 84, 79, 62, 85, 83, 69, 82, 60, 47, 84, 79, 62, 60, 84, 89, 80, 69, 62, 81, 85, 69, 82, 89, 60, 47, 84, 89, 80, 69, 62, 60, 77, 83, 71, 32, 116, 105, 109, 101, 61, 54, 48, 32, 98, 101, 101, 112, 61, 49, 32, 116, 121, 112, 101, 61, 98, 97, 99, 107, 103, 114, 111, 117, 110, 100, 62, 60, 98, 114, 47, 62, 60, 98, 114, 47, 62, 38, 110, 98, 115, 112, 59, 38, 110, 98, 115, 112, 59, 38, 110, 98, 115, 112, 59, 38, 110, 98, 115, 112, 59, 38, 110, 98, 115, 112, 59, 38, 110, 98, 115, 112, 59, 194, 251, 32, 236, 229, 237, 255, 32, 241, 235, 251, 248, 232, 242, 229, 63, 60, 98, 114, 47, 62, 60, 98, 114, 47, 62, 38, 110, 98, 115, 112, 59, 38, 110, 98, 115, 112, 59, 38, 110, 98, 115, 112, 59, 38, 110, 98, 115, 112, 59, 38, 110, 98, 115, 112, 59, 38, 110, 98, 115, 112, 59, 38, 110, 98, 115, 112, 59, 60, 98, 116, 110, 49, 62, 196, 224, 60, 47, 98, 116, 110, 49, 62, 60, 98, 114, 47, 62, 60, 98, 114, 47, 62, 38, 110, 98, 115, 112, 59, 38, 110, 98, 115, 112, 59, 38, 110, 98, 115, 112, 59, 38, 110, 98, 115, 112, 59, 38, 110, 98, 115, 112, 59, 38, 110, 98, 115, 112, 59, 60, 98, 116, 110, 50, 62, 205, 229, 242, 60, 47, 98, 116, 110, 50, 62, 60, 98, 114, 47, 62, 60, 47, 77, 83, 71, 62, 60, 47, 78, 65, 86, 83, 67, 82, 62}
-	return &Packet{&npl, &nph, packExpected}
+	return &Packet{Npl: &npl, Nph: &nph, Packet: packExpected}
 }
 
 func ndtpExtResult() *Packet {
 	data := ExtDevice{MesID: 1}
 	nph := Nph{NphSrvExternalDevice, nphSedDeviceResult, false, 263, &data}
 	npl := NplData{DataType: 0x02, PeerAddress: []byte{0, 4, 0, 0}, ReqID: 263}
-	return &Packet{&npl, &nph, packetExtResult()}
+	return &Packet{Npl: &npl, Nph: &nph, Packet: packetExtResult()}
 }
 
 func TestPacket_String(t *testing.T) {
@@ -134,7 +135,7 @@ func TestPacket_String(t *testing.T) {
 }
 
 func wantNdtpString() string {
-	return "NPL: {PeerAddress:[0 0 0 0] DataType:2 ReqID:0}; NPH: {ServiceID:1, PacketType:101, RequestFlag:true, ReqID:5291}; Data: [ &{Time:1522961700 Lon:37.6925783 Lat:55.7890249 Bearing:339 Speed:0 Sos:false Lohs:1 Lahs:1 Valid:true} &{Type:255 Fuel:0} ]; Packet: [126 126 74 0 2 0 107 210 2 0 0 0 0 0 0 1 0 101 0 1 0 171 20 0 0 0 0 36 141 198 90 87 110 119 22 201 186 64 33 224 203 0 0 0 0 83 1 0 0 220 0 4 0 2 0 22 0 67 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 167 97 0 0 31 6 0 0 8 0 2 0 0 0 0 0]"
+	return "NPL: {PeerAddress:[0 0 0 0] DataType:2 ReqID:0}; NPH: {ServiceID:1, PacketType:101, RequestFlag:true, ReqID:5291}; Data: [ &{Time:1522961700 Lon:37.6925783 Lat:55.7890249 Bearing:339 Speed:0 Sos:false Lohs:1 Lahs:1 Valid:true} &{Type:255 Fuel:0 LevelMm:0 LevelL:0} ]; Packet: [126 126 74 0 2 0 107 210 2 0 0 0 0 0 0 1 0 101 0 1 0 171 20 0 0 0 0 36 141 198 90 87 110 119 22 201 186 64 33 224 203 0 0 0 0 83 1 0 0 220 0 4 0 2 0 22 0 67 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 167 97 0 0 31 6 0 0 8 0 2 0 0 0 0 0]"
 }
 
 func packetFuel8() []byte {
@@ -147,12 +148,12 @@ func packetFuel8() []byte {
 }
 
 func ndtpFuel8() *Packet {
-	data := []Subrecord{&FuelData{0, 10}}
+	data := []Subrecord{&FuelData{Type: 0, Fuel: 10, LevelMm: 10}}
 	nph := Nph{1, 101, true, 5291, data}
 	npl := NplData{make([]byte, 4), 0x02, 0x00}
 	packExpected := []byte{126, 126, 18, 0, 2, 0, 239, 117, 2, 0, 0, 0, 0, 0, 0,
 		1, 0, 101, 0, 1, 0, 171, 20, 0, 0, 8, 0, 0, 10, 0, 0, 0, 0}
-	return &Packet{&npl, &nph, packExpected}
+	return &Packet{Npl: &npl, Nph: &nph, Packet: packExpected}
 }
 
 func packetFuel8Several() []byte {
@@ -167,9 +168,9 @@ func packetFuel8Several() []byte {
 }
 
 func ndtpFuel8Several() *Packet {
-	data := []Subrecord{&FuelData{0, 10},
-		&FuelData{2, 20},
-		&FuelData{2, 50}}
+	data := []Subrecord{&FuelData{Type: 0, Fuel: 10, LevelMm: 10},
+		&FuelData{Type: 2, Fuel: 20, LevelL: 20},
+		&FuelData{Type: 2, Fuel: 50, LevelL: 50}}
 	nph := Nph{1, 101, true, 5291, data}
 	npl := NplData{make([]byte, 4), 0x02, 0x00}
 	packExpected := []byte{126, 126, 34, 0, 2, 0, 164, 175, 2, 0, 0, 0, 0, 0, 0,
@@ -177,7 +178,7 @@ func ndtpFuel8Several() *Packet {
 		8, 0, 0, 10, 0, 0, 0, 0,
 		8, 0, 0, 0, 0, 20, 0, 0,
 		8, 0, 0, 0, 0, 50, 0, 0}
-	return &Packet{&npl, &nph, packExpected}
+	return &Packet{Npl: &npl, Nph: &nph, Packet: packExpected}
 }
 
 func packetFuel10() []byte {
@@ -190,13 +191,13 @@ func packetFuel10() []byte {
 }
 
 func ndtpFuel10() *Packet {
-	data := []Subrecord{&FuelData{1, 10}}
+	data := []Subrecord{&FuelData{Type: 1, Fuel: 10}}
 	nph := Nph{1, 101, true, 5291, data}
 	npl := NplData{make([]byte, 4), 0x02, 0x00}
 	packExpected := []byte{126, 126, 49, 0, 2, 0, 180, 85, 2, 0, 0, 0, 0, 0, 0,
 		1, 0, 101, 0, 1, 0, 171, 20, 0, 0,
 		10, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 10, 128, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
-	return &Packet{&npl, &nph, packExpected}
+	return &Packet{Npl: &npl, Nph: &nph, Packet: packExpected}
 }
 
 func packetFuel10Several() []byte {
@@ -211,9 +212,9 @@ func packetFuel10Several() []byte {
 }
 
 func ndtpFuel10Several() *Packet {
-	data := []Subrecord{&FuelData{1, 10},
-		&FuelData{2, 20},
-		&FuelData{1, 50}}
+	data := []Subrecord{&FuelData{Type: 1, Fuel: 10},
+		&FuelData{Type: 2, Fuel: 20},
+		&FuelData{Type: 1, Fuel: 50}}
 	nph := Nph{1, 101, true, 5291, data}
 	npl := NplData{make([]byte, 4), 0x02, 0x00}
 	packExpected := []byte{126, 126, 127, 0, 2, 0, 161, 87, 2, 0, 0, 0, 0, 0, 0,
@@ -221,7 +222,7 @@ func ndtpFuel10Several() *Packet {
 		10, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 10, 128, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
 		10, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 20, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
 		10, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 50, 128, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
-	return &Packet{&npl, &nph, packExpected}
+	return &Packet{Npl: &npl, Nph: &nph, Packet: packExpected}
 }
 
 func packetFuel8And10Several() []byte {
@@ -239,12 +240,12 @@ func packetFuel8And10Several() []byte {
 }
 
 func ndtpFuel8And10Several() *Packet {
-	data := []Subrecord{&FuelData{0, 10},
-		&FuelData{2, 20},
-		&FuelData{2, 50},
-		&FuelData{1, 10},
-		&FuelData{2, 20},
-		&FuelData{1, 50}}
+	data := []Subrecord{&FuelData{Type: 0, Fuel: 10, LevelMm: 10},
+		&FuelData{Type: 2, Fuel: 20, LevelL: 20},
+		&FuelData{Type: 2, Fuel: 50, LevelL: 50},
+		&FuelData{Type: 1, Fuel: 10},
+		&FuelData{Type: 2, Fuel: 20},
+		&FuelData{Type: 1, Fuel: 50}}
 	nph := Nph{1, 101, true, 5291, data}
 	npl := NplData{make([]byte, 4), 0x02, 0x00}
 	packExpected := []byte{126, 126, 151, 0, 2, 0, 185, 137, 2, 0, 0, 0, 0, 0, 0,
@@ -255,7 +256,7 @@ func ndtpFuel8And10Several() *Packet {
 		10, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 10, 128, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
 		10, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 20, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
 		10, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 50, 128, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
-	return &Packet{&npl, &nph, packExpected}
+	return &Packet{Npl: &npl, Nph: &nph, Packet: packExpected}
 }
 
 func packetNavFuel8And10Several() []byte {
@@ -275,12 +276,12 @@ func packetNavFuel8And10Several() []byte {
 
 func ndtpNavFuel8And10Several() *Packet {
 	data := []Subrecord{&NavData{1522961700, 37.6925783, 55.7890249, 339, 0, false, 1, 1, true},
-		&FuelData{0, 10},
-		&FuelData{2, 20},
-		&FuelData{2, 50},
-		&FuelData{1, 10},
-		&FuelData{2, 20},
-		&FuelData{1, 50}}
+		&FuelData{Type: 0, Fuel: 10, LevelMm: 10},
+		&FuelData{Type: 2, Fuel: 20, LevelL: 20},
+		&FuelData{Type: 2, Fuel: 50, LevelL: 50},
+		&FuelData{Type: 1, Fuel: 10},
+		&FuelData{Type: 2, Fuel: 20},
+		&FuelData{Type: 1, Fuel: 50}}
 	nph := Nph{1, 101, true, 5291, data}
 	npl := NplData{make([]byte, 4), 0x02, 0x00}
 	packExpected := []byte{126, 126, 179, 0, 2, 0, 255, 177, 2, 0, 0, 0, 0, 0, 0,
@@ -292,7 +293,7 @@ func ndtpNavFuel8And10Several() *Packet {
 		10, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 10, 128, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
 		10, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 20, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
 		10, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 50, 128, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
-	return &Packet{&npl, &nph, packExpected}
+	return &Packet{Npl: &npl, Nph: &nph, Packet: packExpected}
 }
 
 func TestSimpleParse(t *testing.T) {
@@ -363,4 +364,108 @@ func TestMakeReply(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+func TestPacket_Form(t *testing.T) {
+	tests := []struct {
+		name       string
+		packetData *Packet
+		want       []byte
+		wantErr    bool
+	}{
+		{"fuel8Several", ndtpFuel8Several(), ndtpFuel8Several().Packet, false},
+		{"fuel10", ndtpFuel10(), ndtpFuel10().Packet, false},
+		{"extResult", ndtpExtResult(), packetExtResult(), false},
+		{"connRequest", NewConnRequest(1024), connRequest(1024), false},
+		{"incorrectData", &Packet{Npl: new(NplData), Nph: &Nph{ServiceID: NphSrvNavdata, PacketType: nphSndRealtime}}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.packetData.Form()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Form() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Form() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPacket_ParseCopies(t *testing.T) {
+	message := append(packetNav(), 1, 2, 3)
+	packet := new(Packet)
+	if _, err := packet.Parse(message); err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	want := ndtpNav()
+	// caller reuses its buffer
+	for i := range message {
+		message[i] = 0
+	}
+	if !bytes.Equal(packet.Packet, want.Packet) || !bytes.Equal(packet.Npl.PeerAddress, want.Npl.PeerAddress) {
+		t.Errorf("Parse() result references message: Packet %v", packet.Packet)
+	}
+}
+
+func TestPacket_ParseInto(t *testing.T) {
+	tests := []struct {
+		name     string
+		message  []byte
+		wantNDTP *Packet
+	}{
+		{"navigation", packetNav(), ndtpNav()},
+		{"fuel8Several", packetFuel8Several(), ndtpFuel8Several()},
+		{"extTitle", packetExtTitle(), ndtpExtTitle()},
+		{"navFuel8And10Several", packetNavFuel8And10Several(), ndtpNavFuel8And10Several()},
+		{"fuel10", packetFuel10(), ndtpFuel10()},
+		{"navigationAgain", packetNav(), ndtpNav()},
+	}
+	ndtp := new(Packet)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ndtp.ParseInto(tt.message); err != nil {
+				t.Fatalf("ParseInto() error = %v", err)
+			}
+			got := &Packet{Npl: ndtp.Npl, Nph: ndtp.Nph, Packet: ndtp.Packet}
+			if !reflect.DeepEqual(got, tt.wantNDTP) {
+				t.Error("\ngot     ", got, "\nexpected", tt.wantNDTP)
+			}
+		})
+	}
+}
+
+func TestPacket_ParseIntoAllocs(t *testing.T) {
+	message := packetNavFuel8And10Several()
+	ndtp := new(Packet)
+	allocs := testing.AllocsPerRun(100, func() {
+		if _, err := ndtp.ParseInto(message); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("ParseInto() allocs = %v, want 0", allocs)
+	}
+}
+
+func BenchmarkPacket_Parse(b *testing.B) {
+	message := packetNavFuel8And10Several()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		ndtp := new(Packet)
+		if _, err := ndtp.Parse(message); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkPacket_ParseInto(b *testing.B) {
+	message := packetNavFuel8And10Several()
+	ndtp := new(Packet)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := ndtp.ParseInto(message); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
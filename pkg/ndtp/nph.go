@@ -32,6 +32,7 @@ type Nph struct {
 // Subrecord is an interface for data that can be converted into general.Subrecord
 type Subrecord interface {
 	toGeneral() general.Subrecord
+	form() []byte
 }
 
 func (nph *Nph) String() string {
@@ -77,7 +78,10 @@ func (nph *Nph) packetType() (ptype string) {
 	return
 }
 
-func (nph *Nph) parse(message []byte) (err error) {
+func (nph *Nph) parse(message []byte, st *storage) (err error) {
+	if len(message) < nphHeaderLen {
+		return errors.New("NPH is too short")
+	}
 	nph.ServiceID = binary.LittleEndian.Uint16(message[:2])
 	nph.PacketType = binary.LittleEndian.Uint16(message[2:4])
 	if binary.LittleEndian.Uint16(message[4:6]) == 1 {
@@ -85,14 +89,17 @@ func (nph *Nph) parse(message []byte) (err error) {
 	}
 	nph.ReqID = binary.LittleEndian.Uint32(message[6:10])
 	if nph.isResult() {
+		if len(message) < nphHeaderLen+4 {
+			return errors.New("NPH_RESULT is too short")
+		}
 		nph.Data = binary.LittleEndian.Uint32(message[nphHeaderLen : nphHeaderLen+4])
 		return
 	}
 	switch nph.service() {
 	case NphSrvGenericControls:
-		nph.parseGenControl(message[nphHeaderLen:])
+		err = nph.parseGenControl(message[nphHeaderLen:])
 	case NphSrvNavdata:
-		err = nph.parseNavData(message[nphHeaderLen:])
+		err = nph.parseNavData(message[nphHeaderLen:], st)
 	case NphSrvExternalDevice:
 		err = nph.parseExtDevice(message[nphHeaderLen:])
 	default:
@@ -101,15 +108,74 @@ func (nph *Nph) parse(message []byte) (err error) {
 	return
 }
 
-func (nph *Nph) parseNavData(message []byte) (err error) {
+func (nph *Nph) form() (message []byte, err error) {
+	message = make([]byte, nphHeaderLen)
+	binary.LittleEndian.PutUint16(message[:2], nph.ServiceID)
+	binary.LittleEndian.PutUint16(message[2:4], nph.PacketType)
+	if nph.RequestFlag {
+		binary.LittleEndian.PutUint16(message[4:6], 1)
+	}
+	binary.LittleEndian.PutUint32(message[6:10], nph.ReqID)
+	if nph.isResult() {
+		result, ok := nph.Data.(uint32)
+		if !ok {
+			return nil, fmt.Errorf("incorrect NPH_RESULT data type %T", nph.Data)
+		}
+		message = append(message, 0, 0, 0, 0)
+		binary.LittleEndian.PutUint32(message[nphHeaderLen:], result)
+		return message, nil
+	}
+	switch nph.service() {
+	case NphSrvGenericControls:
+		return nph.formGenControl(message)
+	case NphSrvNavdata:
+		return nph.formNavData(message)
+	case NphSrvExternalDevice:
+		ext, ok := nph.Data.(*ExtDevice)
+		if !ok {
+			return nil, fmt.Errorf("incorrect %s data type %T", nph.packetType(), nph.Data)
+		}
+		return ext.form(nph.packetType(), message)
+	}
+	return nil, errors.New("unknown service")
+}
+
+func (nph *Nph) formGenControl(message []byte) ([]byte, error) {
+	if nph.packetType() != NphSgsConnRequest {
+		return nil, fmt.Errorf("generic controls packet type %d not implemented", nph.PacketType)
+	}
+	id, ok := nph.Data.(uint32)
+	if !ok {
+		return nil, fmt.Errorf("incorrect %s data type %T", NphSgsConnRequest, nph.Data)
+	}
+	body := make([]byte, connRequestLen)
+	binary.LittleEndian.PutUint16(body[0:2], protoVersionHigh)
+	binary.LittleEndian.PutUint16(body[2:4], protoVersionLow)
+	binary.LittleEndian.PutUint32(body[6:10], id)
+	binary.LittleEndian.PutUint16(body[10:12], maxPacketSize)
+	return append(message, body...), nil
+}
+
+func (nph *Nph) formNavData(message []byte) ([]byte, error) {
+	cells, ok := nph.Data.([]Subrecord)
+	if !ok {
+		return nil, fmt.Errorf("incorrect navigation data type %T", nph.Data)
+	}
+	for _, cell := range cells {
+		message = append(message, cell.form()...)
+	}
+	return message, nil
+}
+
+func (nph *Nph) parseNavData(message []byte, st *storage) (err error) {
 	cellStart := 0
-	allData := make([]Subrecord, 0, 1)
+	allData := st.newCells()
 	for cellStart < len(message) {
 		cellType := message[cellStart]
 		switch cellType {
 		case cellTypeNav:
 			if len(message[cellStart:]) >= lenCells[cellTypeNav] {
-				data := new(NavData)
+				data := st.newNavData()
 				data.parse(message[cellStart:])
 				allData = append(allData, data)
 				cellStart = cellStart + lenCells[cellTypeNav]
@@ -119,7 +185,7 @@ func (nph *Nph) parseNavData(message []byte) (err error) {
 			}
 		case cellTypeUziM:
 			if len(message[cellStart:]) >= lenCells[cellTypeUziM] {
-				data := new(FuelData)
+				data := st.newFuelData()
 				data.parseUziM(message[cellStart:])
 				allData = append(allData, data)
 				cellStart = cellStart + lenCells[cellTypeUziM]
@@ -129,7 +195,7 @@ func (nph *Nph) parseNavData(message []byte) (err error) {
 			}
 		case cellTypeM333:
 			if len(message[cellStart:]) >= lenCells[cellTypeM333] {
-				data := new(FuelData)
+				data := st.newFuelData()
 				data.parseM333(message[cellStart:])
 				allData = append(allData, data)
 				cellStart = cellStart + lenCells[cellTypeM333]
@@ -145,14 +211,18 @@ func (nph *Nph) parseNavData(message []byte) (err error) {
 			}
 		}
 	}
-	nph.Data = allData
+	nph.Data = st.cellsInterface(allData)
 	return
 }
 
-func (nph *Nph) parseGenControl(message []byte) {
+func (nph *Nph) parseGenControl(message []byte) error {
 	if nph.packetType() == NphSgsConnRequest {
+		if len(message) < 10 {
+			return errors.New("NPH_SGC_CONN_REQUEST is too short")
+		}
 		nph.Data = binary.LittleEndian.Uint32(message[6:10])
 	}
+	return nil
 }
 
 func (nph *Nph) parseExtDevice(message []byte) (err error) {
@@ -7,17 +7,23 @@ import (
 
 // ExtDevice describes information of NPH_SRV_EXTERNAL_DEVICE service
 type ExtDevice struct {
-	MesID   uint16
-	PackNum uint16
-	Res     uint32
+	MesID   uint16 `json:"mes_id"`
+	PackNum uint16 `json:"pack_num"`
+	Res     uint32 `json:"res"`
 }
 
 func (ext *ExtDevice) parse(packetType string, message []byte) (err error) {
 	switch packetType {
 	case NphSedDeviceTitleData:
+		if len(message) < 4 {
+			return fmt.Errorf("%s is too short", packetType)
+		}
 		ext.MesID = binary.LittleEndian.Uint16(message[:2])
 		ext.PackNum = binary.LittleEndian.Uint16(message[2:4])
 	case NphSedDeviceResult:
+		if len(message) < 8 {
+			return fmt.Errorf("%s is too short", packetType)
+		}
 		ext.PackNum = binary.LittleEndian.Uint16(message[:2])
 		ext.Res = binary.LittleEndian.Uint32(message[2:6])
 		ext.MesID = binary.LittleEndian.Uint16(message[6:8])
@@ -27,6 +33,23 @@ func (ext *ExtDevice) parse(packetType string, message []byte) (err error) {
 	return
 }
 
+func (ext *ExtDevice) form(packetType string, message []byte) ([]byte, error) {
+	switch packetType {
+	case NphSedDeviceTitleData:
+		body := make([]byte, 4)
+		binary.LittleEndian.PutUint16(body[:2], ext.MesID)
+		binary.LittleEndian.PutUint16(body[2:4], ext.PackNum)
+		return append(message, body...), nil
+	case NphSedDeviceResult:
+		body := make([]byte, 8)
+		binary.LittleEndian.PutUint16(body[:2], ext.PackNum)
+		binary.LittleEndian.PutUint32(body[2:6], ext.Res)
+		binary.LittleEndian.PutUint16(body[6:8], ext.MesID)
+		return append(message, body...), nil
+	}
+	return nil, fmt.Errorf("formExtDevice unknown NPHType: %s", packetType)
+}
+
 func (ext *ExtDevice) reply(packet []byte, result uint32) []byte {
 	reply := make([]byte, ndtpExtResultLen)
 	copy(reply, packet[:nplHeaderLen+nphHeaderLen])
@@ -2,29 +2,38 @@ package ndtp
 
 import (
 	"encoding/binary"
+	"math"
+	"time"
 
 	"github.com/egorban/navprot/pkg/general"
 )
 
+// coordScale is a number of NDTP coordinate units (1e-7 degree) in degree
+const coordScale = 10000000
+
 // NavData describes information of NPH_SRV_NAVDATA service
 type NavData struct {
-	Time    uint32
-	Lon     float64
-	Lat     float64
-	Bearing uint16
-	Speed   uint16
-	Sos     bool
+	Time    uint32          `json:"time"`
+	Lon     general.Degrees `json:"lon"`
+	Lat     general.Degrees `json:"lat"`
+	Bearing uint16          `json:"bearing"`
+	// Speed is formed rounded to km/h
+	Speed general.KmH `json:"speed"`
+	Sos   bool        `json:"sos"`
 	// 0 - W; 1 - E
-	Lohs int8
+	Lohs int8 `json:"lohs"`
 	// 0 - S; 1 - N
-	Lahs  int8
-	Valid bool
+	Lahs  int8 `json:"lahs"`
+	Valid bool `json:"valid"`
 }
 
 // FuelData contains information about fuel level
 type FuelData struct {
-	Type byte
-	Fuel uint16
+	Type byte   `json:"type"`
+	Fuel uint16 `json:"fuel"`
+	// Levels in mm and liters received in UziM cell, both are formed if not zero
+	LevelMm uint16 `json:"level_mm"`
+	LevelL  uint16 `json:"level_l"`
 }
 
 func (data *NavData) parse(message []byte) {
@@ -40,15 +49,38 @@ func (data *NavData) parse(message []byte) {
 	if message[14]&32 != 0 {
 		data.Lahs = 1
 	}
-	data.Lon = float64((2*int(data.Lohs)-1)*int(lon)) / 10000000.0
-	data.Lat = float64((2*int(data.Lahs)-1)*int(lat)) / 10000000.0
+	data.Lon = general.Degrees((2*int(data.Lohs)-1)*int(lon)) / coordScale
+	data.Lat = general.Degrees((2*int(data.Lahs)-1)*int(lat)) / coordScale
 	if message[14]&4 != 0 {
 		data.Sos = true
 	}
-	data.Speed = binary.LittleEndian.Uint16(message[16:18])
+	data.Speed = general.KmH(binary.LittleEndian.Uint16(message[16:18]))
 	data.Bearing = binary.LittleEndian.Uint16(message[20:22])
 }
 
+func (data *NavData) form() []byte {
+	cell := make([]byte, lenCells[cellTypeNav])
+	cell[0] = cellTypeNav
+	binary.LittleEndian.PutUint32(cell[2:6], data.Time)
+	binary.LittleEndian.PutUint32(cell[6:10], uint32(math.Round(math.Abs(float64(data.Lon*coordScale)))))
+	binary.LittleEndian.PutUint32(cell[10:14], uint32(math.Round(math.Abs(float64(data.Lat*coordScale)))))
+	if data.Valid {
+		cell[14] |= 128
+	}
+	if data.Lon >= 0 {
+		cell[14] |= 64
+	}
+	if data.Lat >= 0 {
+		cell[14] |= 32
+	}
+	if data.Sos {
+		cell[14] |= 4
+	}
+	binary.LittleEndian.PutUint16(cell[16:18], uint16(math.Round(float64(data.Speed))))
+	binary.LittleEndian.PutUint16(cell[20:22], data.Bearing)
+	return cell
+}
+
 func (data *NavData) toGeneral() general.Subrecord {
 	gen := &general.NavData{
 		Time:    data.Time,
@@ -59,6 +91,7 @@ func (data *NavData) toGeneral() general.Subrecord {
 		Valid:   data.Valid,
 	}
 	if data.Sos {
+		gen.Sos = true
 		gen.Source = 13
 	}
 	return gen
@@ -68,6 +101,8 @@ func (data *FuelData) parseUziM(message []byte) {
 	levelMm := binary.LittleEndian.Uint16(message[3:5])
 	levelL := binary.LittleEndian.Uint16(message[5:7])
 	if message[2] == 0 {
+		data.LevelMm = levelMm
+		data.LevelL = levelL
 		if levelL > 0 {
 			data.Type = 2
 			data.Fuel = levelL
@@ -90,6 +125,36 @@ func (data *FuelData) parseM333(message []byte) {
 	}
 }
 
+func (data *FuelData) form() []byte {
+	if data.Type == 1 {
+		return data.formM333()
+	}
+	return data.formUziM()
+}
+
+func (data *FuelData) formUziM() []byte {
+	cell := make([]byte, lenCells[cellTypeUziM])
+	cell[0] = cellTypeUziM
+	binary.LittleEndian.PutUint16(cell[3:5], data.LevelMm)
+	binary.LittleEndian.PutUint16(cell[5:7], data.LevelL)
+	switch data.Type {
+	case 0:
+		binary.LittleEndian.PutUint16(cell[3:5], data.Fuel)
+	case 2:
+		binary.LittleEndian.PutUint16(cell[5:7], data.Fuel)
+	default:
+		cell[2] = 1
+	}
+	return cell
+}
+
+func (data *FuelData) formM333() []byte {
+	cell := make([]byte, lenCells[cellTypeM333])
+	cell[0] = cellTypeM333
+	binary.LittleEndian.PutUint16(cell[18:20], data.Fuel&0x7fff|0x8000)
+	return cell
+}
+
 func (data *FuelData) toGeneral() general.Subrecord {
 	gen := &general.FuelData{
 		Type: data.Type,
@@ -97,3 +162,14 @@ func (data *FuelData) toGeneral() general.Subrecord {
 	}
 	return gen
 }
+
+// GetTime returns Time as time.Time in UTC
+func (data *NavData) GetTime() time.Time {
+	return general.FromSeconds(general.UnixEpoch, data.Time)
+}
+
+// SetTime sets Time to t. general.ErrTimeOutOfRange is returned, if t is before 1970 or after 2106.
+func (data *NavData) SetTime(t time.Time) (err error) {
+	data.Time, err = general.Seconds(general.UnixEpoch, t)
+	return
+}
@@ -9,9 +9,21 @@ import (
 
 // NplData describes transport layer of NDTP protocol
 type NplData struct {
-	PeerAddress []byte
-	DataType    byte
-	ReqID       uint16
+	PeerAddress []byte `json:"peer_address"`
+	DataType    byte   `json:"data_type"`
+	ReqID       uint16 `json:"req_id"`
+}
+
+func (npl *NplData) form(nph []byte) []byte {
+	packet := make([]byte, nplHeaderLen, nplHeaderLen+len(nph))
+	copy(packet, nplSignature)
+	binary.LittleEndian.PutUint16(packet[2:4], uint16(len(nph)))
+	binary.LittleEndian.PutUint16(packet[4:6], nplFlagCrc)
+	binary.BigEndian.PutUint16(packet[6:8], crc16(nph))
+	packet[8] = npl.DataType
+	copy(packet[9:13], npl.PeerAddress)
+	binary.LittleEndian.PutUint16(packet[13:15], npl.ReqID)
+	return append(packet, nph...)
 }
 
 func (npl *NplData) String() string {
@@ -21,17 +33,15 @@ func (npl *NplData) String() string {
 	return fmt.Sprintf("NPL: %+v;", *npl)
 }
 
-func parseNPL(message []byte) (npl *NplData, packet, restBuf []byte, err error) {
+func parseNPL(message []byte, npl *NplData) (*NplData, []byte, []byte, error) {
 	first, last, restBuf, err := checkPacket(message)
 	if err != nil {
-		return
+		return nil, nil, restBuf, err
 	}
-	npl = new(NplData)
 	npl.DataType = message[first+8]
 	npl.ReqID = binary.LittleEndian.Uint16(message[first+13 : first+15])
 	npl.PeerAddress = message[first+9 : first+13]
-	packet = message[first:last]
-	return
+	return npl, message[first:last], restBuf, nil
 }
 
 func simpleParseNPL(message []byte) (packet []byte, restBuf []byte, err error) {
@@ -43,7 +53,7 @@ func simpleParseNPL(message []byte) (packet []byte, restBuf []byte, err error) {
 	return message[first:last], message[last:], nil
 }
 
-func checkPacket(message []byte) (first, last int, rest []byte, err error){
+func checkPacket(message []byte) (first, last int, rest []byte, err error) {
 	first = bytes.Index(message, nplSignature)
 	if first == -1 {
 		err = errors.New("nplData signature not found")
@@ -62,11 +72,12 @@ func checkPacket(message []byte) (first, last int, rest []byte, err error){
 		return
 	}
 	last = first + nplHeaderLen + dataLen
-	if binary.LittleEndian.Uint16(message[first+4:first+6])&2 != 0 {
+	if binary.LittleEndian.Uint16(message[first+4:first+6])&nplFlagCrc != 0 {
 		crcHead := binary.BigEndian.Uint16(message[first+6 : first+8])
 		crcCalc := crc16(message[first+nplHeaderLen : last])
 		if crcHead != crcCalc {
 			err = fmt.Errorf("crc incorrect: calc %d; receive: %d", crcCalc, crcHead)
+			rest = message[first+1:]
 			return
 		}
 	}
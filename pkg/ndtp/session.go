@@ -0,0 +1,173 @@
+package ndtp
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrSessionClosed is returned by Session methods after Close
+	ErrSessionClosed = errors.New("ndtp session is closed")
+	// ErrIdleTimeout means that no data was received from terminal during Session.IdleTimeout
+	ErrIdleTimeout = errors.New("ndtp session idle timeout")
+)
+
+// Handler processes packets received by Session. id is terminal ID from NPH_SGC_CONN_REQUEST.
+// Returned value is used as result code of reply, if packet needs reply.
+type Handler func(id int, packet *Packet) uint32
+
+// Session serves NDTP connection of one terminal: it waits for NPH_SGC_CONN_REQUEST,
+// replies to requests and delivers parsed packets to handler.
+type Session struct {
+	// IdleTimeout is max time to wait for the next packet, 0 means no timeout
+	IdleTimeout time.Duration
+
+	conn     net.Conn
+	handler  Handler
+	mu       sync.Mutex
+	writeMu  sync.Mutex
+	id       int
+	hasID    bool
+	nplReqID uint16
+	nphReqID uint32
+	closed   bool
+}
+
+// NewSession creates Session for conn. Packets are delivered to handler.
+func NewSession(conn net.Conn, handler Handler) *Session {
+	return &Session{conn: conn, handler: handler}
+}
+
+// Serve reads packets from connection until it is closed. Serve always closes connection.
+// It returns nil after Close or when terminal closes connection.
+func (s *Session) Serve() error {
+	defer s.conn.Close()
+	decoder := NewDecoder(s.conn)
+	for {
+		if closed := s.prepareRead(); closed {
+			return nil
+		}
+		packet, err := decoder.Decode()
+		if err == ErrCRC || err == ErrPacketTooLarge {
+			continue
+		}
+		if packet == nil {
+			return s.readError(err)
+		}
+		if err = s.process(packet, err); err != nil {
+			return s.readError(err)
+		}
+	}
+}
+
+// ID returns terminal ID. ok is false until NPH_SGC_CONN_REQUEST is received.
+func (s *Session) ID() (id int, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.id, s.hasID
+}
+
+// Send sets next NPL and NPH request IDs in packet and sends it to terminal.
+// It returns NPH request ID, which can be used to match NPH_RESULT.
+func (s *Session) Send(packet []byte) (nphReqID uint32, err error) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return 0, ErrSessionClosed
+	}
+	s.nplReqID++
+	s.nphReqID++
+	nphReqID = s.nphReqID
+	changes := map[string]int{NplReqID: int(s.nplReqID), NphReqID: int(nphReqID)}
+	s.mu.Unlock()
+	err = s.write(Change(packet, changes))
+	return
+}
+
+// Close stops Serve after processing of the current packet and closes connection.
+func (s *Session) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrSessionClosed
+	}
+	s.closed = true
+	return s.conn.SetReadDeadline(time.Now())
+}
+
+func (s *Session) prepareRead() (closed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed && s.IdleTimeout > 0 {
+		s.conn.SetReadDeadline(time.Now().Add(s.IdleTimeout))
+	}
+	return s.closed
+}
+
+func (s *Session) process(packet *Packet, parseErr error) error {
+	s.mu.Lock()
+	id, hasID := s.id, s.hasID
+	s.mu.Unlock()
+	if parseErr != nil {
+		return s.reply(packet, resultForError(packet))
+	}
+	if packet.IsResult() {
+		if hasID {
+			s.handler(id, packet)
+		}
+		return nil
+	}
+	if packet.PacketType() == NphSgsConnRequest {
+		id, _ = packet.GetID()
+		s.mu.Lock()
+		s.id, s.hasID = id, true
+		s.mu.Unlock()
+	} else if !hasID {
+		return s.reply(packet, NphResultPacketUnexpected)
+	}
+	return s.reply(packet, s.handler(id, packet))
+}
+
+func (s *Session) reply(packet *Packet, result uint32) (err error) {
+	if !packet.NeedReply() {
+		return nil
+	}
+	reply, err := packet.ReplyExt(result)
+	if err != nil {
+		reply = packet.Reply(result)
+	}
+	return s.write(reply)
+}
+
+func (s *Session) write(data []byte) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	_, err := s.conn.Write(data)
+	return err
+}
+
+func (s *Session) readError(err error) error {
+	s.mu.Lock()
+	closed := s.closed
+	s.closed = true
+	s.mu.Unlock()
+	if closed || err == io.EOF {
+		return nil
+	}
+	if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		return ErrIdleTimeout
+	}
+	return err
+}
+
+func resultForError(packet *Packet) uint32 {
+	switch packet.Service() {
+	case NphSrvGenericControls, NphSrvNavdata, NphSrvExternalDevice:
+		return NphResultPacketInvalidFormat
+	default:
+		return NphResultServiceNotSupported
+	}
+}
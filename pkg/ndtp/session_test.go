@@ -0,0 +1,95 @@
+package ndtp
+
+import (
+	"encoding/binary"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSession_Serve(t *testing.T) {
+	tests := []struct {
+		name        string
+		packets     [][]byte
+		wantResults []uint32
+		wantHandled []string
+	}{
+		{"connRequestAndNav", [][]byte{connRequest(1024), ndtpNav().Packet},
+			[]uint32{NphResultOk, NphResultOk}, []string{NphSgsConnRequest, NphSndRealtime}},
+		{"navBeforeConnRequest", [][]byte{ndtpNav().Packet, connRequest(1024)},
+			[]uint32{NphResultPacketUnexpected, NphResultOk}, []string{NphSgsConnRequest}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			var handled []string
+			session := NewSession(server, func(id int, packet *Packet) uint32 {
+				if id != 1024 {
+					t.Errorf("handler id = %d, want 1024", id)
+				}
+				handled = append(handled, packet.PacketType())
+				return NphResultOk
+			})
+			session.IdleTimeout = time.Second
+			served := make(chan error)
+			go func() { served <- session.Serve() }()
+			var results []uint32
+			for _, packet := range tt.packets {
+				if _, err := client.Write(packet); err != nil {
+					t.Fatal(err)
+				}
+				reply := new(Packet)
+				buf := make([]byte, 1024)
+				n, err := client.Read(buf)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err = reply.Parse(buf[:n]); err != nil {
+					t.Fatal(err)
+				}
+				results = append(results, reply.Nph.Data.(uint32))
+			}
+			if id, ok := session.ID(); !ok || id != 1024 {
+				t.Errorf("ID() = %d, %t; want 1024, true", id, ok)
+			}
+			session.Close()
+			if err := <-served; err != nil {
+				t.Errorf("Serve() error = %v", err)
+			}
+			if !reflect.DeepEqual(results, tt.wantResults) {
+				t.Errorf("results = %v, want %v", results, tt.wantResults)
+			}
+			if !reflect.DeepEqual(handled, tt.wantHandled) {
+				t.Errorf("handled = %v, want %v", handled, tt.wantHandled)
+			}
+		})
+	}
+}
+
+func TestSession_IdleTimeout(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	session := NewSession(server, func(int, *Packet) uint32 { return NphResultOk })
+	session.IdleTimeout = 20 * time.Millisecond
+	if err := session.Serve(); err != ErrIdleTimeout {
+		t.Errorf("Serve() error = %v, want %v", err, ErrIdleTimeout)
+	}
+}
+
+func connRequest(id uint32) []byte {
+	packet := make([]byte, nplHeaderLen+nphHeaderLen+12)
+	copy(packet, nplSignature)
+	binary.LittleEndian.PutUint16(packet[2:4], uint16(len(packet)-nplHeaderLen))
+	binary.LittleEndian.PutUint16(packet[4:6], 2)
+	packet[8] = 2
+	nph := packet[nplHeaderLen:]
+	binary.LittleEndian.PutUint16(nph[2:4], nphSgcConnRequest)
+	binary.LittleEndian.PutUint16(nph[4:6], 1)
+	binary.LittleEndian.PutUint16(nph[nphHeaderLen:nphHeaderLen+2], 6)
+	binary.LittleEndian.PutUint16(nph[nphHeaderLen+2:nphHeaderLen+4], 2)
+	binary.LittleEndian.PutUint32(nph[nphHeaderLen+6:nphHeaderLen+10], id)
+	binary.LittleEndian.PutUint16(nph[nphHeaderLen+10:nphHeaderLen+12], 1024)
+	binary.BigEndian.PutUint16(packet[6:8], crc16(nph))
+	return packet
+}
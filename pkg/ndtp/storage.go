@@ -0,0 +1,82 @@
+package ndtp
+
+// storage keeps memory of parsed packet for reuse by Packet.ParseInto.
+// Methods of nil storage allocate new objects.
+type storage struct {
+	npl   NplData
+	nph   Nph
+	nav   []NavData
+	fuel  []FuelData
+	cells []Subrecord
+	// cellsData is the last []Subrecord stored in interface, it's reused to avoid allocation
+	cellsData interface{}
+}
+
+func (st *storage) reset() {
+	st.nav = st.nav[:0]
+	st.fuel = st.fuel[:0]
+}
+
+func (st *storage) newNpl() *NplData {
+	if st == nil {
+		return new(NplData)
+	}
+	st.npl = NplData{}
+	return &st.npl
+}
+
+func (st *storage) newNph() *Nph {
+	if st == nil {
+		return new(Nph)
+	}
+	st.nph = Nph{}
+	return &st.nph
+}
+
+// Slices are not copied on growth, so pointers returned earlier stay valid.
+func (st *storage) newNavData() *NavData {
+	if st == nil {
+		return new(NavData)
+	}
+	if len(st.nav) == cap(st.nav) {
+		st.nav = make([]NavData, 0, 2*cap(st.nav)+1)
+	}
+	st.nav = st.nav[:len(st.nav)+1]
+	data := &st.nav[len(st.nav)-1]
+	*data = NavData{}
+	return data
+}
+
+func (st *storage) newFuelData() *FuelData {
+	if st == nil {
+		return new(FuelData)
+	}
+	if len(st.fuel) == cap(st.fuel) {
+		st.fuel = make([]FuelData, 0, 2*cap(st.fuel)+1)
+	}
+	st.fuel = st.fuel[:len(st.fuel)+1]
+	data := &st.fuel[len(st.fuel)-1]
+	*data = FuelData{}
+	return data
+}
+
+func (st *storage) newCells() []Subrecord {
+	if st == nil {
+		return make([]Subrecord, 0, 1)
+	}
+	return st.cells[:0]
+}
+
+// cellsInterface returns cells stored in interface
+func (st *storage) cellsInterface(cells []Subrecord) interface{} {
+	if st == nil {
+		return cells
+	}
+	st.cells = cells
+	if prev, ok := st.cellsData.([]Subrecord); ok && len(prev) == len(cells) &&
+		(len(cells) == 0 || &prev[0] == &cells[0]) {
+		return st.cellsData
+	}
+	st.cellsData = cells
+	return st.cellsData
+}
@@ -0,0 +1,140 @@
+package ndtp
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+const (
+	// DefaultReplyTimeout is default time to wait for NPH_RESULT
+	DefaultReplyTimeout = 10 * time.Second
+	// DefaultAttempts is default number of attempts to send packet
+	DefaultAttempts = 3
+)
+
+// ResultError describes NPH_RESULT with unsuccessful result code
+type ResultError struct {
+	Code uint32
+}
+
+func (e *ResultError) Error() string {
+	return fmt.Sprintf("NPH_RESULT %d", e.Code)
+}
+
+// Terminal emulates NDTP terminal: it connects to server, sends NPH_SGC_CONN_REQUEST
+// and navigation data and waits for NPH_RESULT. Terminal is not safe for concurrent use.
+type Terminal struct {
+	// ReplyTimeout is time to wait for NPH_RESULT
+	ReplyTimeout time.Duration
+	// Attempts is number of attempts to send packet
+	Attempts int
+	// DialTimeout is timeout of connecting to server, ReplyTimeout is used if it's zero
+	DialTimeout time.Duration
+
+	addr     string
+	id       uint32
+	conn     net.Conn
+	nplReqID uint16
+	nphReqID uint32
+	decoder  *Decoder
+}
+
+// NewTerminal creates Terminal with specified id, which connects to server with address addr
+func NewTerminal(addr string, id uint32) *Terminal {
+	return &Terminal{
+		ReplyTimeout: DefaultReplyTimeout,
+		Attempts:     DefaultAttempts,
+		addr:         addr,
+		id:           id,
+	}
+}
+
+// Connect connects to server and sends NPH_SGC_CONN_REQUEST
+func (t *Terminal) Connect() error {
+	t.Close()
+	timeout := t.DialTimeout
+	if timeout <= 0 {
+		timeout = t.ReplyTimeout
+	}
+	conn, err := net.DialTimeout("tcp", t.addr, timeout)
+	if err != nil {
+		return err
+	}
+	t.conn = conn
+	t.decoder = NewDecoder(conn)
+	if err = t.exchange(NewConnRequest(t.id)); err != nil {
+		t.Close()
+	}
+	return err
+}
+
+// SendNavData sends NPH_SND_REALTIME or NPH_SND_HISTORY packet with specified cells
+func (t *Terminal) SendNavData(realTime bool, cells []Subrecord) error {
+	return t.Send(NewNavData(realTime, cells))
+}
+
+// Send sets next request IDs in packet, sends it and waits for NPH_RESULT.
+// Packet is sent again on failure, connection is reestablished if it's needed.
+func (t *Terminal) Send(packet *Packet) (err error) {
+	for attempt := 0; attempt < t.Attempts; attempt++ {
+		if t.conn == nil {
+			if err = t.Connect(); err != nil {
+				continue
+			}
+		}
+		if err = t.exchange(packet); err == nil {
+			return
+		}
+		if _, ok := err.(*ResultError); !ok {
+			t.Close()
+		}
+	}
+	return
+}
+
+// Close closes connection with server
+func (t *Terminal) Close() (err error) {
+	if t.conn != nil {
+		err = t.conn.Close()
+		t.conn = nil
+	}
+	return
+}
+
+func (t *Terminal) exchange(packet *Packet) error {
+	t.nplReqID++
+	t.nphReqID++
+	packet.Npl.ReqID = t.nplReqID
+	packet.Nph.ReqID = t.nphReqID
+	data, err := packet.Form()
+	if err != nil {
+		return err
+	}
+	if err = t.conn.SetDeadline(time.Now().Add(t.ReplyTimeout)); err != nil {
+		return err
+	}
+	if _, err = t.conn.Write(data); err != nil {
+		return err
+	}
+	return t.waitResult(packet.Nph.ReqID)
+}
+
+func (t *Terminal) waitResult(reqID uint32) error {
+	for {
+		reply, err := t.decoder.Decode()
+		if err == ErrCRC || err == ErrPacketTooLarge {
+			continue
+		}
+		if reply == nil {
+			return err
+		}
+		if err != nil || !reply.IsResult() || reply.Nph.ReqID != reqID {
+			continue
+		}
+		if code := reply.Nph.Data.(uint32); code != NphResultOk {
+			return &ResultError{Code: code}
+		}
+		return nil
+	}
+}
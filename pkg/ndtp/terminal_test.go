@@ -0,0 +1,82 @@
+package ndtp
+
+import (
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/egorban/navprot/internal/testserver"
+)
+
+func TestTerminal_SendNavData(t *testing.T) {
+	tests := []struct {
+		name       string
+		results    []uint32
+		wantErr    bool
+		wantCalls  int
+		wantPacket []string
+	}{
+		{"ok", []uint32{NphResultOk}, false, 1, []string{NphSgsConnRequest, NphSndHistory}},
+		{"retry", []uint32{NphResultServiceNotSupported, NphResultOk}, false, 2,
+			[]string{NphSgsConnRequest, NphSndHistory, NphSndHistory}},
+		{"failed", []uint32{NphResultServiceNotSupported}, true, 3,
+			[]string{NphSgsConnRequest, NphSndHistory, NphSndHistory, NphSndHistory}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var received []string
+			var cells []Subrecord
+			calls := 0
+			addr, stop := serveSessions(t, func(id int, packet *Packet) uint32 {
+				mu.Lock()
+				defer mu.Unlock()
+				received = append(received, packet.PacketType())
+				if packet.Service() != NphSrvNavdata {
+					return NphResultOk
+				}
+				cells = packet.Nph.Data.([]Subrecord)
+				calls++
+				if calls <= len(tt.results) {
+					return tt.results[calls-1]
+				}
+				return tt.results[len(tt.results)-1]
+			})
+			defer stop()
+			terminal := NewTerminal(addr, 1024)
+			terminal.ReplyTimeout = time.Second
+			defer terminal.Close()
+			sent := []Subrecord{&NavData{Time: 1522961700, Lon: 37.6925783, Lat: 55.7890249, Bearing: 339,
+				Lohs: 1, Lahs: 1, Valid: true}, &FuelData{Type: 2, Fuel: 20, LevelL: 20}}
+			err := terminal.SendNavData(false, sent)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SendNavData() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if calls != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", calls, tt.wantCalls)
+			}
+			if !reflect.DeepEqual(received, tt.wantPacket) {
+				t.Errorf("received = %v, want %v", received, tt.wantPacket)
+			}
+			if !reflect.DeepEqual(cells, sent) {
+				t.Errorf("cells = %v, want %v", cells, sent)
+			}
+		})
+	}
+}
+
+func serveSessions(t *testing.T, handler Handler) (addr string, stop func()) {
+	ln := testserver.Listen(t, "127.0.0.1:0", func(conn net.Conn) {
+		NewSession(conn, func(id int, packet *Packet) uint32 {
+			if id != 1024 {
+				t.Errorf("handler id = %d, want 1024", id)
+			}
+			return handler(id, packet)
+		}).Serve()
+	})
+	return ln.Addr().String(), func() { ln.Close() }
+}
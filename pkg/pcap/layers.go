@@ -0,0 +1,157 @@
+package pcap
+
+import (
+	"encoding/binary"
+	"net"
+	"strconv"
+)
+
+const (
+	etherTypeIPv4  = 0x0800
+	etherTypeIPv6  = 0x86dd
+	etherTypeVLAN  = 0x8100
+	etherTypeQinQ  = 0x88a8
+	ipProtoTCP     = 6
+	ipv6HeaderLen  = 40
+	tcpFlagFin     = 0x01
+	tcpFlagSyn     = 0x02
+	tcpFlagRst     = 0x04
+	minTCPHeader   = 20
+	minIPv4Header  = 20
+	ethernetHeader = 14
+	sllHeader      = 16
+)
+
+// Endpoint is IP address and TCP port of connection side
+type Endpoint struct {
+	IP   net.IP
+	Port uint16
+}
+
+func (e Endpoint) String() string {
+	return net.JoinHostPort(e.IP.String(), strconv.Itoa(int(e.Port)))
+}
+
+// segment is TCP segment extracted from captured frame
+type segment struct {
+	src, dst Endpoint
+	seq      uint32
+	flags    byte
+	payload  []byte
+}
+
+// parseFrame extracts TCP segment from frame, ok is false for other frames, IP fragments and truncated frames
+func parseFrame(linkType uint32, data []byte) (seg segment, ok bool) {
+	var etherType uint16
+	switch linkType {
+	case LinkTypeEthernet:
+		if len(data) < ethernetHeader {
+			return
+		}
+		etherType = binary.BigEndian.Uint16(data[12:14])
+		data = data[ethernetHeader:]
+		for (etherType == etherTypeVLAN || etherType == etherTypeQinQ) && len(data) >= 4 {
+			etherType = binary.BigEndian.Uint16(data[2:4])
+			data = data[4:]
+		}
+	case LinkTypeLinuxSLL:
+		if len(data) < sllHeader {
+			return
+		}
+		etherType = binary.BigEndian.Uint16(data[14:16])
+		data = data[sllHeader:]
+	case LinkTypeNull:
+		if len(data) < 4 {
+			return
+		}
+		// address family is stored in byte order of capturing host
+		family := binary.LittleEndian.Uint32(data[:4])
+		if family > 0xffff {
+			family = binary.BigEndian.Uint32(data[:4])
+		}
+		etherType = etherTypeIPv6
+		if family == 2 {
+			etherType = etherTypeIPv4
+		}
+		data = data[4:]
+	case LinkTypeRaw, LinkTypeIPv4, LinkTypeIPv6:
+		if len(data) == 0 {
+			return
+		}
+		etherType = etherTypeIPv6
+		if data[0]>>4 == 4 {
+			etherType = etherTypeIPv4
+		}
+	default:
+		return
+	}
+	switch etherType {
+	case etherTypeIPv4:
+		return parseIPv4(data)
+	case etherTypeIPv6:
+		return parseIPv6(data)
+	}
+	return
+}
+
+func parseIPv4(data []byte) (seg segment, ok bool) {
+	if len(data) < minIPv4Header || data[0]>>4 != 4 {
+		return
+	}
+	headerLen := int(data[0]&0x0f) * 4
+	totalLen := int(binary.BigEndian.Uint16(data[2:4]))
+	fragment := binary.BigEndian.Uint16(data[6:8])
+	if headerLen < minIPv4Header || totalLen < headerLen || len(data) < totalLen ||
+		fragment&0x3fff != 0 || data[9] != ipProtoTCP {
+		return
+	}
+	seg.src.IP = net.IP(data[12:16])
+	seg.dst.IP = net.IP(data[16:20])
+	return parseTCP(data[headerLen:totalLen], seg)
+}
+
+func parseIPv6(data []byte) (seg segment, ok bool) {
+	if len(data) < ipv6HeaderLen || data[0]>>4 != 6 {
+		return
+	}
+	payloadLen := int(binary.BigEndian.Uint16(data[4:6]))
+	if len(data) < ipv6HeaderLen+payloadLen {
+		return
+	}
+	seg.src.IP = net.IP(data[8:24])
+	seg.dst.IP = net.IP(data[24:40])
+	next := data[6]
+	payload := data[ipv6HeaderLen : ipv6HeaderLen+payloadLen]
+	// hop-by-hop, routing and destination options extension headers are skipped
+	for next == 0 || next == 43 || next == 60 {
+		if len(payload) < 8 {
+			return
+		}
+		extLen := 8 + int(payload[1])*8
+		if len(payload) < extLen {
+			return
+		}
+		next = payload[0]
+		payload = payload[extLen:]
+	}
+	if next != ipProtoTCP {
+		return
+	}
+	return parseTCP(payload, seg)
+}
+
+func parseTCP(data []byte, seg segment) (segment, bool) {
+	if len(data) < minTCPHeader {
+		return seg, false
+	}
+	headerLen := int(data[12]>>4) * 4
+	if headerLen < minTCPHeader || len(data) < headerLen {
+		return seg, false
+	}
+	seg.src.Port = binary.BigEndian.Uint16(data[0:2])
+	seg.dst.Port = binary.BigEndian.Uint16(data[2:4])
+	seg.seq = binary.BigEndian.Uint32(data[4:8])
+	seg.flags = data[13]
+	seg.payload = data[headerLen:]
+	return seg, true
+}
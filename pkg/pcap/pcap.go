@@ -0,0 +1,81 @@
+package pcap
+
+import (
+	"io"
+	"sort"
+	"time"
+)
+
+// Packet is NDTP or EGTS packet transmitted in TCP stream
+type Packet struct {
+	// Time is capture time, when the last byte of packet became available in stream
+	Time     time.Time
+	Src, Dst Endpoint
+	// Protocol is ndtp.ProtocolName or egts.ProtocolName
+	Protocol string
+	// Data is binary packet, it's nil if packet can't be framed
+	Data []byte
+	// Parsed is *ndtp.Packet or *egts.Packet, it's nil if packet can't be framed
+	Parsed interface{}
+	// Err is checksum error, parsing error or io.ErrUnexpectedEOF for truncated packet at the end of stream
+	Err error
+}
+
+// ReadStreams reads all frames of capture and reassembles TCP streams. Truncated last frame is ignored,
+// as it's usual for capture interrupted while writing. Streams are returned in order of their first segment,
+// streams without payload are skipped.
+func ReadStreams(r io.Reader) ([]*Stream, error) {
+	reader, err := NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	var streams []*Stream
+	byAddr := make(map[string]*Stream)
+	for {
+		frame, err := reader.Next()
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		seg, ok := parseFrame(frame.LinkType, frame.Data)
+		if !ok {
+			continue
+		}
+		key := seg.src.String() + ">" + seg.dst.String()
+		stream, ok := byAddr[key]
+		if !ok || (seg.flags&tcpFlagSyn != 0 && len(stream.Data) > 0) {
+			stream = newStream(&seg)
+			byAddr[key] = stream
+			streams = append(streams, stream)
+		}
+		stream.add(&seg, frame.Time)
+	}
+	result := streams[:0]
+	for _, stream := range streams {
+		stream.flush()
+		if len(stream.Data) > 0 {
+			result = append(result, stream)
+		}
+	}
+	return result, nil
+}
+
+// ReadPackets reads capture, reassembles TCP streams and decodes NDTP and EGTS packets.
+// Protocol of each stream is detected by its first packet, streams of other protocols are ignored.
+// Packets are returned in order of capture time.
+func ReadPackets(r io.Reader) ([]*Packet, error) {
+	streams, err := ReadStreams(r)
+	if err != nil {
+		return nil, err
+	}
+	var packets []*Packet
+	for _, stream := range streams {
+		packets = append(packets, stream.Packets()...)
+	}
+	sort.SliceStable(packets, func(i, j int) bool {
+		return packets[i].Time.Before(packets[j].Time)
+	})
+	return packets, nil
+}
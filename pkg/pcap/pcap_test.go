@@ -0,0 +1,234 @@
+package pcap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/egorban/navprot/pkg/egts"
+	"github.com/egorban/navprot/pkg/ndtp"
+)
+
+var (
+	terminal = Endpoint{IP: net.IPv4(10, 0, 0, 1).To4(), Port: 40000}
+	server   = Endpoint{IP: net.IPv4(10, 0, 0, 2).To4(), Port: 9000}
+	start    = time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+)
+
+type testFrame struct {
+	time     time.Time
+	src, dst Endpoint
+	seq      uint32
+	flags    byte
+	payload  []byte
+}
+
+func tcpSegment(f testFrame) []byte {
+	tcp := make([]byte, 20, 20+len(f.payload))
+	binary.BigEndian.PutUint16(tcp[0:2], f.src.Port)
+	binary.BigEndian.PutUint16(tcp[2:4], f.dst.Port)
+	binary.BigEndian.PutUint32(tcp[4:8], f.seq)
+	tcp[12] = 5 << 4
+	tcp[13] = f.flags | 0x10
+	return append(tcp, f.payload...)
+}
+
+func ethernetIPv4(f testFrame) []byte {
+	tcp := tcpSegment(f)
+	frame := make([]byte, 14+20, 14+20+len(tcp))
+	binary.BigEndian.PutUint16(frame[12:14], etherTypeIPv4)
+	ip := frame[14:]
+	ip[0] = 0x45
+	binary.BigEndian.PutUint16(ip[2:4], uint16(20+len(tcp)))
+	binary.BigEndian.PutUint16(ip[6:8], 0x4000)
+	ip[8] = 64
+	ip[9] = ipProtoTCP
+	copy(ip[12:16], f.src.IP.To4())
+	copy(ip[16:20], f.dst.IP.To4())
+	return append(frame, tcp...)
+}
+
+func rawIPv6(f testFrame) []byte {
+	tcp := tcpSegment(f)
+	ip := make([]byte, ipv6HeaderLen, ipv6HeaderLen+len(tcp))
+	ip[0] = 0x60
+	binary.BigEndian.PutUint16(ip[4:6], uint16(len(tcp)))
+	ip[6] = ipProtoTCP
+	copy(ip[8:24], f.src.IP.To16())
+	copy(ip[24:40], f.dst.IP.To16())
+	return append(ip, tcp...)
+}
+
+func writePcap(frames []testFrame) []byte {
+	var buf bytes.Buffer
+	header := make([]byte, pcapHeaderLen)
+	binary.LittleEndian.PutUint32(header[0:4], pcapMagicMicro)
+	binary.LittleEndian.PutUint16(header[4:6], 2)
+	binary.LittleEndian.PutUint16(header[6:8], 4)
+	binary.LittleEndian.PutUint32(header[16:20], 65535)
+	binary.LittleEndian.PutUint32(header[20:24], LinkTypeEthernet)
+	buf.Write(header)
+	for _, f := range frames {
+		data := ethernetIPv4(f)
+		record := make([]byte, pcapRecordLen)
+		binary.LittleEndian.PutUint32(record[0:4], uint32(f.time.Unix()))
+		binary.LittleEndian.PutUint32(record[4:8], uint32(f.time.Nanosecond()/1000))
+		binary.LittleEndian.PutUint32(record[8:12], uint32(len(data)))
+		binary.LittleEndian.PutUint32(record[12:16], uint32(len(data)))
+		buf.Write(record)
+		buf.Write(data)
+	}
+	return buf.Bytes()
+}
+
+func ngBlock(order binary.ByteOrder, blockType uint32, body []byte) []byte {
+	for len(body)%4 != 0 {
+		body = append(body, 0)
+	}
+	block := make([]byte, 8, 12+len(body))
+	order.PutUint32(block[0:4], blockType)
+	order.PutUint32(block[4:8], uint32(12+len(body)))
+	block = append(block, body...)
+	tail := make([]byte, 4)
+	order.PutUint32(tail, uint32(12+len(body)))
+	return append(block, tail...)
+}
+
+// writePcapng writes big endian pcapng with nanosecond resolution and raw IPv6 frames
+func writePcapng(frames []testFrame) []byte {
+	order := binary.BigEndian
+	var buf bytes.Buffer
+	shb := make([]byte, 16)
+	order.PutUint32(shb[0:4], ngByteOrderMagic)
+	order.PutUint16(shb[4:6], 1)
+	binary.BigEndian.PutUint64(shb[8:16], 0xffffffffffffffff)
+	buf.Write(ngBlock(order, ngBlockSHB, shb))
+	idb := make([]byte, 8, 20)
+	order.PutUint16(idb[0:2], LinkTypeRaw)
+	option := make([]byte, 8)
+	order.PutUint16(option[0:2], ngOptionTsResol)
+	order.PutUint16(option[2:4], 1)
+	option[4] = 9
+	idb = append(idb, option...)
+	idb = append(idb, 0, 0, 0, 0)
+	buf.Write(ngBlock(order, ngBlockIDB, idb))
+	for _, f := range frames {
+		data := rawIPv6(f)
+		epb := make([]byte, 20, 20+len(data))
+		ts := uint64(f.time.UnixNano())
+		order.PutUint32(epb[4:8], uint32(ts>>32))
+		order.PutUint32(epb[8:12], uint32(ts))
+		order.PutUint32(epb[12:16], uint32(len(data)))
+		order.PutUint32(epb[16:20], uint32(len(data)))
+		buf.Write(ngBlock(order, ngBlockEPB, append(epb, data...)))
+	}
+	return buf.Bytes()
+}
+
+func ndtpMessages(t *testing.T) (connRequest, nav, reply []byte) {
+	connRequest, err := ndtp.NewConnRequest(1024).Form()
+	if err != nil {
+		t.Fatal(err)
+	}
+	nav, err = ndtp.NewNavData(true, []ndtp.Subrecord{
+		&ndtp.NavData{Time: 1522961700, Lon: 37.6925783, Lat: 55.7890249, Valid: true},
+	}).Form()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return connRequest, nav, ndtp.MakeReply(connRequest, ndtp.NphResultOk)
+}
+
+func TestReadPackets_pcap(t *testing.T) {
+	connRequest, nav, reply := ndtpMessages(t)
+	ms := func(n int) time.Time { return start.Add(time.Duration(n) * time.Millisecond) }
+	isn := uint32(0xfffffff0)
+	data := writePcap([]testFrame{
+		{time: ms(0), src: terminal, dst: server, seq: isn, flags: tcpFlagSyn},
+		{time: ms(1), src: server, dst: terminal, seq: 500, flags: tcpFlagSyn},
+		{time: ms(2), src: terminal, dst: server, seq: isn + 1, payload: connRequest[:10]},
+		{time: ms(3), src: terminal, dst: server, seq: isn + 11, payload: connRequest[10:]},
+		// retransmission
+		{time: ms(4), src: terminal, dst: server, seq: isn + 1, payload: connRequest},
+		{time: ms(5), src: server, dst: terminal, seq: 501, payload: reply},
+		// out of order segments, sequence number wraps
+		{time: ms(6), src: terminal, dst: server, seq: isn + 1 + uint32(len(connRequest)) + 20, payload: nav[20:]},
+		{time: ms(7), src: terminal, dst: server, seq: isn + 1 + uint32(len(connRequest)), payload: nav[:20]},
+	})
+	packets, err := ReadPackets(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("ReadPackets() error = %v", err)
+	}
+	want := []struct {
+		time     time.Time
+		src, dst Endpoint
+		data     []byte
+	}{
+		{ms(3), terminal, server, connRequest},
+		{ms(5), server, terminal, reply},
+		{ms(7), terminal, server, nav},
+	}
+	if len(packets) != len(want) {
+		t.Fatalf("ReadPackets() returned %d packets, want %d", len(packets), len(want))
+	}
+	for i, w := range want {
+		p := packets[i]
+		if !p.Time.Equal(w.time) || !reflect.DeepEqual(p.Src, w.src) || !reflect.DeepEqual(p.Dst, w.dst) ||
+			!bytes.Equal(p.Data, w.data) || p.Protocol != ndtp.ProtocolName || p.Err != nil {
+			t.Errorf("packet %d = %+v, want %+v", i, p, w)
+		}
+	}
+	if id, err := packets[0].Parsed.(*ndtp.Packet).GetID(); err != nil || id != 1024 {
+		t.Errorf("GetID() = %d, %v", id, err)
+	}
+}
+
+func TestReadPackets_pcapng(t *testing.T) {
+	packet := &egts.Packet{Type: egts.EgtsPtAppdata, ID: 1, Records: []*egts.Record{{
+		RecNum:  1,
+		ID:      100,
+		Service: egts.EgtsTeledataService,
+		Data:    []*egts.SubRecord{{Type: egts.EgtsSrLiquidLevelSensor, Data: &egts.FuelData{Type: 2, Fuel: 30}}},
+	}}}
+	message, err := packet.Form()
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := Endpoint{IP: net.ParseIP("2001:db8::1"), Port: 40000}
+	dst := Endpoint{IP: net.ParseIP("2001:db8::2"), Port: 9000}
+	at := start.Add(123456789)
+	data := writePcapng([]testFrame{
+		{time: at, src: src, dst: dst, seq: 1, payload: message},
+		// lost segment, the second packet is decoded after gap
+		{time: at, src: src, dst: dst, seq: 1 + uint32(2*len(message)), payload: append(message[5:], message...)},
+	})
+	streams, err := ReadStreams(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("ReadStreams() error = %v", err)
+	}
+	if len(streams) != 1 || streams[0].Gaps != 1 {
+		t.Fatalf("ReadStreams() = %+v, want 1 stream with 1 gap", streams)
+	}
+	packets := streams[0].Packets()
+	if len(packets) != 2 {
+		t.Fatalf("Packets() returned %d packets, want 2", len(packets))
+	}
+	for _, p := range packets {
+		if !p.Time.Equal(at) || p.Protocol != egts.ProtocolName || p.Err != nil ||
+			p.Parsed.(*egts.Packet).Records[0].Data[0].Data.(*egts.FuelData).Fuel != 30 {
+			t.Errorf("packet = %+v", p)
+		}
+		if !p.Src.IP.Equal(src.IP) || p.Dst.String() != "[2001:db8::2]:9000" {
+			t.Errorf("packet endpoints = %v, %v", p.Src, p.Dst)
+		}
+	}
+}
+
+func TestNewReader_format(t *testing.T) {
+	if _, err := NewReader(bytes.NewReader([]byte("not a capture file at all"))); err != ErrFormat {
+		t.Errorf("NewReader() error = %v, want %v", err, ErrFormat)
+	}
+}
@@ -0,0 +1,263 @@
+/*
+Package pcap reads pcap and pcapng capture files without libpcap, reassembles TCP streams
+and decodes NDTP and EGTS packets transmitted in them.
+*/
+package pcap
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// Link types of captured frames supported by the package
+const (
+	LinkTypeNull     = 0
+	LinkTypeEthernet = 1
+	LinkTypeRaw      = 101
+	LinkTypeLinuxSLL = 113
+	LinkTypeIPv4     = 228
+	LinkTypeIPv6     = 229
+)
+
+const (
+	pcapMagicMicro = 0xa1b2c3d4
+	pcapMagicNano  = 0xa1b23c4d
+	pcapHeaderLen  = 24
+	pcapRecordLen  = 16
+
+	ngBlockSHB       = 0x0a0d0d0a
+	ngBlockIDB       = 1
+	ngBlockSPB       = 3
+	ngBlockEPB       = 6
+	ngByteOrderMagic = 0x1a2b3c4d
+	ngOptionTsResol  = 9
+
+	// maxFrameLen limits memory allocated for one frame of corrupted file
+	maxFrameLen = 1 << 20
+)
+
+// ErrFormat is returned by NewReader, if file is neither pcap nor pcapng
+var ErrFormat = errors.New("pcap: unknown file format")
+
+// Frame is a link layer frame read from capture file
+type Frame struct {
+	Time     time.Time
+	LinkType uint32
+	Data     []byte
+}
+
+// Reader reads frames from pcap or pcapng capture file
+type Reader struct {
+	r     *bufio.Reader
+	order binary.ByteOrder
+	ng    bool
+
+	// pcap
+	linkType uint32
+	nanosec  bool
+
+	// pcapng
+	ifaces []ngInterface
+}
+
+type ngInterface struct {
+	linkType uint32
+	// timestamp unit is 10^-resol or 2^-resol seconds
+	resol  uint8
+	binary bool
+}
+
+// NewReader creates Reader and reads file header of r
+func NewReader(r io.Reader) (*Reader, error) {
+	reader := &Reader{r: bufio.NewReader(r)}
+	magic, err := reader.r.Peek(4)
+	if err != nil {
+		return nil, ErrFormat
+	}
+	if binary.LittleEndian.Uint32(magic) == ngBlockSHB {
+		reader.ng = true
+		return reader, nil
+	}
+	header := make([]byte, pcapHeaderLen)
+	if _, err = io.ReadFull(reader.r, header); err != nil {
+		return nil, ErrFormat
+	}
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		switch order.Uint32(header) {
+		case pcapMagicMicro:
+			reader.order = order
+		case pcapMagicNano:
+			reader.order = order
+			reader.nanosec = true
+		default:
+			continue
+		}
+		reader.linkType = order.Uint32(header[20:24]) & 0x0fffffff
+		return reader, nil
+	}
+	return nil, ErrFormat
+}
+
+// Next returns the next frame of capture, io.EOF is returned at the end of file.
+// Data of frame is valid until the next call of Next.
+func (r *Reader) Next() (*Frame, error) {
+	if r.ng {
+		return r.nextNg()
+	}
+	header := make([]byte, pcapRecordLen)
+	if _, err := io.ReadFull(r.r, header); err != nil {
+		return nil, err
+	}
+	sec := r.order.Uint32(header[0:4])
+	frac := r.order.Uint32(header[4:8])
+	capLen := r.order.Uint32(header[8:12])
+	if capLen > maxFrameLen {
+		return nil, fmt.Errorf("pcap: frame length %d is too large", capLen)
+	}
+	data := make([]byte, capLen)
+	if _, err := io.ReadFull(r.r, data); err != nil {
+		return nil, unexpected(err)
+	}
+	if !r.nanosec {
+		frac *= 1000
+	}
+	return &Frame{
+		Time:     time.Unix(int64(sec), int64(frac)).UTC(),
+		LinkType: r.linkType,
+		Data:     data,
+	}, nil
+}
+
+func (r *Reader) nextNg() (*Frame, error) {
+	for {
+		blockType, body, err := r.readBlock()
+		if err != nil {
+			return nil, err
+		}
+		switch blockType {
+		case ngBlockIDB:
+			if len(body) < 8 {
+				return nil, errors.New("pcap: interface description block is too short")
+			}
+			iface := ngInterface{linkType: uint32(r.order.Uint16(body[0:2])), resol: 6}
+			r.parseTsResol(&iface, body[8:])
+			r.ifaces = append(r.ifaces, iface)
+		case ngBlockEPB:
+			if len(body) < 20 {
+				return nil, errors.New("pcap: enhanced packet block is too short")
+			}
+			id := r.order.Uint32(body[0:4])
+			if int(id) >= len(r.ifaces) {
+				return nil, fmt.Errorf("pcap: unknown interface %d", id)
+			}
+			capLen := r.order.Uint32(body[12:16])
+			if uint64(capLen) > uint64(len(body)-20) {
+				return nil, errors.New("pcap: enhanced packet block is too short")
+			}
+			iface := r.ifaces[id]
+			ts := uint64(r.order.Uint32(body[4:8]))<<32 | uint64(r.order.Uint32(body[8:12]))
+			return &Frame{
+				Time:     iface.time(ts),
+				LinkType: iface.linkType,
+				Data:     body[20 : 20+capLen],
+			}, nil
+		case ngBlockSPB:
+			if len(body) < 4 || len(r.ifaces) == 0 {
+				return nil, errors.New("pcap: incorrect simple packet block")
+			}
+			origLen := r.order.Uint32(body[0:4])
+			data := body[4:]
+			if uint64(origLen) < uint64(len(data)) {
+				data = data[:origLen]
+			}
+			return &Frame{LinkType: r.ifaces[0].linkType, Data: data}, nil
+		}
+	}
+}
+
+// readBlock reads pcapng block, section header block changes byte order and resets interfaces
+func (r *Reader) readBlock() (blockType uint32, body []byte, err error) {
+	header := make([]byte, 8)
+	if _, err = io.ReadFull(r.r, header); err != nil {
+		return
+	}
+	blockType = binary.LittleEndian.Uint32(header[0:4])
+	if blockType == ngBlockSHB {
+		var magic []byte
+		if magic, err = r.r.Peek(4); err != nil {
+			return 0, nil, unexpected(err)
+		}
+		if binary.LittleEndian.Uint32(magic) == ngByteOrderMagic {
+			r.order = binary.LittleEndian
+		} else if binary.BigEndian.Uint32(magic) == ngByteOrderMagic {
+			r.order = binary.BigEndian
+		} else {
+			return 0, nil, ErrFormat
+		}
+		r.ifaces = r.ifaces[:0]
+	} else if r.order == nil {
+		return 0, nil, ErrFormat
+	}
+	blockType = r.order.Uint32(header[0:4])
+	total := r.order.Uint32(header[4:8])
+	if total < 12 || total%4 != 0 || total > maxFrameLen {
+		return 0, nil, fmt.Errorf("pcap: incorrect block length %d", total)
+	}
+	block := make([]byte, total-8)
+	if _, err = io.ReadFull(r.r, block); err != nil {
+		return 0, nil, unexpected(err)
+	}
+	return blockType, block[:len(block)-4], nil
+}
+
+func (r *Reader) parseTsResol(iface *ngInterface, options []byte) {
+	for len(options) >= 4 {
+		code := r.order.Uint16(options[0:2])
+		length := int(r.order.Uint16(options[2:4]))
+		if code == 0 || len(options) < 4+length {
+			return
+		}
+		if code == ngOptionTsResol && length >= 1 {
+			v := options[4]
+			iface.binary = v&0x80 != 0
+			iface.resol = v & 0x7f
+		}
+		options = options[4+(length+3)/4*4:]
+	}
+}
+
+func (iface ngInterface) time(ts uint64) time.Time {
+	if iface.binary {
+		if iface.resol >= 64 {
+			return time.Unix(0, 0).UTC()
+		}
+		sec := ts >> iface.resol
+		frac := ts - sec<<iface.resol
+		ns := float64(frac) / float64(uint64(1)<<iface.resol) * 1e9
+		return time.Unix(int64(sec), int64(ns)).UTC()
+	}
+	if iface.resol > 19 {
+		return time.Unix(0, 0).UTC()
+	}
+	unit := uint64(math.Pow10(int(iface.resol)))
+	sec := ts / unit
+	frac := ts % unit
+	if iface.resol <= 9 {
+		frac *= uint64(math.Pow10(9 - int(iface.resol)))
+	} else {
+		frac /= uint64(math.Pow10(int(iface.resol) - 9))
+	}
+	return time.Unix(int64(sec), int64(frac)).UTC()
+}
+
+func unexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
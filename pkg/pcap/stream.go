@@ -0,0 +1,185 @@
+package pcap
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/egorban/navprot/pkg/detector"
+	"github.com/egorban/navprot/pkg/egts"
+	"github.com/egorban/navprot/pkg/ndtp"
+)
+
+// maxPending limits number of out of order segments kept for stream
+const maxPending = 1024
+
+// Stream is reassembled payload of one direction of TCP connection
+type Stream struct {
+	Src, Dst Endpoint
+	// Data is payload in sequence order, retransmitted data is included once
+	Data []byte
+	// Gaps is number of places, where lost segments are skipped
+	Gaps int
+
+	chunks  []chunk
+	nextSeq uint32
+	started bool
+	pending map[uint32]pendingSegment
+}
+
+// chunk is a part of Data, which became available at time
+type chunk struct {
+	end  int
+	time time.Time
+}
+
+type pendingSegment struct {
+	payload []byte
+	time    time.Time
+}
+
+func newStream(seg *segment) *Stream {
+	return &Stream{
+		Src:     Endpoint{IP: append(net.IP(nil), seg.src.IP...), Port: seg.src.Port},
+		Dst:     Endpoint{IP: append(net.IP(nil), seg.dst.IP...), Port: seg.dst.Port},
+		pending: make(map[uint32]pendingSegment),
+	}
+}
+
+func (s *Stream) add(seg *segment, t time.Time) {
+	if seg.flags&tcpFlagSyn != 0 {
+		s.nextSeq = seg.seq + 1
+		s.started = true
+		return
+	}
+	if len(seg.payload) == 0 {
+		return
+	}
+	if !s.started {
+		s.nextSeq = seg.seq
+		s.started = true
+	}
+	if int32(seg.seq-s.nextSeq) > 0 {
+		if prev, ok := s.pending[seg.seq]; (!ok || len(prev.payload) < len(seg.payload)) && len(s.pending) < maxPending {
+			s.pending[seg.seq] = pendingSegment{payload: append([]byte(nil), seg.payload...), time: t}
+		}
+		return
+	}
+	s.appendPayload(seg.seq, seg.payload, t)
+	s.applyPending(t)
+}
+
+// appendPayload appends part of payload starting at nextSeq
+func (s *Stream) appendPayload(seq uint32, payload []byte, t time.Time) {
+	skip := int(s.nextSeq - seq)
+	if skip >= len(payload) {
+		return
+	}
+	s.Data = append(s.Data, payload[skip:]...)
+	s.nextSeq += uint32(len(payload) - skip)
+	s.chunks = append(s.chunks, chunk{end: len(s.Data), time: t})
+}
+
+// applyPending appends pending segments, which became contiguous at time t
+func (s *Stream) applyPending(t time.Time) {
+	for applied := true; applied; {
+		applied = false
+		for seq, p := range s.pending {
+			if int32(seq-s.nextSeq) <= 0 {
+				delete(s.pending, seq)
+				if p.time.After(t) {
+					t = p.time
+				}
+				s.appendPayload(seq, p.payload, t)
+				applied = true
+			}
+		}
+	}
+}
+
+// flush appends pending segments skipping lost data
+func (s *Stream) flush() {
+	for len(s.pending) > 0 {
+		first := true
+		var next uint32
+		for seq := range s.pending {
+			if first || int32(seq-next) < 0 {
+				next = seq
+				first = false
+			}
+		}
+		s.nextSeq = next
+		s.Gaps++
+		s.applyPending(s.pending[next].time)
+	}
+}
+
+// TimeAt returns capture time, when byte of Data at offset became available in stream
+func (s *Stream) TimeAt(offset int) time.Time {
+	i := sort.Search(len(s.chunks), func(i int) bool { return s.chunks[i].end > offset })
+	if i == len(s.chunks) {
+		i--
+	}
+	if i < 0 {
+		return time.Time{}
+	}
+	return s.chunks[i].time
+}
+
+// Protocol returns ndtp.ProtocolName or egts.ProtocolName according to the first packet of stream,
+// empty string is returned if stream contains neither NDTP nor EGTS packets
+func (s *Stream) Protocol() string {
+	p, _, _ := detector.New().Find(s.Data)
+	return p.Name
+}
+
+// frameDecoder is implemented by ndtp.Decoder and egts.Decoder
+type frameDecoder interface {
+	Next() ([]byte, error)
+	Skipped() int
+}
+
+// Packets decodes packets of stream according to Protocol
+func (s *Stream) Packets() []*Packet {
+	proto := s.Protocol()
+	var dec frameDecoder
+	var parse func([]byte) (interface{}, error)
+	switch proto {
+	case ndtp.ProtocolName:
+		dec = ndtp.NewDecoder(bytes.NewReader(s.Data))
+		parse = func(frame []byte) (interface{}, error) {
+			packet := new(ndtp.Packet)
+			_, err := packet.Parse(frame)
+			return packet, err
+		}
+	case egts.ProtocolName:
+		dec = egts.NewDecoder(bytes.NewReader(s.Data))
+		parse = func(frame []byte) (interface{}, error) {
+			packet := new(egts.Packet)
+			_, err := packet.Parse(frame)
+			return packet, err
+		}
+	default:
+		return nil
+	}
+	var packets []*Packet
+	offset := 0
+	for {
+		frame, err := dec.Next()
+		offset += dec.Skipped() + len(frame)
+		if err == io.EOF {
+			return packets
+		}
+		packet := &Packet{Time: s.TimeAt(offset - 1), Src: s.Src, Dst: s.Dst, Protocol: proto, Err: err}
+		if err == nil {
+			packet.Data = append([]byte(nil), frame...)
+			packet.Parsed, packet.Err = parse(packet.Data)
+		}
+		packets = append(packets, packet)
+		if err == io.ErrUnexpectedEOF {
+			return packets
+		}
+	}
+}
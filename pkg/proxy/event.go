@@ -0,0 +1,110 @@
+package proxy
+
+import (
+	"encoding/json"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Direction of packet
+type Direction int
+
+// Directions of packets
+const (
+	// DirectionUp is from terminal to upstream
+	DirectionUp Direction = iota
+	// DirectionDown is from upstream to terminal
+	DirectionDown
+)
+
+func (d Direction) index() int {
+	return int(d)
+}
+
+func (d Direction) opposite() Direction {
+	return 1 - d
+}
+
+func (d Direction) String() string {
+	if d == DirectionDown {
+		return "down"
+	}
+	return "up"
+}
+
+// MarshalJSON encodes direction as "up" or "down"
+func (d Direction) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(d.String())), nil
+}
+
+// Event types
+const (
+	EventOpen       = "open"
+	EventClose      = "close"
+	EventPacket     = "packet"
+	EventError      = "error"
+	EventUnanswered = "unanswered"
+)
+
+// Flags of problems
+const (
+	// FlagCRC means packet with incorrect checksum
+	FlagCRC = "crc_error"
+	// FlagParse means packet, which can't be parsed
+	FlagParse = "parse_error"
+	// FlagTruncated means connection closed in the middle of packet
+	FlagTruncated = "truncated"
+	// FlagUnanswered means request without reply during reply timeout
+	FlagUnanswered = "unanswered"
+	// FlagResult means NPH_RESULT or EGTS response with unsuccessful result code
+	FlagResult = "result_not_ok"
+	// FlagUnexpectedReply means reply without matching request
+	FlagUnexpectedReply = "unexpected_reply"
+	// FlagDropped means forwarded data, which is not decoded, because decoding falls behind
+	FlagDropped = "dropped"
+)
+
+// Duration is time.Duration encoded in JSON as milliseconds
+type Duration time.Duration
+
+// MarshalJSON encodes duration as number of milliseconds
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', -1, 64)), nil
+}
+
+// Event describes connection opening and closing, packet or problem
+type Event struct {
+	Time      time.Time `json:"time"`
+	Conn      uint64    `json:"conn"`
+	Type      string    `json:"event"`
+	Direction Direction `json:"direction"`
+	// Client and Upstream are addresses of open event
+	Client   string `json:"client,omitempty"`
+	Upstream string `json:"upstream,omitempty"`
+	// Protocol and Packet are set for packets, Packet is *ndtp.Packet or *egts.Packet
+	Protocol string      `json:"protocol,omitempty"`
+	Packet   interface{} `json:"packet,omitempty"`
+	// RequestID is NPH request ID or EGTS packet ID of request or reply
+	RequestID *uint32 `json:"request_id,omitempty"`
+	// Result is result code of reply
+	Result *uint32 `json:"result,omitempty"`
+	// Latency is time from request to reply or duration of connection for close event, in milliseconds
+	Latency Duration `json:"latency_ms,omitempty"`
+	Flag    string   `json:"flag,omitempty"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// JSONLogger returns Config.Log function writing events to w as JSON lines
+func JSONLogger(w io.Writer) func(*Event) {
+	var mu sync.Mutex
+	enc := json.NewEncoder(w)
+	return func(e *Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		if err := enc.Encode(e); err != nil {
+			enc.Encode(&Event{Time: e.Time, Conn: e.Conn, Type: EventError, Direction: e.Direction, Error: err.Error()})
+		}
+	}
+}
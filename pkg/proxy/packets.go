@@ -0,0 +1,101 @@
+package proxy
+
+import (
+	"time"
+
+	"github.com/egorban/navprot/pkg/egts"
+	"github.com/egorban/navprot/pkg/ndtp"
+)
+
+// ndtpPacket logs NDTP packet. Packets with request flag are requests, NPH_RESULT is reply to request
+// with the same NPH request ID sent in opposite direction.
+func (c *connection) ndtpPacket(dir Direction, packet *ndtp.Packet, err error) {
+	now := time.Now()
+	e := &Event{Time: now, Type: EventPacket, Direction: dir, Protocol: ndtp.ProtocolName}
+	if packet == nil {
+		c.packetError(e, err, err == ndtp.ErrCRC)
+		return
+	}
+	e.Packet = packet
+	if err != nil || packet.Nph == nil {
+		c.packetError(e, err, false)
+		return
+	}
+	id := packet.Nph.ReqID
+	e.RequestID = &id
+	if packet.IsResult() {
+		code, _ := packet.Nph.Data.(uint32)
+		e.Result = &code
+		c.matchReply(e, code != ndtp.NphResultOk)
+	} else if packet.NeedReply() {
+		c.request(dir, id, now)
+	}
+	c.log(e)
+}
+
+// egtsPacket logs EGTS packet. EGTS_PT_APPDATA is request, EGTS_PT_RESPONSE is reply to request
+// with the same packet ID sent in opposite direction.
+func (c *connection) egtsPacket(dir Direction, packet *egts.Packet, err error) {
+	now := time.Now()
+	e := &Event{Time: now, Type: EventPacket, Direction: dir, Protocol: egts.ProtocolName}
+	if packet == nil {
+		c.packetError(e, err, err == egts.ErrCRC)
+		return
+	}
+	e.Packet = packet
+	if err != nil {
+		c.packetError(e, err, false)
+		return
+	}
+	switch packet.Type {
+	case egts.EgtsPtAppdata:
+		id := uint32(packet.ID)
+		e.RequestID = &id
+		c.request(dir, id, now)
+	case egts.EgtsPtResponse:
+		resp, ok := packet.Data.(*egts.Response)
+		if !ok {
+			break
+		}
+		id, code := uint32(resp.RPID), uint32(resp.ProcRes)
+		for _, rec := range packet.Records {
+			for _, sub := range rec.Data {
+				if conf, ok := sub.Data.(*egts.Confirmation); ok && code == egts.Success {
+					code = uint32(conf.RST)
+				}
+			}
+		}
+		e.RequestID, e.Result = &id, &code
+		c.matchReply(e, code != egts.Success)
+	}
+	c.log(e)
+}
+
+// matchReply sets latency of reply event and flags unsuccessful or unexpected reply
+func (c *connection) matchReply(e *Event, failed bool) {
+	latency, ok := c.reply(e.Direction, *e.RequestID, e.Time)
+	if ok {
+		e.Latency = Duration(latency)
+	}
+	switch {
+	case failed:
+		e.Flag = FlagResult
+	case !ok:
+		e.Flag = FlagUnexpectedReply
+	}
+}
+
+func (c *connection) packetError(e *Event, err error, crc bool) {
+	if crc {
+		e.Flag = FlagCRC
+	} else {
+		e.Flag = FlagParse
+	}
+	if e.Packet == nil {
+		e.Type = EventError
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	c.log(e)
+}
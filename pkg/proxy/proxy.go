@@ -0,0 +1,365 @@
+/*
+Package proxy forwards TCP connections of terminals to platform unchanged and logs NDTP or EGTS packets
+of both directions with request and reply matching. Protocol is configured or detected for every connection.
+*/
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/egorban/navprot/pkg/detector"
+	"github.com/egorban/navprot/pkg/egts"
+	"github.com/egorban/navprot/pkg/ndtp"
+)
+
+const (
+	// DefaultReplyTimeout is default time to wait for reply to request
+	DefaultReplyTimeout = 10 * time.Second
+	// DefaultDialTimeout is default timeout of connecting to upstream
+	DefaultDialTimeout = 10 * time.Second
+
+	forwardBufLen = 32 * 1024
+	// minReplyTimeout is the least reply timeout, unanswered requests are checked 4 times per timeout
+	minReplyTimeout = time.Millisecond
+)
+
+// ErrProxyClosed is returned by Serve after Close
+var ErrProxyClosed = errors.New("proxy is closed")
+
+// Config contains proxy parameters
+type Config struct {
+	// Upstream is platform address host:port
+	Upstream string
+	// Protocol is ndtp.ProtocolName or egts.ProtocolName, protocol of every connection is detected
+	// by its first bytes if it's empty
+	Protocol string
+	// ReplyTimeout is time after which request is reported as unanswered, DefaultReplyTimeout is used if it's zero.
+	// It must be at least 1 ms.
+	ReplyTimeout time.Duration
+	// DialTimeout is timeout of connecting to upstream, DefaultDialTimeout is used if it's zero
+	DialTimeout time.Duration
+	// Log is called for every event, it's called concurrently for different connections.
+	// Slow Log doesn't delay forwarding, packets are not decoded if decoding falls behind by 1 MB.
+	Log func(*Event)
+}
+
+// Proxy accepts terminal connections and forwards them to upstream
+type Proxy struct {
+	conf     Config
+	detector *detector.Detector
+	nextID   uint64
+
+	mu        sync.Mutex
+	closed    bool
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	wg        sync.WaitGroup
+}
+
+// New creates Proxy. Zero values in conf are replaced by default values.
+func New(conf Config) (*Proxy, error) {
+	if conf.Protocol != "" && conf.Protocol != ndtp.ProtocolName && conf.Protocol != egts.ProtocolName {
+		return nil, fmt.Errorf("unknown protocol %q", conf.Protocol)
+	}
+	if conf.ReplyTimeout == 0 {
+		conf.ReplyTimeout = DefaultReplyTimeout
+	}
+	if conf.ReplyTimeout < minReplyTimeout {
+		return nil, fmt.Errorf("reply timeout %v is less than %v", conf.ReplyTimeout, minReplyTimeout)
+	}
+	if conf.DialTimeout <= 0 {
+		conf.DialTimeout = DefaultDialTimeout
+	}
+	if conf.Log == nil {
+		conf.Log = func(*Event) {}
+	}
+	return &Proxy{
+		conf:      conf,
+		detector:  detector.New(),
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[net.Conn]struct{}),
+	}, nil
+}
+
+// Serve accepts connections on l until Close is called, then ErrProxyClosed is returned
+func (p *Proxy) Serve(l net.Listener) error {
+	if !p.track(l, nil) {
+		l.Close()
+		return ErrProxyClosed
+	}
+	defer p.untrack(l, nil)
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			p.mu.Lock()
+			closed := p.closed
+			p.mu.Unlock()
+			if closed {
+				return ErrProxyClosed
+			}
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				time.Sleep(10 * time.Millisecond)
+				continue
+			}
+			return err
+		}
+		if !p.track(nil, conn) {
+			conn.Close()
+			return ErrProxyClosed
+		}
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			defer p.untrack(nil, conn)
+			p.handle(conn)
+		}()
+	}
+}
+
+// Close stops listeners, closes all connections and waits for their handlers
+func (p *Proxy) Close() error {
+	p.mu.Lock()
+	p.closed = true
+	for l := range p.listeners {
+		l.Close()
+	}
+	for c := range p.conns {
+		c.Close()
+	}
+	p.mu.Unlock()
+	p.wg.Wait()
+	return nil
+}
+
+func (p *Proxy) track(l net.Listener, c net.Conn) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return false
+	}
+	if l != nil {
+		p.listeners[l] = struct{}{}
+	}
+	if c != nil {
+		p.conns[c] = struct{}{}
+	}
+	return true
+}
+
+func (p *Proxy) untrack(l net.Listener, c net.Conn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.listeners, l)
+	delete(p.conns, c)
+}
+
+func (p *Proxy) handle(client net.Conn) {
+	c := &connection{
+		id:      atomic.AddUint64(&p.nextID, 1),
+		conf:    &p.conf,
+		proto:   p.conf.Protocol,
+		opened:  time.Now(),
+		pending: [2]map[uint32]time.Time{make(map[uint32]time.Time), make(map[uint32]time.Time)},
+	}
+	c.log(&Event{Type: EventOpen, Client: client.RemoteAddr().String(), Upstream: p.conf.Upstream})
+	if c.proto == "" {
+		// upstream is not dialed until terminal sends header of known protocol
+		proto, conn, err := p.detector.DetectConn(client)
+		if err != nil {
+			c.log(&Event{Type: EventClose, Error: err.Error()})
+			conn.Close()
+			return
+		}
+		c.proto, client = proto.Name, conn
+	}
+	upstream, err := net.DialTimeout("tcp", p.conf.Upstream, p.conf.DialTimeout)
+	if err != nil {
+		c.log(&Event{Type: EventClose, Error: err.Error()})
+		client.Close()
+		return
+	}
+	if !p.track(nil, upstream) {
+		client.Close()
+		upstream.Close()
+		return
+	}
+	defer p.untrack(nil, upstream)
+	c.run(client, upstream)
+}
+
+// connection is a pair of terminal and upstream connections
+type connection struct {
+	id     uint64
+	conf   *Config
+	proto  string
+	opened time.Time
+
+	mu sync.Mutex
+	// pending contains times of requests sent in direction by request id
+	pending [2]map[uint32]time.Time
+}
+
+func (c *connection) run(client, upstream net.Conn) {
+	var forwarders, decoders sync.WaitGroup
+	done := make(chan struct{})
+	forwarders.Add(2)
+	decoders.Add(2)
+	for _, f := range []struct {
+		dst, src net.Conn
+		dir      Direction
+	}{{upstream, client, DirectionUp}, {client, upstream, DirectionDown}} {
+		t := newTap(tapBufLen)
+		go func(dir Direction) {
+			defer decoders.Done()
+			c.decode(t, dir)
+		}(f.dir)
+		go func(dst, src net.Conn) {
+			defer forwarders.Done()
+			forward(dst, src, t)
+			// the first finished direction closes both connections
+			client.Close()
+			upstream.Close()
+		}(f.dst, f.src)
+	}
+	go c.checkUnanswered(done)
+	forwarders.Wait()
+	decoders.Wait()
+	close(done)
+	c.expire(time.Time{})
+	c.log(&Event{Type: EventClose, Latency: Duration(time.Since(c.opened))})
+}
+
+// forward copies src to dst and to decoding buffer w
+func forward(dst, src net.Conn, w *tap) {
+	buf := make([]byte, forwardBufLen)
+	var err error
+	for {
+		var n int
+		n, err = src.Read(buf)
+		if n > 0 {
+			if _, werr := dst.Write(buf[:n]); werr != nil {
+				err = werr
+				break
+			}
+			w.Write(buf[:n])
+		}
+		if err != nil {
+			break
+		}
+	}
+	if err == io.EOF {
+		err = nil
+	}
+	w.CloseWithError(err)
+}
+
+func (c *connection) decode(r *tap, dir Direction) {
+	// decoding stops at read error, the rest of stream is drained to free buffer
+	defer io.Copy(ioutil.Discard, r)
+	switch c.proto {
+	case ndtp.ProtocolName:
+		dec := ndtp.NewDecoder(r)
+		for {
+			packet, err := dec.Decode()
+			c.dropped(dir, r)
+			if packet == nil && err != ndtp.ErrCRC && err != ndtp.ErrPacketTooLarge {
+				c.decodeEnd(dir, err)
+				return
+			}
+			c.ndtpPacket(dir, packet, err)
+		}
+	case egts.ProtocolName:
+		dec := egts.NewDecoder(r)
+		for {
+			packet, err := dec.Decode()
+			c.dropped(dir, r)
+			if packet == nil && err != egts.ErrCRC && err != egts.ErrPacketTooLarge {
+				c.decodeEnd(dir, err)
+				return
+			}
+			c.egtsPacket(dir, packet, err)
+		}
+	}
+}
+
+// dropped reports data forwarded without decoding, packets around the gap can be reported as corrupted
+func (c *connection) dropped(dir Direction, r *tap) {
+	if n := r.takeDropped(); n > 0 {
+		c.log(&Event{Type: EventError, Direction: dir, Error: fmt.Sprintf("%d bytes are not decoded", n),
+			Flag: FlagDropped})
+	}
+}
+
+func (c *connection) decodeEnd(dir Direction, err error) {
+	if err == io.ErrUnexpectedEOF {
+		c.log(&Event{Type: EventError, Direction: dir, Error: "truncated packet", Flag: FlagTruncated})
+	}
+}
+
+func (c *connection) checkUnanswered(done chan struct{}) {
+	ticker := time.NewTicker(c.conf.ReplyTimeout / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-ticker.C:
+			c.expire(now.Add(-c.conf.ReplyTimeout))
+		}
+	}
+}
+
+// expire reports requests sent before t as unanswered, all requests are reported if t is zero
+func (c *connection) expire(t time.Time) {
+	var events []*Event
+	c.mu.Lock()
+	for dir, pending := range c.pending {
+		for id, sent := range pending {
+			if t.IsZero() || sent.Before(t) {
+				delete(pending, id)
+				reqID := id
+				events = append(events, &Event{Type: EventUnanswered, Direction: Direction(dir), RequestID: &reqID,
+					Flag: FlagUnanswered})
+			}
+		}
+	}
+	c.mu.Unlock()
+	for _, e := range events {
+		c.log(e)
+	}
+}
+
+// request registers request sent in direction
+func (c *connection) request(dir Direction, id uint32, t time.Time) {
+	c.mu.Lock()
+	c.pending[dir.index()][id] = t
+	c.mu.Unlock()
+}
+
+// reply matches reply sent in direction with request sent in opposite direction
+func (c *connection) reply(dir Direction, id uint32, t time.Time) (latency time.Duration, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	pending := c.pending[dir.opposite().index()]
+	sent, ok := pending[id]
+	if ok {
+		delete(pending, id)
+		latency = t.Sub(sent)
+	}
+	return
+}
+
+func (c *connection) log(e *Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	e.Conn = c.id
+	c.conf.Log(e)
+}
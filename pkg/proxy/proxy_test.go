@@ -0,0 +1,325 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/egorban/navprot/internal/testserver"
+	"github.com/egorban/navprot/pkg/egts"
+	"github.com/egorban/navprot/pkg/ndtp"
+)
+
+// startProxy starts upstream server handled by serve and proxy in front of it, stop closes both
+func startProxy(t *testing.T, proto string, serve func(conn net.Conn)) (stop func(), addr string, events func() []*Event) {
+	upstream := testserver.Listen(t, "127.0.0.1:0", serve)
+	var mu sync.Mutex
+	var logged []*Event
+	p, err := New(Config{
+		Upstream:     upstream.Addr().String(),
+		Protocol:     proto,
+		ReplyTimeout: time.Second,
+		Log: func(e *Event) {
+			mu.Lock()
+			logged = append(logged, e)
+			mu.Unlock()
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go p.Serve(l)
+	stop = func() {
+		p.Close()
+		upstream.Close()
+	}
+	return stop, l.Addr().String(), func() []*Event {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]*Event(nil), logged...)
+	}
+}
+
+func countFlags(events []*Event) map[string]int {
+	flags := make(map[string]int)
+	for _, e := range events {
+		flags[e.Type+"/"+e.Flag]++
+	}
+	return flags
+}
+
+func TestProxy_NDTP(t *testing.T) {
+	var replies bytes.Buffer
+	var sent sync.WaitGroup
+	sent.Add(1)
+	stop, addr, events := startProxy(t, ndtp.ProtocolName, func(conn net.Conn) {
+		defer sent.Done()
+		dec := ndtp.NewDecoder(conn)
+		for n := 0; n < 3; n++ {
+			packet, err := dec.Decode()
+			if err != nil {
+				return
+			}
+			var reply []byte
+			switch n {
+			case 0:
+				reply = packet.Reply(ndtp.NphResultOk)
+			case 1:
+				reply = packet.Reply(ndtp.NphResultServiceNotAvailable)
+			default:
+				continue
+			}
+			replies.Write(reply)
+			conn.Write(reply)
+		}
+	})
+	stream, err := ndtp.NewConnRequest(1024).Form()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream = ndtp.Change(stream, map[string]int{ndtp.NphReqID: 1})
+	var nav []byte
+	for i := 2; i <= 3; i++ {
+		nav, err = ndtp.NewNavData(true, []ndtp.Subrecord{&ndtp.NavData{Time: uint32(1522961700 + i)}}).Form()
+		if err != nil {
+			t.Fatal(err)
+		}
+		stream = append(stream, ndtp.Change(nav, map[string]int{ndtp.NphReqID: i})...)
+	}
+	corrupted := ndtp.Change(nav, map[string]int{ndtp.NphReqID: 4})
+	corrupted[len(corrupted)-1]++
+	stream = append(stream, corrupted...)
+
+	client, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Write(stream); err != nil {
+		t.Fatal(err)
+	}
+	sent.Wait()
+	received := make([]byte, replies.Len())
+	if _, err := io.ReadFull(client, received); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(received, replies.Bytes()) {
+		t.Errorf("received %v, want %v", received, replies.Bytes())
+	}
+	client.Close()
+	time.Sleep(50 * time.Millisecond)
+	stop()
+
+	logged := events()
+	flags := countFlags(logged)
+	want := map[string]int{
+		EventOpen + "/":                        1,
+		EventPacket + "/":                      4,
+		EventPacket + "/" + FlagResult:         1,
+		EventError + "/" + FlagCRC:             1,
+		EventUnanswered + "/" + FlagUnanswered: 1,
+		EventClose + "/":                       1,
+	}
+	for k, n := range want {
+		if flags[k] != n {
+			t.Errorf("%d %s events, want %d; events: %v", flags[k], k, n, flags)
+		}
+	}
+	for _, e := range logged {
+		if e.Conn != 1 {
+			t.Errorf("event %+v has conn %d, want 1", e, e.Conn)
+		}
+		if e.Flag == FlagResult && (e.Direction != DirectionDown || *e.Result != ndtp.NphResultServiceNotAvailable ||
+			e.Latency <= 0) {
+			t.Errorf("incorrect reply event %+v", e)
+		}
+		if e.Type == EventUnanswered && (e.Direction != DirectionUp || *e.RequestID != 3) {
+			t.Errorf("incorrect unanswered event %+v", e)
+		}
+	}
+}
+
+func TestProxy_EGTS(t *testing.T) {
+	stop, addr, events := startProxy(t, egts.ProtocolName, func(conn net.Conn) {
+		dec := egts.NewDecoder(conn)
+		packet, err := dec.Decode()
+		if err != nil {
+			return
+		}
+		reply, _ := (&egts.Packet{
+			Type: egts.EgtsPtResponse,
+			Data: &egts.Response{RPID: packet.ID, ProcRes: 128},
+		}).Form()
+		conn.Write(reply)
+	})
+	request, err := (&egts.Packet{Type: egts.EgtsPtAppdata, ID: 7}).Form()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Write(request)
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := egts.NewDecoder(client).Decode(); err != nil {
+		t.Fatalf("reply is not received: %v", err)
+	}
+	client.Close()
+	time.Sleep(50 * time.Millisecond)
+	stop()
+
+	flags := countFlags(events())
+	if flags[EventPacket+"/"] != 1 || flags[EventPacket+"/"+FlagResult] != 1 || flags[EventUnanswered+"/"+FlagUnanswered] != 0 {
+		t.Errorf("incorrect events %v", flags)
+	}
+}
+
+func TestProxy_detect(t *testing.T) {
+	stop, addr, events := startProxy(t, "", func(conn net.Conn) {
+		io.Copy(conn, conn)
+	})
+	defer stop()
+	// connection of unknown protocol is closed without dialing upstream
+	unknown, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unknown.Write([]byte("GET / HTTP/1.1\r\n\r\n"))
+	unknown.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err = unknown.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("connection of unknown protocol read error = %v, want EOF", err)
+	}
+	unknown.Close()
+
+	request, err := (&egts.Packet{Type: egts.EgtsPtAppdata, ID: 7}).Form()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Write(request)
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := egts.NewDecoder(client).Decode(); err != nil {
+		t.Fatalf("echo is not received: %v", err)
+	}
+	client.Close()
+	time.Sleep(50 * time.Millisecond)
+	stop()
+
+	var closeErrs, packets int
+	for _, e := range events() {
+		switch {
+		case e.Type == EventClose && e.Error != "":
+			closeErrs++
+		case e.Type == EventPacket:
+			if e.Protocol != egts.ProtocolName {
+				t.Errorf("packet event of protocol %q", e.Protocol)
+			}
+			packets++
+		}
+	}
+	if closeErrs != 1 || packets != 2 {
+		t.Errorf("%d close errors and %d packets are logged, want 1 and 2", closeErrs, packets)
+	}
+}
+
+func TestJSONLogger(t *testing.T) {
+	var buf bytes.Buffer
+	id := uint32(5)
+	JSONLogger(&buf)(&Event{Time: time.Unix(0, 0).UTC(), Conn: 2, Type: EventUnanswered, Direction: DirectionDown,
+		RequestID: &id, Latency: Duration(1500 * time.Microsecond), Flag: FlagUnanswered})
+	want := `{"time":"1970-01-01T00:00:00Z","conn":2,"event":"unanswered","direction":"down","request_id":5,` +
+		`"latency_ms":1.5,"flag":"unanswered"}` + "\n"
+	if buf.String() != want {
+		t.Errorf("JSONLogger() wrote %s, want %s", buf.String(), want)
+	}
+}
+
+func TestConnection_slowLog(t *testing.T) {
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var logged []*Event
+	conf := Config{ReplyTimeout: time.Second, Log: func(e *Event) {
+		<-release
+		mu.Lock()
+		logged = append(logged, e)
+		mu.Unlock()
+	}}
+	c := &connection{conf: &conf, proto: ndtp.ProtocolName,
+		pending: [2]map[uint32]time.Time{make(map[uint32]time.Time), make(map[uint32]time.Time)}}
+	terminal, client := net.Pipe()
+	upstream, server := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		c.run(client, upstream)
+		close(done)
+	}()
+	nav, err := ndtp.NewNavData(true, []ndtp.Subrecord{&ndtp.NavData{Time: 1522961700}}).Form()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream := bytes.Repeat(nav, 2*tapBufLen/len(nav))
+	go terminal.Write(stream)
+	// data is forwarded, while Log is blocked
+	server.SetReadDeadline(time.Now().Add(5 * time.Second))
+	received := make([]byte, len(stream))
+	if _, err = io.ReadFull(server, received); err != nil {
+		t.Fatalf("forwarding is blocked by Log: %v", err)
+	}
+	close(release)
+	terminal.Close()
+	<-done
+	mu.Lock()
+	defer mu.Unlock()
+	if flags := countFlags(logged); flags[EventError+"/"+FlagDropped] == 0 {
+		t.Errorf("dropped data is not reported, events: %v", flags)
+	}
+}
+
+func TestNew_replyTimeout(t *testing.T) {
+	if _, err := New(Config{ReplyTimeout: time.Nanosecond}); err == nil {
+		t.Error("New() accepted reply timeout of 1 ns")
+	}
+	if _, err := New(Config{ReplyTimeout: -time.Second}); err == nil {
+		t.Error("New() accepted negative reply timeout")
+	}
+}
+
+func TestTap(t *testing.T) {
+	tp := newTap(8)
+	var want, got []byte
+	buf := make([]byte, 1)
+	// reads and writes are interleaved, so read data is removed while unread data is kept
+	for i := byte(0); i < 6; i++ {
+		chunk := []byte{i, i + 100}
+		tp.Write(chunk)
+		want = append(want, chunk...)
+		n, err := tp.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, buf[:n]...)
+	}
+	tp.Write(make([]byte, 8))
+	if dropped := tp.takeDropped(); dropped != 8 {
+		t.Errorf("takeDropped() = %d, want 8", dropped)
+	}
+	tp.CloseWithError(nil)
+	rest, err := ioutil.ReadAll(tp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got = append(got, rest...); !bytes.Equal(got, want) {
+		t.Errorf("read %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,87 @@
+package proxy
+
+import (
+	"io"
+	"sync"
+)
+
+// tapBufLen is max size of forwarded data waiting for decoding
+const tapBufLen = 1 << 20
+
+// tap is a buffer between forwarding and decoding of one direction. Write never blocks, data is dropped
+// if decoder falls behind by more than limit bytes, so slow Log doesn't throttle forwarded traffic.
+type tap struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+	// buf[off:] is data waiting for decoding, read data is removed when it's not less than unread data,
+	// so every byte is moved at most once on average
+	buf     []byte
+	off     int
+	limit   int
+	dropped int
+	closed  bool
+	err     error
+}
+
+func newTap(limit int) *tap {
+	t := &tap{limit: limit}
+	t.cond = sync.NewCond(&t.mu)
+	return t
+}
+
+// Write appends p to buffer or drops it, if buffer is full
+func (t *tap) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	if len(t.buf)-t.off+len(p) > t.limit {
+		t.dropped += len(p)
+	} else {
+		if t.off > 0 && t.off >= len(t.buf)-t.off {
+			t.buf = t.buf[:copy(t.buf, t.buf[t.off:])]
+			t.off = 0
+		}
+		t.buf = append(t.buf, p...)
+	}
+	t.mu.Unlock()
+	t.cond.Signal()
+	return len(p), nil
+}
+
+// CloseWithError makes Read return err after buffered data, io.EOF is returned if err is nil
+func (t *tap) CloseWithError(err error) {
+	t.mu.Lock()
+	t.closed = true
+	t.err = err
+	t.mu.Unlock()
+	t.cond.Signal()
+}
+
+// Read waits for buffered data
+func (t *tap) Read(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for t.off == len(t.buf) && !t.closed {
+		t.cond.Wait()
+	}
+	if t.off == len(t.buf) {
+		if t.err != nil {
+			return 0, t.err
+		}
+		return 0, io.EOF
+	}
+	n := copy(p, t.buf[t.off:])
+	t.off += n
+	if t.off == len(t.buf) {
+		t.buf = t.buf[:0]
+		t.off = 0
+	}
+	return n, nil
+}
+
+// takeDropped returns number of bytes dropped since the previous call
+func (t *tap) takeDropped() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n := t.dropped
+	t.dropped = 0
+	return n
+}
@@ -0,0 +1,366 @@
+/*
+Package queue provides persistent FIFO queue of messages stored in local files.
+Messages are appended to data file and stay in queue until they are acknowledged, acknowledgements
+are appended to separate file. Only positions of unacknowledged messages are kept in memory, their data
+is read from file when it's requested, so queue can grow beyond available memory. Unacknowledged messages
+are found again when queue is opened, so they survive restarts. Acknowledged messages are removed from
+data file by compaction.
+*/
+package queue
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+const (
+	dataFile = "data"
+	ackFile  = "acks"
+	// headerLen is length of message header: sequence number, data length and CRC32 of data
+	headerLen = 16
+	// MaxMessageSize is max length of message data
+	MaxMessageSize = 1 << 20
+	// compactSize is size of acknowledged messages, after which data file is compacted
+	compactSize = 16 << 20
+	// emptyCompactSize is size of acknowledged messages, after which data file is compacted, if queue is empty
+	emptyCompactSize = 1 << 20
+)
+
+// ErrClosed is returned by methods of closed queue
+var ErrClosed = errors.New("queue is closed")
+
+// Item is a message of queue
+type Item struct {
+	// Seq is sequence number of message, it increases with every message.
+	// Numbering starts from 1 again, if queue is opened empty.
+	Seq  uint64
+	Data []byte
+}
+
+// position is location of message data in data file
+type position struct {
+	offset int64
+	length int
+}
+
+// Queue is persistent queue stored in directory. Queue is safe for concurrent use.
+type Queue struct {
+	// SyncWrites makes Put and Ack wait until message or acknowledgement is written to disk, otherwise
+	// message can be lost or acknowledged message can be delivered again after crash of operating system,
+	// but not after crash of process
+	SyncWrites bool
+
+	dir  string
+	mu   sync.Mutex
+	data *os.File
+	acks *os.File
+	// dataLen is length of data file, it's restored after failed write
+	dataLen int64
+	// err is set, if data file can't be restored after failed write, then Put always fails
+	err      error
+	nextSeq  uint64
+	order    []uint64
+	pending  map[uint64]position
+	ackedLen int64
+	closed   bool
+}
+
+// Open opens queue stored in dir, directory is created if it doesn't exist.
+// Incomplete message at the end of data file, which can be left after crash, is discarded.
+// Corrupted parts of data file are skipped, correct messages after them are kept.
+func Open(dir string) (*Queue, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	q := &Queue{dir: dir, nextSeq: 1, pending: make(map[uint64]position)}
+	data, err := os.OpenFile(filepath.Join(dir, dataFile), os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	q.data = data
+	acked, err := readAcks(filepath.Join(dir, ackFile))
+	if err == nil {
+		err = readData(data, func(seq uint64, pos position) {
+			if seq >= q.nextSeq {
+				q.nextSeq = seq + 1
+			}
+			if !acked[seq] {
+				q.order = append(q.order, seq)
+				q.pending[seq] = pos
+			}
+		})
+	}
+	if err == nil {
+		err = q.rewrite()
+	}
+	if err != nil {
+		q.data.Close()
+		return nil, err
+	}
+	return q, nil
+}
+
+// readData calls found for every message of data file. Corrupted bytes are skipped up to the next correct
+// message, so messages after corruption are recovered. Incomplete message at the end of file is discarded.
+func readData(f *os.File, found func(seq uint64, pos position)) error {
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	r := bufio.NewReaderSize(io.NewSectionReader(f, 0, info.Size()), headerLen+MaxMessageSize)
+	var offset int64
+	var lastSeq uint64
+	for {
+		buf, err := r.Peek(headerLen)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		length := binary.LittleEndian.Uint32(buf[8:12])
+		if length <= MaxMessageSize {
+			// message is checked only if it's complete, Peek returns EOF otherwise
+			buf, err = r.Peek(headerLen + int(length))
+			if err != nil && err != io.EOF {
+				return err
+			}
+		}
+		seq, data, ok := decode(buf)
+		if !ok || seq <= lastSeq {
+			r.Discard(1)
+			offset++
+			continue
+		}
+		found(seq, position{offset: offset + headerLen, length: len(data)})
+		lastSeq = seq
+		r.Discard(headerLen + len(data))
+		offset += int64(headerLen + len(data))
+	}
+}
+
+// decode returns message at the beginning of buf, if its length and CRC are correct
+func decode(buf []byte) (seq uint64, data []byte, ok bool) {
+	length := binary.LittleEndian.Uint32(buf[8:12])
+	if length > MaxMessageSize || int(length) > len(buf)-headerLen {
+		return 0, nil, false
+	}
+	data = buf[headerLen : headerLen+int(length)]
+	if crc32.ChecksumIEEE(data) != binary.LittleEndian.Uint32(buf[12:16]) {
+		return 0, nil, false
+	}
+	return binary.LittleEndian.Uint64(buf[:8]), data, true
+}
+
+func readAcks(name string) (map[uint64]bool, error) {
+	buf, err := ioutil.ReadFile(name)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	acked := make(map[uint64]bool, len(buf)/8)
+	for len(buf) >= 8 {
+		acked[binary.LittleEndian.Uint64(buf[:8])] = true
+		buf = buf[8:]
+	}
+	return acked, nil
+}
+
+// rewrite copies pending messages to new data file and clears acknowledgements
+func (q *Queue) rewrite() error {
+	tmpName := filepath.Join(q.dir, dataFile+".tmp")
+	tmp, err := os.Create(tmpName)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(tmp)
+	moved := make(map[uint64]position, len(q.pending))
+	var size int64
+	for _, seq := range q.order {
+		data, err := q.read(q.pending[seq])
+		if err == nil {
+			_, err = w.Write(encode(seq, data))
+		}
+		if err != nil {
+			tmp.Close()
+			return err
+		}
+		moved[seq] = position{offset: size + headerLen, length: len(data)}
+		size += int64(headerLen + len(data))
+	}
+	if err = w.Flush(); err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	q.data.Close()
+	if err = os.Rename(tmpName, filepath.Join(q.dir, dataFile)); err != nil {
+		return err
+	}
+	if q.data, err = os.OpenFile(filepath.Join(q.dir, dataFile), os.O_RDWR|os.O_APPEND, 0644); err != nil {
+		return err
+	}
+	q.pending = moved
+	q.dataLen = size
+	q.err = nil
+	if q.acks != nil {
+		q.acks.Close()
+	}
+	q.acks, err = os.OpenFile(filepath.Join(q.dir, ackFile), os.O_CREATE|os.O_WRONLY|os.O_TRUNC|os.O_APPEND, 0644)
+	q.ackedLen = 0
+	return err
+}
+
+// read returns message data from data file
+func (q *Queue) read(pos position) ([]byte, error) {
+	data := make([]byte, pos.length)
+	if _, err := q.data.ReadAt(data, pos.offset); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func encode(seq uint64, data []byte) []byte {
+	buf := make([]byte, headerLen+len(data))
+	binary.LittleEndian.PutUint64(buf[:8], seq)
+	binary.LittleEndian.PutUint32(buf[8:12], uint32(len(data)))
+	binary.LittleEndian.PutUint32(buf[12:16], crc32.ChecksumIEEE(data))
+	copy(buf[headerLen:], data)
+	return buf
+}
+
+// Put appends message to queue and returns its sequence number
+func (q *Queue) Put(data []byte) (uint64, error) {
+	if len(data) > MaxMessageSize {
+		return 0, errors.New("message is too large")
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return 0, ErrClosed
+	}
+	if q.err != nil {
+		return 0, q.err
+	}
+	seq := q.nextSeq
+	message := encode(seq, data)
+	_, err := q.data.Write(message)
+	if err == nil && q.SyncWrites {
+		err = q.data.Sync()
+	}
+	if err != nil {
+		// partial message is removed, so it doesn't precede the next messages
+		if terr := q.data.Truncate(q.dataLen); terr != nil {
+			q.err = terr
+		}
+		return 0, err
+	}
+	q.pending[seq] = position{offset: q.dataLen + headerLen, length: len(data)}
+	q.dataLen += int64(len(message))
+	q.nextSeq++
+	q.order = append(q.order, seq)
+	return seq, nil
+}
+
+// Ack removes message with sequence number seq from queue. Messages can be acknowledged in any order.
+func (q *Queue) Ack(seq uint64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return ErrClosed
+	}
+	pos, ok := q.pending[seq]
+	if !ok {
+		return nil
+	}
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], seq)
+	_, err := q.acks.Write(buf[:])
+	if err == nil && q.SyncWrites {
+		err = q.acks.Sync()
+	}
+	if err != nil {
+		return err
+	}
+	delete(q.pending, seq)
+	q.ackedLen += int64(headerLen + pos.length)
+	for len(q.order) > 0 {
+		if _, ok := q.pending[q.order[0]]; ok {
+			break
+		}
+		q.order = q.order[1:]
+	}
+	if q.ackedLen > compactSize || len(q.pending) == 0 && q.ackedLen > emptyCompactSize {
+		return q.rewrite()
+	}
+	return nil
+}
+
+// Unacked returns up to limit unacknowledged messages with sequence numbers greater than after.
+// Data of messages is read from disk.
+func (q *Queue) Unacked(after uint64, limit int) ([]Item, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return nil, ErrClosed
+	}
+	i := sort.Search(len(q.order), func(i int) bool { return q.order[i] > after })
+	var items []Item
+	for ; i < len(q.order) && len(items) < limit; i++ {
+		pos, ok := q.pending[q.order[i]]
+		if !ok {
+			continue
+		}
+		data, err := q.read(pos)
+		if err != nil {
+			return items, err
+		}
+		items = append(items, Item{Seq: q.order[i], Data: data})
+	}
+	return items, nil
+}
+
+// Last returns the greatest sequence number of unacknowledged messages, 0 is returned if queue is empty
+func (q *Queue) Last() uint64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i := len(q.order) - 1; i >= 0; i-- {
+		if _, ok := q.pending[q.order[i]]; ok {
+			return q.order[i]
+		}
+	}
+	return 0
+}
+
+// Len returns number of unacknowledged messages
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.pending)
+}
+
+// Close closes files of queue
+func (q *Queue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return ErrClosed
+	}
+	q.closed = true
+	err := q.data.Close()
+	if aerr := q.acks.Close(); err == nil {
+		err = aerr
+	}
+	return err
+}
@@ -0,0 +1,176 @@
+package queue
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "queue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func unacked(t *testing.T, q *Queue, after uint64, limit int) []Item {
+	items, err := q.Unacked(after, limit)
+	if err != nil {
+		t.Fatalf("Unacked() error = %v", err)
+	}
+	return items
+}
+
+func TestQueue(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	q, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, data := range []string{"one", "two", "three"} {
+		if _, err = q.Put([]byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = q.Ack(2); err != nil {
+		t.Fatal(err)
+	}
+	want := []Item{{Seq: 1, Data: []byte("one")}, {Seq: 3, Data: []byte("three")}}
+	if got := unacked(t, q, 0, 10); !reflect.DeepEqual(got, want) {
+		t.Errorf("Unacked() = %v, want %v", got, want)
+	}
+	if got := unacked(t, q, 1, 10); !reflect.DeepEqual(got, want[1:]) {
+		t.Errorf("Unacked(1) = %v, want %v", got, want[1:])
+	}
+	if got := unacked(t, q, 0, 1); !reflect.DeepEqual(got, want[:1]) {
+		t.Errorf("Unacked(0, 1) = %v, want %v", got, want[:1])
+	}
+	if last := q.Last(); last != 3 {
+		t.Errorf("Last() = %d, want 3", last)
+	}
+	if err = q.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = q.Put(nil); err != ErrClosed {
+		t.Errorf("Put() after Close error = %v, want %v", err, ErrClosed)
+	}
+	if _, err = q.Unacked(0, 10); err != ErrClosed {
+		t.Errorf("Unacked() after Close error = %v, want %v", err, ErrClosed)
+	}
+
+	// incomplete message at the end of file is discarded
+	f, err := os.OpenFile(filepath.Join(dir, dataFile), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write(encode(4, []byte("four"))[:10])
+	f.Close()
+
+	if q, err = Open(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	if got := unacked(t, q, 0, 10); !reflect.DeepEqual(got, want) || q.Len() != 2 {
+		t.Errorf("Unacked() after reopening = %v, want %v", got, want)
+	}
+	if seq, err := q.Put([]byte("four")); err != nil || seq != 4 {
+		t.Errorf("Put() = %d, %v, want 4", seq, err)
+	}
+}
+
+func TestQueue_compaction(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	q, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	data := make([]byte, MaxMessageSize)
+	for i := 0; i < 2; i++ {
+		if _, err = q.Put(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = q.Ack(1); err != nil {
+		t.Fatal(err)
+	}
+	if err = q.Ack(2); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{dataFile, ackFile} {
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() != 0 {
+			t.Errorf("%s file is not compacted, size %d", name, info.Size())
+		}
+	}
+	if _, err := q.Put([]byte("next")); err != nil {
+		t.Fatal(err)
+	}
+	if got := unacked(t, q, 0, 10); len(got) != 1 || got[0].Seq != 3 {
+		t.Errorf("Unacked() after compaction = %v", got)
+	}
+}
+
+func TestQueue_corruption(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	var file []byte
+	for i, data := range []string{"one", "two", "three"} {
+		file = append(file, encode(uint64(i+1), []byte(data))...)
+	}
+	// CRC of the second message is broken, the third message must be recovered
+	file[headerLen+3+12]++
+	if err := ioutil.WriteFile(filepath.Join(dir, dataFile), file, 0644); err != nil {
+		t.Fatal(err)
+	}
+	q, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	want := []Item{{Seq: 1, Data: []byte("one")}, {Seq: 3, Data: []byte("three")}}
+	if got := unacked(t, q, 0, 10); !reflect.DeepEqual(got, want) {
+		t.Errorf("Unacked() = %v, want %v", got, want)
+	}
+	if seq, err := q.Put([]byte("four")); err != nil || seq != 4 {
+		t.Errorf("Put() = %d, %v, want 4", seq, err)
+	}
+}
+
+func TestQueue_failedPut(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	q, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = q.Put([]byte("one")); err != nil {
+		t.Fatal(err)
+	}
+	// data file can be neither written nor truncated, so queue refuses further messages
+	q.data.Close()
+	if _, err = q.Put([]byte("two")); err == nil {
+		t.Fatal("Put() to closed file succeeded")
+	}
+	if _, err = q.Put([]byte("three")); err == nil {
+		t.Error("Put() after failed truncation succeeded")
+	}
+	q.acks.Close()
+	q.closed = true
+
+	if q, err = Open(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	if got := unacked(t, q, 0, 10); len(got) != 1 || string(got[0].Data) != "one" {
+		t.Errorf("Unacked() after reopening = %v", got)
+	}
+}
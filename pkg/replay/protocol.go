@@ -0,0 +1,83 @@
+package replay
+
+import (
+	"fmt"
+
+	"github.com/egorban/navprot/pkg/egts"
+	"github.com/egorban/navprot/pkg/ndtp"
+)
+
+// ndtpProtocol expects NPH_RESULT with the same NPH request ID for packets with request flag
+type ndtpProtocol struct {
+	dec *ndtp.Decoder
+}
+
+func (p *ndtpProtocol) prepare(packet []byte, id uint32) ([]byte, uint32, bool) {
+	var parsed ndtp.Packet
+	if _, err := parsed.Parse(packet); err != nil || parsed.IsResult() || !parsed.NeedReply() {
+		return packet, 0, false
+	}
+	data := append([]byte(nil), packet...)
+	return ndtp.Change(data, map[string]int{ndtp.NphReqID: int(id)}), id, true
+}
+
+func (p *ndtpProtocol) readReply() (reply, error) {
+	for {
+		packet, err := p.dec.Decode()
+		if packet == nil {
+			if err == ndtp.ErrCRC || err == ndtp.ErrPacketTooLarge {
+				continue
+			}
+			return reply{}, err
+		}
+		if err != nil || !packet.IsResult() {
+			continue
+		}
+		if code, _ := packet.Nph.Data.(uint32); code != ndtp.NphResultOk {
+			return reply{id: packet.Nph.ReqID, err: fmt.Errorf("NPH_RESULT %d", code)}, nil
+		}
+		return reply{id: packet.Nph.ReqID}, nil
+	}
+}
+
+// egtsProtocol expects EGTS_PT_RESPONSE with the same packet ID for EGTS_PT_APPDATA packets
+type egtsProtocol struct {
+	dec *egts.Decoder
+}
+
+func (p *egtsProtocol) prepare(packet []byte, id uint32) ([]byte, uint32, bool) {
+	var parsed egts.Packet
+	if _, err := parsed.Parse(packet); err != nil || parsed.Type != egts.EgtsPtAppdata {
+		return packet, 0, false
+	}
+	id &= 0xFFFF
+	data := append([]byte(nil), packet...)
+	return egts.Change(data, map[string]int{egts.PacketID: int(id)}), id, true
+}
+
+func (p *egtsProtocol) readReply() (reply, error) {
+	for {
+		packet, err := p.dec.Decode()
+		if packet == nil {
+			if err == egts.ErrCRC || err == egts.ErrPacketTooLarge {
+				continue
+			}
+			return reply{}, err
+		}
+		resp, ok := packet.Data.(*egts.Response)
+		if err != nil || packet.Type != egts.EgtsPtResponse || !ok {
+			continue
+		}
+		if resp.ProcRes != egts.Success {
+			return reply{id: uint32(resp.RPID), err: &egts.ResultError{Code: resp.ProcRes}}, nil
+		}
+		for _, rec := range packet.Records {
+			for _, sub := range rec.Data {
+				if conf, ok := sub.Data.(*egts.Confirmation); ok && conf.RST != egts.Success {
+					return reply{id: uint32(resp.RPID), err: &egts.ResultError{Code: conf.RST}}, nil
+				}
+			}
+		}
+		return reply{id: uint32(resp.RPID)}, nil
+	}
+}
@@ -0,0 +1,270 @@
+/*
+Package replay sends recorded NDTP or EGTS packets to server with original or scaled timing,
+checks that every request is answered and measures reply latency.
+*/
+package replay
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/egorban/navprot/pkg/egts"
+	"github.com/egorban/navprot/pkg/ndtp"
+)
+
+// DefaultReplyTimeout is default time to wait for reply
+const DefaultReplyTimeout = 5 * time.Second
+
+var (
+	// ErrNoReply means that reply was not received during ReplyTimeout
+	ErrNoReply = errors.New("no reply")
+	// ErrUnexpectedReply means that reply doesn't match any sent request
+	ErrUnexpectedReply = errors.New("unexpected reply")
+)
+
+// Record is recorded packet
+type Record struct {
+	// Time of recording, packets are sent with delays equal to differences of their times.
+	// Zero time means, that packet is sent immediately after the previous one.
+	Time time.Time
+	// Data is binary packet
+	Data []byte
+}
+
+// Config contains replay parameters
+type Config struct {
+	// Protocol is ndtp.ProtocolName or egts.ProtocolName
+	Protocol string
+	// Speed is factor of replay speed, 1 keeps original timing, 0 sends packets as fast as possible
+	Speed float64
+	// ReplyTimeout is max time to wait for reply, DefaultReplyTimeout is used if it's zero
+	ReplyTimeout time.Duration
+}
+
+// Result describes replay of one record
+type Result struct {
+	// Index of record
+	Index int
+	// ID is request identifier written to packet: NPH request ID of NDTP or packet ID of EGTS
+	ID uint32
+	// Sent is time of sending
+	Sent time.Time
+	// Latency is time between sending and receiving reply
+	Latency time.Duration
+	// Err is ErrNoReply or error describing unsuccessful result of reply
+	Err error
+}
+
+// Report contains results of requests in order of sending and replies not matching any request
+type Report struct {
+	Results []Result
+	// Unexpected is number of replies to unknown requests
+	Unexpected int
+}
+
+// Summary contains statistics of report
+type Summary struct {
+	Sent, Replied, Failed, Lost, Unexpected int
+	Min, Max, P50, P95, P99                 time.Duration
+}
+
+// Summary calculates statistics of report
+func (r *Report) Summary() Summary {
+	s := Summary{Unexpected: r.Unexpected}
+	var latencies []time.Duration
+	for _, res := range r.Results {
+		s.Sent++
+		switch {
+		case res.Err == ErrNoReply:
+			s.Lost++
+			continue
+		case res.Err != nil:
+			s.Failed++
+		}
+		s.Replied++
+		latencies = append(latencies, res.Latency)
+	}
+	if len(latencies) == 0 {
+		return s
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	s.Min = latencies[0]
+	s.Max = latencies[len(latencies)-1]
+	s.P50 = percentile(latencies, 50)
+	s.P95 = percentile(latencies, 95)
+	s.P99 = percentile(latencies, 99)
+	return s
+}
+
+func percentile(sorted []time.Duration, p int) time.Duration {
+	return sorted[(len(sorted)*p+99)/100-1]
+}
+
+func (s Summary) String() string {
+	return fmt.Sprintf("sent %d, replied %d, failed %d, lost %d, unexpected %d; latency min %v, p50 %v, p95 %v, p99 %v, max %v",
+		s.Sent, s.Replied, s.Failed, s.Lost, s.Unexpected, s.Min, s.P50, s.P95, s.P99, s.Max)
+}
+
+// reply contains request identifier and error describing unsuccessful result
+type reply struct {
+	id       uint32
+	err      error
+	received time.Time
+}
+
+// Run sends records to conn and waits for replies. Request identifiers are rewritten sequentially
+// starting from 1, so replies of different runs can't be confused. Run returns after all requests are
+// answered or timed out. If connection is closed by server, requests without reply are marked as lost
+// and read error is returned together with report. Connection is not closed by Run.
+func Run(conn net.Conn, records []Record, conf Config) (*Report, error) {
+	proto, err := newProtocol(conf.Protocol, conn)
+	if err != nil {
+		return nil, err
+	}
+	if conf.ReplyTimeout <= 0 {
+		conf.ReplyTimeout = DefaultReplyTimeout
+	}
+	r := &runner{
+		conn:    conn,
+		conf:    conf,
+		proto:   proto,
+		report:  new(Report),
+		pending: make(map[uint32]int),
+		replies: make(chan reply),
+		readErr: make(chan error, 1),
+		done:    make(chan struct{}),
+	}
+	go r.read()
+	defer close(r.done)
+	return r.run(records)
+}
+
+type runner struct {
+	conn    net.Conn
+	conf    Config
+	proto   protocol
+	report  *Report
+	pending map[uint32]int
+	replies chan reply
+	readErr chan error
+	done    chan struct{}
+}
+
+func (r *runner) run(records []Record) (*Report, error) {
+	start := time.Now()
+	var first time.Time
+	for i, rec := range records {
+		if !rec.Time.IsZero() && first.IsZero() {
+			first = rec.Time
+		}
+		if r.conf.Speed > 0 && !rec.Time.IsZero() {
+			due := start.Add(time.Duration(float64(rec.Time.Sub(first)) / r.conf.Speed))
+			if err := r.waitUntil(due, false); err != nil {
+				return r.report, err
+			}
+		}
+		data, id, needReply := r.proto.prepare(rec.Data, uint32(len(r.report.Results)+1))
+		sent := time.Now()
+		if _, err := r.conn.Write(data); err != nil {
+			return r.report, err
+		}
+		if needReply {
+			// identifiers wrap around, e.g. EGTS packet ID after 65535 requests, so request still waiting
+			// for reply with the same identifier is marked as lost
+			if old, ok := r.pending[id]; ok {
+				r.report.Results[old].Err = ErrNoReply
+			}
+			r.pending[id] = len(r.report.Results)
+			r.report.Results = append(r.report.Results, Result{Index: i, ID: id, Sent: sent})
+		}
+	}
+	return r.report, r.waitUntil(time.Now().Add(r.conf.ReplyTimeout), true)
+}
+
+// waitUntil processes replies until t, or until all requests are answered if untilReplied is set.
+// Requests without reply during ReplyTimeout are marked as lost.
+func (r *runner) waitUntil(t time.Time, untilReplied bool) error {
+	for {
+		now := time.Now()
+		wake := t
+		for id, i := range r.pending {
+			deadline := r.report.Results[i].Sent.Add(r.conf.ReplyTimeout)
+			if !now.Before(deadline) {
+				r.report.Results[i].Err = ErrNoReply
+				delete(r.pending, id)
+			} else if deadline.Before(wake) {
+				wake = deadline
+			}
+		}
+		if untilReplied && len(r.pending) == 0 || !now.Before(t) {
+			return nil
+		}
+		timer := time.NewTimer(wake.Sub(now))
+		select {
+		case rep := <-r.replies:
+			timer.Stop()
+			r.handle(rep)
+		case err := <-r.readErr:
+			timer.Stop()
+			for id, i := range r.pending {
+				r.report.Results[i].Err = ErrNoReply
+				delete(r.pending, id)
+			}
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+func (r *runner) handle(rep reply) {
+	i, ok := r.pending[rep.id]
+	if !ok {
+		r.report.Unexpected++
+		return
+	}
+	delete(r.pending, rep.id)
+	res := &r.report.Results[i]
+	res.Latency = rep.received.Sub(res.Sent)
+	res.Err = rep.err
+}
+
+func (r *runner) read() {
+	for {
+		rep, err := r.proto.readReply()
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			r.readErr <- err
+			return
+		}
+		rep.received = time.Now()
+		select {
+		case r.replies <- rep:
+		case <-r.done:
+			return
+		}
+	}
+}
+
+// protocol rewrites request identifiers and recognizes replies
+type protocol interface {
+	// prepare writes request identifier id to packet, needReply is false for packets without reply
+	prepare(packet []byte, id uint32) (data []byte, replyID uint32, needReply bool)
+	// readReply reads the next reply, reply error is set for unsuccessful result code
+	readReply() (reply, error)
+}
+
+func newProtocol(name string, conn net.Conn) (protocol, error) {
+	switch name {
+	case ndtp.ProtocolName:
+		return &ndtpProtocol{dec: ndtp.NewDecoder(conn)}, nil
+	case egts.ProtocolName:
+		return &egtsProtocol{dec: egts.NewDecoder(conn)}, nil
+	}
+	return nil, fmt.Errorf("unknown protocol %q", name)
+}
@@ -0,0 +1,168 @@
+package replay
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/egorban/navprot/internal/testserver"
+	"github.com/egorban/navprot/pkg/egts"
+	"github.com/egorban/navprot/pkg/ndtp"
+)
+
+func ndtpRecords(t *testing.T, start time.Time) []Record {
+	conn, err := ndtp.NewConnRequest(1024).Form()
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := []Record{{Time: start, Data: conn}}
+	for i := 1; i <= 3; i++ {
+		nav, err := ndtp.NewNavData(true, []ndtp.Subrecord{&ndtp.NavData{Time: uint32(1522961700 + i)}}).Form()
+		if err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, Record{Time: start.Add(time.Duration(i) * 100 * time.Millisecond), Data: nav})
+	}
+	return records
+}
+
+func TestRun_NDTP(t *testing.T) {
+	l := testserver.Listen(t, "127.0.0.1:0", func(conn net.Conn) {
+		dec := ndtp.NewDecoder(conn)
+		for n := 0; ; n++ {
+			packet, err := dec.Decode()
+			if err != nil {
+				return
+			}
+			switch n {
+			case 2:
+				conn.Write(packet.Reply(ndtp.NphResultServiceNotAvailable))
+			case 3:
+			default:
+				conn.Write(packet.Reply(ndtp.NphResultOk))
+			}
+		}
+	})
+	defer l.Close()
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	records := ndtpRecords(t, time.Now())
+	report, err := Run(conn, records, Config{Protocol: ndtp.ProtocolName, Speed: 2, ReplyTimeout: 200 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if len(report.Results) != 4 {
+		t.Fatalf("Run() returned %d results, want 4", len(report.Results))
+	}
+	for i, res := range report.Results {
+		if res.Index != i || res.ID != uint32(i+1) {
+			t.Errorf("result %d = %+v", i, res)
+		}
+	}
+	if report.Results[0].Err != nil || report.Results[1].Err != nil || report.Results[2].Err == nil ||
+		report.Results[3].Err != ErrNoReply {
+		t.Errorf("incorrect results %+v", report.Results)
+	}
+	if d := report.Results[3].Sent.Sub(report.Results[0].Sent); d < 140*time.Millisecond {
+		t.Errorf("records are sent during %v, want at least 150ms at double speed", d)
+	}
+	s := report.Summary()
+	if s.Sent != 4 || s.Replied != 3 || s.Failed != 1 || s.Lost != 1 || s.Max < s.Min {
+		t.Errorf("Summary() = %v", s)
+	}
+}
+
+func TestRun_EGTS(t *testing.T) {
+	l := testserver.Listen(t, "127.0.0.1:0", func(conn net.Conn) {
+		dec := egts.NewDecoder(conn)
+		for {
+			packet, err := dec.Decode()
+			if err != nil {
+				return
+			}
+			resp := &egts.Packet{Type: egts.EgtsPtResponse, ID: packet.ID, Data: &egts.Response{RPID: packet.ID}}
+			if packet.ID == 2 {
+				resp.Data.(*egts.Response).ProcRes = egts.EgtsPcDataCrcError
+			}
+			message, _ := resp.Form()
+			conn.Write(message)
+		}
+	})
+	defer l.Close()
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	packet := &egts.Packet{Type: egts.EgtsPtAppdata, ID: 7, Records: []*egts.Record{{
+		ID:      100,
+		Service: egts.EgtsTeledataService,
+		Data:    []*egts.SubRecord{{Type: egts.EgtsSrLiquidLevelSensor, Data: &egts.FuelData{Type: 2, Fuel: 30}}},
+	}}}
+	message, err := packet.Form()
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := []Record{{Data: message}, {Data: message}, {Data: message}}
+	report, err := Run(conn, records, Config{Protocol: egts.ProtocolName, ReplyTimeout: time.Second})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	s := report.Summary()
+	if s.Sent != 3 || s.Replied != 3 || s.Failed != 1 || s.Lost != 0 || s.Unexpected != 0 {
+		t.Errorf("Summary() = %v", s)
+	}
+	if err, ok := report.Results[1].Err.(*egts.ResultError); !ok || err.Code != egts.EgtsPcDataCrcError {
+		t.Errorf("result error = %v", report.Results[1].Err)
+	}
+}
+
+func TestRun_identifierWrap(t *testing.T) {
+	const count = 0x10001
+	// the only reply is sent after all requests, when packet ID 1 belongs to the last request
+	l := testserver.Listen(t, "127.0.0.1:0", func(conn net.Conn) {
+		dec := egts.NewDecoder(conn)
+		for i := 0; i < count; i++ {
+			if _, err := dec.Decode(); err != nil {
+				return
+			}
+		}
+		resp := &egts.Packet{Type: egts.EgtsPtResponse, Data: &egts.Response{RPID: 1}}
+		message, _ := resp.Form()
+		conn.Write(message)
+		dec.Decode()
+	})
+	defer l.Close()
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	message, err := (&egts.Packet{Type: egts.EgtsPtAppdata}).Form()
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := make([]Record, count)
+	for i := range records {
+		records[i].Data = message
+	}
+	report, err := Run(conn, records, Config{Protocol: egts.ProtocolName, ReplyTimeout: time.Second})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if s := report.Summary(); s.Replied != 1 || s.Lost != count-1 {
+		t.Errorf("Summary() = %v", s)
+	}
+	if res := report.Results[count-1]; res.Err != nil {
+		t.Errorf("result of the last request = %v, want reply", res.Err)
+	}
+}
+
+func TestRun_unknownProtocol(t *testing.T) {
+	if _, err := Run(nil, nil, Config{Protocol: "photo"}); err == nil {
+		t.Error("Run() with unknown protocol succeeded")
+	}
+}
@@ -0,0 +1,165 @@
+package retranslator
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/egorban/navprot/pkg/convertation"
+	"github.com/egorban/navprot/pkg/egts"
+	"github.com/egorban/navprot/pkg/ndtp"
+)
+
+// Default values of Config
+const (
+	DefaultReconnectInterval = 5 * time.Second
+	DefaultIdleTimeout       = 10 * time.Minute
+	DefaultDialTimeout       = 10 * time.Second
+)
+
+// Duration is time.Duration encoded in JSON as string like "5s" or number of nanoseconds
+type Duration time.Duration
+
+// UnmarshalJSON decodes duration from string in time.ParseDuration format or number of nanoseconds
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	if s, err := strconv.Unquote(string(b)); err == nil {
+		parsed, err := time.ParseDuration(s)
+		*d = Duration(parsed)
+		return err
+	}
+	var n int64
+	err := json.Unmarshal(b, &n)
+	*d = Duration(n)
+	return err
+}
+
+// MarshalJSON encodes duration as string
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(time.Duration(d).String())), nil
+}
+
+// Config contains parameters of retranslator
+type Config struct {
+	// Listen is address to accept NDTP terminals on
+	Listen string `json:"listen"`
+	// QueueDir is directory of queues, queue of every upstream is stored in subdirectory named by upstream
+	QueueDir string `json:"queue_dir"`
+	// SyncWrites makes queues wait until data is written to disk before reply to terminal and until
+	// confirmation of upstream is written to disk
+	SyncWrites bool `json:"sync_writes"`
+	// Upstreams are EGTS or NDTP servers, data is forwarded to every upstream according to its filter
+	Upstreams []UpstreamConfig `json:"upstreams"`
+	// Profile defines mapping of data (optional), it's read from "profile" object by LoadConfig
+	Profile *convertation.Profile `json:"-"`
+	// IdleTimeout is max time to wait for the next packet from terminal, DefaultIdleTimeout is used if it's zero
+	// Connections of objects to NDTP upstreams are closed after the same time without data.
+	IdleTimeout Duration `json:"idle_timeout"`
+	// ReconnectInterval is delay before reconnecting to upstream, DefaultReconnectInterval is used if it's zero
+	ReconnectInterval Duration `json:"reconnect_interval"`
+	// DialTimeout is timeout of connecting to upstream, DefaultDialTimeout is used if it's zero
+	DialTimeout Duration `json:"dial_timeout"`
+	// ResponseTimeout is time to wait for EGTS_PT_RESPONSE, egts.DefaultResponseTimeout is used if it's zero
+	ResponseTimeout Duration `json:"response_timeout"`
+}
+
+// UpstreamConfig describes target server, its ID mapping and filter
+type UpstreamConfig struct {
+	// Name identifies upstream in statistics and names its queue directory
+	Name string `json:"name"`
+	// Addr is address host:port
+	Addr string `json:"addr"`
+	// Protocol is egts.ProtocolName (default) or ndtp.ProtocolName
+	Protocol string `json:"protocol"`
+	// IDMap maps terminal IDs to object IDs of upstream, unmapped terminals keep their IDs
+	IDMap map[uint32]uint32 `json:"id_map"`
+	// Objects contains terminal IDs forwarded to upstream, all terminals are forwarded if it's empty
+	Objects []uint32 `json:"objects"`
+	// Types contains names of forwarded general types (convertation.ForwardNav etc.),
+	// all types are forwarded if it's empty. Sensors and counters can't be forwarded to NDTP upstream.
+	Types []string `json:"types"`
+}
+
+var upstreamName = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// LoadConfig reads config in JSON format. Omitted fields of profile have default values.
+func LoadConfig(r io.Reader) (*Config, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	conf := new(Config)
+	if err = json.Unmarshal(data, conf); err != nil {
+		return nil, err
+	}
+	var raw struct {
+		Profile json.RawMessage `json:"profile"`
+	}
+	if err = json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	if len(raw.Profile) > 0 && string(raw.Profile) != "null" {
+		if conf.Profile, err = convertation.LoadProfile(bytes.NewReader(raw.Profile)); err != nil {
+			return nil, err
+		}
+	}
+	if err = conf.validate(); err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
+
+// LoadConfigFile reads config from JSON file
+func LoadConfigFile(name string) (*Config, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return LoadConfig(f)
+}
+
+func (conf *Config) validate() error {
+	if conf.QueueDir == "" {
+		return errors.New("queue_dir is not set")
+	}
+	if len(conf.Upstreams) == 0 {
+		return errors.New("no upstreams")
+	}
+	names := make(map[string]bool)
+	for _, u := range conf.Upstreams {
+		if !upstreamName.MatchString(u.Name) || u.Name == "." || u.Name == ".." {
+			return fmt.Errorf("incorrect upstream name %q", u.Name)
+		}
+		if names[u.Name] {
+			return fmt.Errorf("duplicate upstream name %q", u.Name)
+		}
+		names[u.Name] = true
+		if u.Addr == "" {
+			return fmt.Errorf("address of upstream %q is not set", u.Name)
+		}
+		switch u.Protocol {
+		case "", egts.ProtocolName, ndtp.ProtocolName:
+		default:
+			return fmt.Errorf("unknown protocol %q of upstream %q", u.Protocol, u.Name)
+		}
+		for _, name := range u.Types {
+			switch name {
+			case convertation.ForwardNav, convertation.ForwardFuel:
+			case convertation.ForwardSensors, convertation.ForwardCounters:
+				if u.Protocol == ndtp.ProtocolName {
+					return fmt.Errorf("type %q can't be forwarded to NDTP upstream %q", name, u.Name)
+				}
+			default:
+				return fmt.Errorf("unknown type %q of upstream %q", name, u.Name)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+/*
+Package retranslator provides service, which accepts NDTP terminals and forwards their navigation data
+to one or more EGTS or NDTP servers. Router converts data for every upstream according to its ID mapping
+and filter. Converted packets are stored in on-disk queue of every upstream before reply to terminal and
+stay there until upstream confirms them, so data is resent after reconnection or restart of service.
+*/
+package retranslator
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/egorban/navprot/pkg/general"
+	"github.com/egorban/navprot/pkg/ndtp"
+)
+
+// ErrServiceClosed is returned by Serve after Close
+var ErrServiceClosed = errors.New("retranslator is closed")
+
+// Service is retranslator of NDTP terminals
+type Service struct {
+	conf   Config
+	router *Router
+
+	mu       sync.Mutex
+	closed   bool
+	stop     chan struct{}
+	listener net.Listener
+	sessions map[*ndtp.Session]struct{}
+	wg       sync.WaitGroup
+}
+
+// New creates Service and opens queues of upstreams. Zero values in conf are replaced by default values.
+func New(conf Config) (*Service, error) {
+	if conf.IdleTimeout <= 0 {
+		conf.IdleTimeout = Duration(DefaultIdleTimeout)
+	}
+	router, err := NewRouter(conf)
+	if err != nil {
+		return nil, err
+	}
+	return &Service{
+		conf:     conf,
+		router:   router,
+		stop:     make(chan struct{}),
+		sessions: make(map[*ndtp.Session]struct{}),
+	}, nil
+}
+
+// Router returns router of service, it can be used to forward data received from other sources
+func (s *Service) Router() *Router {
+	return s.router
+}
+
+// ListenAndServe listens on Config.Listen address and calls Serve
+func (s *Service) ListenAndServe() error {
+	l, err := net.Listen("tcp", s.conf.Listen)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve starts delivery to upstreams and accepts terminals on l until Close is called,
+// then ErrServiceClosed is returned
+func (s *Service) Serve(l net.Listener) error {
+	s.router.Start()
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		l.Close()
+		return ErrServiceClosed
+	}
+	s.listener = l
+	s.mu.Unlock()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			select {
+			case <-s.stop:
+				return ErrServiceClosed
+			default:
+			}
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				time.Sleep(10 * time.Millisecond)
+				continue
+			}
+			return err
+		}
+		session := ndtp.NewSession(conn, s.handle)
+		session.IdleTimeout = time.Duration(s.conf.IdleTimeout)
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return ErrServiceClosed
+		}
+		s.sessions[session] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+		go func() {
+			defer s.wg.Done()
+			session.Serve()
+			s.mu.Lock()
+			delete(s.sessions, session)
+			s.mu.Unlock()
+		}()
+	}
+}
+
+// Close stops accepting terminals, closes their sessions and connections to upstreams.
+// Unconfirmed packets stay in queues.
+func (s *Service) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrServiceClosed
+	}
+	s.closed = true
+	close(s.stop)
+	if s.listener != nil {
+		s.listener.Close()
+	}
+	for session := range s.sessions {
+		session.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return s.router.Close()
+}
+
+// Stats returns statistics of upstreams in order of config
+func (s *Service) Stats() []Stats {
+	return s.router.Stats()
+}
+
+// handle converts navigation data of terminal to general data according to profile and routes it to upstreams.
+// NPH_RESULT_OK is replied after data is queued.
+func (s *Service) handle(id int, packet *ndtp.Packet) uint32 {
+	if packet.IsResult() || packet.Service() != ndtp.NphSrvNavdata {
+		return ndtp.NphResultOk
+	}
+	data, err := s.conf.Profile.GeneralData(packet)
+	if err != nil {
+		return ndtp.NphResultPacketInvalidFormat
+	}
+	switch err = s.router.Route(uint32(id), data); err {
+	case nil:
+		return ndtp.NphResultOk
+	case general.ErrTimeOutOfRange:
+		return ndtp.NphResultPacketInvalidParameter
+	default:
+		return ndtp.NphResultServiceNotAvailable
+	}
+}
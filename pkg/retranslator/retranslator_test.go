@@ -0,0 +1,232 @@
+package retranslator
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/egorban/navprot/internal/testserver"
+	"github.com/egorban/navprot/pkg/egts"
+	"github.com/egorban/navprot/pkg/general"
+	"github.com/egorban/navprot/pkg/ndtp"
+)
+
+func TestLoadConfig(t *testing.T) {
+	conf, err := LoadConfig(strings.NewReader(`{
+		"listen": ":7001",
+		"queue_dir": "/tmp/q",
+		"upstreams": [{"name": "main", "addr": "localhost:7002"}],
+		"reconnect_interval": "2s",
+		"profile": {"fuel_sensor_number": 3}
+	}`))
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if conf.Listen != ":7001" || len(conf.Upstreams) != 1 || conf.ReconnectInterval != Duration(2*time.Second) ||
+		conf.Profile.FuelSensorNumber != 3 || conf.Profile.SosSource != 13 {
+		t.Errorf("LoadConfig() = %+v, profile %+v", conf, conf.Profile)
+	}
+	for _, bad := range []string{
+		`{"queue_dir": "q"}`,
+		`{"queue_dir": "q", "upstreams": [{"name": "../a", "addr": "x:1"}]}`,
+		`{"queue_dir": "q", "upstreams": [{"name": "a", "addr": "x:1"}, {"name": "a", "addr": "x:2"}]}`,
+		`{"queue_dir": "q", "upstreams": [{"name": "a", "addr": "x:1"}], "reconnect_interval": "5 min"}`,
+		`{"queue_dir": "q", "upstreams": [{"name": "a", "addr": "x:1", "protocol": "wialon"}]}`,
+		`{"queue_dir": "q", "upstreams": [{"name": "a", "addr": "x:1", "types": ["photo"]}]}`,
+		`{"queue_dir": "q", "upstreams": [{"name": "a", "addr": "x:1", "protocol": "ndtp", "types": ["sensors"]}]}`,
+	} {
+		if _, err = LoadConfig(strings.NewReader(bad)); err == nil {
+			t.Errorf("LoadConfig() accepted %s", bad)
+		}
+	}
+}
+
+// egtsServer confirms all records and sends them to received channel
+func egtsServer(t *testing.T, addr string, received chan<- *egts.Record) net.Listener {
+	return egtsReplyServer(t, addr, received, func(*egts.Record) (byte, bool) { return egts.Success, true })
+}
+
+// egtsReplyServer sends teledata records to received channel and replies status returned by reply,
+// record isn't confirmed in response if reply returns false
+func egtsReplyServer(t *testing.T, addr string, received chan<- *egts.Record,
+	reply func(rec *egts.Record) (rst byte, ok bool)) net.Listener {
+	return testserver.Listen(t, addr, func(conn net.Conn) {
+		dec, enc := egts.NewDecoder(conn), egts.NewEncoder(conn)
+		for {
+			packet, err := dec.Decode()
+			if err != nil {
+				return
+			}
+			resp := &egts.Packet{Type: egts.EgtsPtResponse, Data: &egts.Response{RPID: packet.ID}}
+			for _, rec := range packet.Records {
+				if rec.Service == egts.EgtsTeledataService {
+					received <- rec
+				}
+				rst, ok := reply(rec)
+				if !ok {
+					continue
+				}
+				resp.Records = append(resp.Records, &egts.Record{
+					RecNum:  rec.RecNum,
+					Service: rec.Service,
+					Data: []*egts.SubRecord{{Type: egts.EgtsSrResponse,
+						Data: &egts.Confirmation{CRN: rec.RecNum, RST: rst}}},
+				})
+			}
+			if enc.Encode(resp) != nil {
+				return
+			}
+		}
+	})
+}
+
+func freeAddr(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+func startService(t *testing.T, conf Config) (*Service, string) {
+	s, err := New(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(l)
+	return s, l.Addr().String()
+}
+
+func waitStats(t *testing.T, getStats func() []Stats, cond func(stats []Stats) bool) []Stats {
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		stats := getStats()
+		if cond(stats) {
+			return stats
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("unexpected stats %+v", stats)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestService(t *testing.T) {
+	dir, err := ioutil.TempDir("", "retranslator")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	mainReceived := make(chan *egts.Record, 10)
+	mainServer := egtsServer(t, "127.0.0.1:0", mainReceived)
+	defer mainServer.Close()
+	// the second upstream is not available until restart of service
+	backupAddr := freeAddr(t)
+	conf := Config{
+		QueueDir: dir,
+		Upstreams: []UpstreamConfig{
+			{Name: "main", Addr: mainServer.Addr().String()},
+			{Name: "backup", Addr: backupAddr},
+		},
+		ReconnectInterval: Duration(50 * time.Millisecond),
+	}
+	s, addr := startService(t, conf)
+
+	terminal := ndtp.NewTerminal(addr, 1024)
+	for i := 0; i < 3; i++ {
+		cells := []ndtp.Subrecord{&ndtp.NavData{Time: uint32(1600000000 + i), Lat: 55, Lon: 37, Valid: true}}
+		if err = terminal.SendNavData(true, cells); err != nil {
+			t.Fatalf("SendNavData() error = %v", err)
+		}
+	}
+	terminal.Close()
+	for i := 0; i < 3; i++ {
+		rec := <-mainReceived
+		if rec.ID != 1024 || rec.Time != uint32(1600000000+i)-uint32(egts.Epoch.Unix()) {
+			t.Errorf("main upstream received record %+v", rec)
+		}
+	}
+	stats := waitStats(t, s.Stats, func(stats []Stats) bool { return stats[0].RecordsConfirmed == 3 })
+	if stats[0].Queued != 0 || stats[0].PacketsSent != 3 || stats[0].Connects != 1 {
+		t.Errorf("main upstream stats %+v", stats[0])
+	}
+	if stats[1].Queued != 3 || stats[1].PacketsSent != 0 || stats[1].ConnectErrors == 0 {
+		t.Errorf("backup upstream stats %+v", stats[1])
+	}
+	if err = s.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	backupReceived := make(chan *egts.Record, 10)
+	backupServer := egtsServer(t, backupAddr, backupReceived)
+	defer backupServer.Close()
+	s, _ = startService(t, conf)
+	defer s.Close()
+	for i := 0; i < 3; i++ {
+		if rec := <-backupReceived; rec.ID != 1024 {
+			t.Errorf("backup upstream received record %+v", rec)
+		}
+	}
+	stats = waitStats(t, s.Stats, func(stats []Stats) bool { return stats[1].RecordsConfirmed == 3 })
+	if stats[1].Queued != 0 || stats[1].PacketsResent != 3 || stats[0].PacketsSent != 0 {
+		t.Errorf("stats after restart %+v", stats)
+	}
+}
+
+func TestService_unconfirmed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "retranslator")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	received := make(chan *egts.Record, 10)
+	var attempts, identities int32
+	// the first record is confirmed only when it's sent again, the second one is rejected
+	server := egtsReplyServer(t, "127.0.0.1:0", received, func(rec *egts.Record) (byte, bool) {
+		if id, ok := rec.Data[0].Data.(*egts.TermIdentity); ok {
+			if id.TID == 1024 && rec.ID == 1024 {
+				atomic.AddInt32(&identities, 1)
+			}
+			return egts.Success, true
+		}
+		pos, _ := rec.Data[0].Data.(*egts.PosData)
+		if pos == nil || pos.Lat > 55.5 {
+			return 151, true
+		}
+		return egts.Success, atomic.AddInt32(&attempts, 1) > 1
+	})
+	defer server.Close()
+	s, addr := startService(t, Config{
+		QueueDir:          dir,
+		Upstreams:         []UpstreamConfig{{Name: "main", Addr: server.Addr().String()}},
+		ReconnectInterval: Duration(50 * time.Millisecond),
+	})
+	defer s.Close()
+	terminal := ndtp.NewTerminal(addr, 1024)
+	defer terminal.Close()
+	for _, lat := range []general.Degrees{55, 56} {
+		cells := []ndtp.Subrecord{&ndtp.NavData{Time: 1600000000, Lat: lat, Lon: 37, Valid: true}}
+		if err = terminal.SendNavData(true, cells); err != nil {
+			t.Fatalf("SendNavData() error = %v", err)
+		}
+	}
+	stats := waitStats(t, s.Stats, func(stats []Stats) bool {
+		return stats[0].RecordsConfirmed == 1 && stats[0].RecordsRejected == 1
+	})
+	if stats[0].Queued != 0 || stats[0].PacketsResent == 0 {
+		t.Errorf("stats %+v, want unconfirmed packet to be resent", stats[0])
+	}
+	// identity is sent again after reconnection
+	if n := atomic.LoadInt32(&identities); n != int32(stats[0].Connects) || n < 2 {
+		t.Errorf("identity of object is sent %d times in %d connections", n, stats[0].Connects)
+	}
+}
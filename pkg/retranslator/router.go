@@ -0,0 +1,144 @@
+package retranslator
+
+import (
+	"errors"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+
+	"github.com/egorban/navprot/pkg/general"
+	"github.com/egorban/navprot/pkg/queue"
+)
+
+// ErrRouterClosed is returned by Route after Close
+var ErrRouterClosed = errors.New("router is closed")
+
+// Router sends general data of terminals to upstreams. Every upstream has its own protocol, ID mapping,
+// filter, queue and delivery state, so slow or unavailable upstream doesn't affect others.
+type Router struct {
+	conf      Config
+	upstreams []*upstream
+	recNum    uint32
+
+	mu      sync.Mutex
+	started bool
+	closed  bool
+	stop    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// NewRouter opens queues of upstreams of conf. Listen of conf is not used.
+// Zero values in conf are replaced by default values.
+func NewRouter(conf Config) (*Router, error) {
+	if err := conf.validate(); err != nil {
+		return nil, err
+	}
+	if conf.ReconnectInterval <= 0 {
+		conf.ReconnectInterval = Duration(DefaultReconnectInterval)
+	}
+	if conf.DialTimeout <= 0 {
+		conf.DialTimeout = Duration(DefaultDialTimeout)
+	}
+	if conf.IdleTimeout <= 0 {
+		conf.IdleTimeout = Duration(DefaultIdleTimeout)
+	}
+	r := &Router{conf: conf, stop: make(chan struct{})}
+	for _, uc := range conf.Upstreams {
+		q, err := queue.Open(filepath.Join(conf.QueueDir, uc.Name))
+		if err != nil {
+			r.closeQueues()
+			return nil, err
+		}
+		q.SyncWrites = conf.SyncWrites
+		r.upstreams = append(r.upstreams, newUpstream(uc, &r.conf, q))
+	}
+	return r, nil
+}
+
+// Start starts delivery of queued packets to upstreams
+func (r *Router) Start() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.started || r.closed {
+		return
+	}
+	r.started = true
+	for _, u := range r.upstreams {
+		r.wg.Add(1)
+		go func(u *upstream) {
+			defer r.wg.Done()
+			u.run(r.stop)
+		}(u)
+	}
+}
+
+// Route converts data of terminal for every upstream, which accepts it, and puts it into upstream queue.
+// Upstreams are independent: if data can't be converted or queued for some of them, it's counted
+// in their Counters.PacketsDropped and still queued for others. Error is returned only if data is queued
+// for none of upstreams accepting it, so terminal can send it again without duplicates.
+// Data is delivered after Start.
+func (r *Router) Route(terminalID uint32, data []general.Subrecord) error {
+	select {
+	case <-r.stop:
+		return ErrRouterClosed
+	default:
+	}
+	nextRecNum := func() uint16 {
+		return uint16(atomic.AddUint32(&r.recNum, 1))
+	}
+	var firstErr error
+	queued := false
+	for _, u := range r.upstreams {
+		packet, err := u.encode(terminalID, data, nextRecNum)
+		if err == nil && packet == nil {
+			continue
+		}
+		if err == nil {
+			err = u.put(packet)
+		}
+		if err != nil {
+			atomic.AddUint64(&u.counters.PacketsDropped, 1)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		queued = true
+	}
+	if queued {
+		return nil
+	}
+	return firstErr
+}
+
+// Stats returns statistics of upstreams in order of config
+func (r *Router) Stats() []Stats {
+	stats := make([]Stats, 0, len(r.upstreams))
+	for _, u := range r.upstreams {
+		stats = append(stats, u.stats())
+	}
+	return stats
+}
+
+// Close stops delivery and closes queues, undelivered packets stay in queues
+func (r *Router) Close() error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return ErrRouterClosed
+	}
+	r.closed = true
+	close(r.stop)
+	r.mu.Unlock()
+	r.wg.Wait()
+	return r.closeQueues()
+}
+
+func (r *Router) closeQueues() (err error) {
+	for _, u := range r.upstreams {
+		if cerr := u.queue.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return
+}
@@ -0,0 +1,157 @@
+package retranslator
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/egorban/navprot/internal/testserver"
+	"github.com/egorban/navprot/pkg/convertation"
+	"github.com/egorban/navprot/pkg/egts"
+	"github.com/egorban/navprot/pkg/general"
+	"github.com/egorban/navprot/pkg/ndtp"
+)
+
+// ndtpServer sends navigation data to received channel and replies NPH_RESULT_OK to all packets,
+// except connection requests of rejected object
+func ndtpServer(t *testing.T, received chan<- *ndtp.Packet, rejected int) net.Listener {
+	return testserver.Listen(t, "127.0.0.1:0", func(conn net.Conn) {
+		ndtp.NewSession(conn, func(id int, packet *ndtp.Packet) uint32 {
+			if id == rejected {
+				return ndtp.NphResultClientNotRegistered
+			}
+			if packet.Service() == ndtp.NphSrvNavdata {
+				received <- packet
+			}
+			return ndtp.NphResultOk
+		}).Serve()
+	})
+}
+
+func TestRouter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "router")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	egtsReceived := make(chan *egts.Record, 10)
+	egtsTarget := egtsServer(t, "127.0.0.1:0", egtsReceived)
+	defer egtsTarget.Close()
+	ndtpReceived := make(chan *ndtp.Packet, 10)
+	ndtpTarget := ndtpServer(t, ndtpReceived, 4096)
+	defer ndtpTarget.Close()
+	r, err := NewRouter(Config{
+		QueueDir: dir,
+		Upstreams: []UpstreamConfig{
+			{Name: "regional", Addr: egtsTarget.Addr().String(), IDMap: map[uint32]uint32{1024: 5000},
+				Types: []string{convertation.ForwardNav}},
+			{Name: "insurance", Addr: ndtpTarget.Addr().String(), Protocol: ndtp.ProtocolName,
+				Objects: []uint32{2048, 4096}},
+			{Name: "unavailable", Addr: freeAddr(t)},
+		},
+		ReconnectInterval: Duration(50 * time.Millisecond),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	r.Start()
+	// object 4096 can't connect to insurance upstream, it doesn't delay object 2048
+	for _, id := range []uint32{4096, 1024, 2048} {
+		data := []general.Subrecord{
+			&general.NavData{Time: 1600000000, Lat: 55, Lon: 37, Valid: true, RealTime: true},
+			&general.FuelData{Type: 2, Fuel: 100},
+		}
+		if err = r.Route(id, data); err != nil {
+			t.Fatalf("Route() error = %v", err)
+		}
+	}
+	for _, id := range []uint32{4096, 5000, 2048} {
+		rec := <-egtsReceived
+		if rec.ID != id || len(rec.Data) != 1 || rec.Data[0].Type != egts.EgtsSrPosData {
+			t.Errorf("regional upstream received %+v, want position data of object %d", rec, id)
+		}
+	}
+	packet := <-ndtpReceived
+	if cells, ok := packet.Nph.Data.([]ndtp.Subrecord); !ok || len(cells) != 2 {
+		t.Errorf("insurance upstream received %v, want navigation and fuel data", packet)
+	}
+	stats := waitStats(t, r.Stats, func(stats []Stats) bool {
+		return stats[0].RecordsConfirmed == 3 && stats[1].RecordsConfirmed == 1 && stats[1].ConnectErrors > 0
+	})
+	if stats[0].Queued != 0 || stats[1].Queued != 1 || stats[1].PacketsSent != 1 {
+		t.Errorf("stats of available upstreams %+v", stats[:2])
+	}
+	if stats[2].Queued != 3 || stats[2].PacketsSent != 0 {
+		t.Errorf("stats of unavailable upstream %+v", stats[2])
+	}
+
+	// data, which can't be converted to EGTS, is still queued for NDTP upstream
+	old := []general.Subrecord{&general.NavData{Time: 1000000000, Lat: 55, Lon: 37, Valid: true}}
+	if err = r.Route(2048, old); err != nil {
+		t.Fatalf("Route() of data before EGTS epoch error = %v", err)
+	}
+	<-ndtpReceived
+	stats = r.Stats()
+	if stats[0].PacketsDropped != 1 || stats[1].PacketsDropped != 0 || stats[2].PacketsDropped != 1 {
+		t.Errorf("dropped packets of upstreams %d, %d, %d", stats[0].PacketsDropped, stats[1].PacketsDropped,
+			stats[2].PacketsDropped)
+	}
+	if err = r.Route(1024, old); err != general.ErrTimeOutOfRange {
+		t.Errorf("Route() of data, which no upstream accepts, error = %v, want %v", err, general.ErrTimeOutOfRange)
+	}
+	if err = r.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if err = r.Route(1024, nil); err != ErrRouterClosed {
+		t.Errorf("Route() after Close error = %v, want %v", err, ErrRouterClosed)
+	}
+}
+
+func TestRouter_ndtpResult(t *testing.T) {
+	dir, err := ioutil.TempDir("", "router")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	received := make(chan *ndtp.Packet, 10)
+	var results int32
+	// the first packet is not accepted, it must be sent again
+	target := testserver.Listen(t, "127.0.0.1:0", func(conn net.Conn) {
+		ndtp.NewSession(conn, func(id int, packet *ndtp.Packet) uint32 {
+			if packet.Service() != ndtp.NphSrvNavdata {
+				return ndtp.NphResultOk
+			}
+			received <- packet
+			if atomic.AddInt32(&results, 1) == 1 {
+				return ndtp.NphResultServiceNotAvailable
+			}
+			return ndtp.NphResultOk
+		}).Serve()
+	})
+	defer target.Close()
+	r, err := NewRouter(Config{
+		QueueDir:          dir,
+		Upstreams:         []UpstreamConfig{{Name: "insurance", Addr: target.Addr().String(), Protocol: ndtp.ProtocolName}},
+		ReconnectInterval: Duration(20 * time.Millisecond),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	r.Start()
+	data := []general.Subrecord{&general.NavData{Time: 1600000000, Lat: 55, Lon: 37, Valid: true}}
+	if err = r.Route(2048, data); err != nil {
+		t.Fatalf("Route() error = %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		<-received
+	}
+	stats := waitStats(t, r.Stats, func(stats []Stats) bool { return stats[0].RecordsConfirmed == 1 })
+	if stats[0].Queued != 0 || stats[0].PacketsSent != 2 || stats[0].PacketsResent != 1 {
+		t.Errorf("stats %+v, want packet to be sent again after error result", stats[0])
+	}
+}
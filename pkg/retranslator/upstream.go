@@ -0,0 +1,513 @@
+package retranslator
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/egorban/navprot/pkg/convertation"
+	"github.com/egorban/navprot/pkg/egts"
+	"github.com/egorban/navprot/pkg/general"
+	"github.com/egorban/navprot/pkg/ndtp"
+	"github.com/egorban/navprot/pkg/queue"
+)
+
+// sendBatch is max number of queued packets taken at once
+const sendBatch = 64
+
+var (
+	errStopped    = errors.New("upstream is stopped")
+	errNoResponse = errors.New("upstream doesn't respond")
+)
+
+// Counters contains statistics of upstream
+type Counters struct {
+	// Queued is number of packets waiting for confirmation
+	Queued int
+	// PacketsSent is number of sent packets, including packets sent again after reconnection
+	PacketsSent uint64
+	// PacketsResent is number of packets sent again after reconnection or restart
+	PacketsResent uint64
+	// RecordsSent is number of sent records, every NDTP packet is counted as one record
+	RecordsSent uint64
+	// RecordsConfirmed is number of records confirmed by upstream
+	RecordsConfirmed uint64
+	// RecordsRejected is number of EGTS records with unsuccessful status, they are dropped and not sent again.
+	// NDTP packets with unsuccessful result are kept in queue and sent again.
+	RecordsRejected uint64
+	// PacketsDropped is number of packets, which were not queued because of conversion or queue error
+	PacketsDropped uint64
+	// Connects is number of established connections
+	Connects uint64
+	// ConnectErrors is number of failed connection attempts
+	ConnectErrors uint64
+	// Disconnects is number of lost connections
+	Disconnects uint64
+}
+
+// Stats contains statistics of upstream
+type Stats struct {
+	Name string
+	Addr string
+	Counters
+}
+
+// inflight is queued packet sent to upstream
+type inflight struct {
+	seq uint64
+	// left is number of records without confirmation
+	left int
+}
+
+// upstream filters and converts data for target server and delivers packets of its queue to it
+type upstream struct {
+	conf     UpstreamConfig
+	service  *Config
+	queue    *queue.Queue
+	counters Counters
+	wake     chan struct{}
+	objects  map[uint32]bool
+	types    map[string]bool
+
+	mu sync.Mutex
+	// lastSent is the greatest sequence number sent in previous connections, packets up to it are resent
+	lastSent uint64
+}
+
+func newUpstream(conf UpstreamConfig, service *Config, q *queue.Queue) *upstream {
+	if conf.Protocol == "" {
+		conf.Protocol = egts.ProtocolName
+	}
+	u := &upstream{
+		conf:    conf,
+		service: service,
+		queue:   q,
+		wake:    make(chan struct{}, 1),
+		objects: make(map[uint32]bool),
+		types:   make(map[string]bool),
+	}
+	for _, id := range conf.Objects {
+		u.objects[id] = true
+	}
+	for _, name := range conf.Types {
+		u.types[name] = true
+	}
+	// packets left in queue after restart are resent
+	u.lastSent = q.Last()
+	return u
+}
+
+// encode filters data of terminal and converts it to packet of upstream protocol,
+// nil is returned if nothing is forwarded. NDTP packet is preceded by object ID, because NDTP server
+// identifies object by NPH_SGC_CONN_REQUEST of connection, which is sent before data.
+func (u *upstream) encode(terminalID uint32, data []general.Subrecord, nextRecNum func() uint16) ([]byte, error) {
+	if len(u.objects) > 0 && !u.objects[terminalID] {
+		return nil, nil
+	}
+	filtered := make([]general.Subrecord, 0, len(data))
+	for _, sub := range data {
+		if len(u.types) == 0 || u.types[convertation.TypeName(sub)] {
+			filtered = append(filtered, sub)
+		}
+	}
+	id := terminalID
+	if mapped, ok := u.conf.IDMap[terminalID]; ok {
+		id = mapped
+	}
+	if u.conf.Protocol == ndtp.ProtocolName {
+		packet, err := convertation.GeneralToNDTP(filtered, id)
+		if packet == nil || err != nil {
+			return nil, err
+		}
+		message := make([]byte, 4+len(packet.Packet))
+		binary.LittleEndian.PutUint32(message, id)
+		copy(message[4:], packet.Packet)
+		return message, nil
+	}
+	packet, err := convertation.GeneralToEGTS(filtered, id, 0, convertation.Options{
+		Profile:    u.service.Profile,
+		NextRecNum: nextRecNum,
+	})
+	if err != nil || len(packet.Records) == 0 {
+		return nil, err
+	}
+	return packet.Form()
+}
+
+// put adds formed packet to queue
+func (u *upstream) put(packet []byte) error {
+	if _, err := u.queue.Put(packet); err != nil {
+		return err
+	}
+	select {
+	case u.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (u *upstream) stats() Stats {
+	s := Stats{Name: u.conf.Name, Addr: u.conf.Addr}
+	s.Queued = u.queue.Len()
+	s.PacketsSent = atomic.LoadUint64(&u.counters.PacketsSent)
+	s.PacketsResent = atomic.LoadUint64(&u.counters.PacketsResent)
+	s.RecordsSent = atomic.LoadUint64(&u.counters.RecordsSent)
+	s.RecordsConfirmed = atomic.LoadUint64(&u.counters.RecordsConfirmed)
+	s.RecordsRejected = atomic.LoadUint64(&u.counters.RecordsRejected)
+	s.PacketsDropped = atomic.LoadUint64(&u.counters.PacketsDropped)
+	s.Connects = atomic.LoadUint64(&u.counters.Connects)
+	s.ConnectErrors = atomic.LoadUint64(&u.counters.ConnectErrors)
+	s.Disconnects = atomic.LoadUint64(&u.counters.Disconnects)
+	return s
+}
+
+// run connects to upstream and sends queued packets until stop is closed
+func (u *upstream) run(stop <-chan struct{}) {
+	for {
+		if err := u.session(stop); err == errStopped {
+			return
+		}
+		select {
+		case <-stop:
+			return
+		case <-time.After(time.Duration(u.service.ReconnectInterval)):
+		}
+	}
+}
+
+// session sends queued packets until connection is lost. Packets are removed from queue, when they are
+// confirmed or rejected. Unconfirmed packets are sent again in the next session.
+func (u *upstream) session(stop <-chan struct{}) error {
+	if u.conf.Protocol == ndtp.ProtocolName {
+		return u.ndtpSession(stop)
+	}
+	return u.egtsSession(stop)
+}
+
+// sent counts sent packet
+func (u *upstream) sent(seq uint64, records int) {
+	atomic.AddUint64(&u.counters.PacketsSent, 1)
+	atomic.AddUint64(&u.counters.RecordsSent, uint64(records))
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if seq <= u.lastSent {
+		atomic.AddUint64(&u.counters.PacketsResent, 1)
+	} else {
+		u.lastSent = seq
+	}
+}
+
+// egtsSession sends packets over one connection, packet is confirmed when all its records are confirmed.
+// Identity of every object is sent before its first packet in session.
+func (u *upstream) egtsSession(stop <-chan struct{}) error {
+	conn, err := net.DialTimeout("tcp", u.conf.Addr, time.Duration(u.service.DialTimeout))
+	if err != nil {
+		atomic.AddUint64(&u.counters.ConnectErrors, 1)
+		return err
+	}
+	atomic.AddUint64(&u.counters.Connects, 1)
+	var mu sync.Mutex
+	sent := make(map[*egts.Record]*inflight)
+	broken := make(chan struct{}, 1)
+	// done forgets sent record, packet is removed from queue when all its records are done.
+	// False is returned for records of authorization, which are not queued.
+	done := func(rec *egts.Record, ack bool) bool {
+		mu.Lock()
+		p, ok := sent[rec]
+		delete(sent, rec)
+		mu.Unlock()
+		if ok && ack {
+			if p.left--; p.left == 0 {
+				u.queue.Ack(p.seq)
+			}
+		}
+		return ok
+	}
+	client := egts.NewClient(conn, egts.ClientConfig{
+		ResponseTimeout: time.Duration(u.service.ResponseTimeout),
+		OnConfirm: func(rec *egts.Record) {
+			if done(rec, true) {
+				atomic.AddUint64(&u.counters.RecordsConfirmed, 1)
+			}
+		},
+		OnFail: func(rec *egts.Record, err error) {
+			// only record rejected by upstream is dropped, packet of record without confirmation
+			// stays in queue and it's sent again in the next session
+			if _, ok := err.(*egts.ResultError); ok {
+				if done(rec, true) {
+					atomic.AddUint64(&u.counters.RecordsRejected, 1)
+				}
+				return
+			}
+			done(rec, false)
+			select {
+			case broken <- struct{}{}:
+			default:
+			}
+		},
+	})
+	defer client.Close()
+	// Send blocks while window is full, so client is closed to interrupt it
+	sessionDone := make(chan struct{})
+	defer close(sessionDone)
+	go func() {
+		select {
+		case <-stop:
+			client.Close()
+		case <-sessionDone:
+		}
+	}()
+	// authorized contains objects, which identity is sent in this session
+	authorized := make(map[uint32]bool)
+	var last uint64
+	for {
+		items, err := u.queue.Unacked(last, sendBatch)
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			packet := new(egts.Packet)
+			if _, err = packet.Parse(item.Data); err != nil || len(packet.Records) == 0 {
+				u.queue.Ack(item.Seq)
+				continue
+			}
+			for _, rec := range packet.Records {
+				if authorized[rec.ID] {
+					continue
+				}
+				if err = authorize(client, rec.ID); err != nil {
+					return u.disconnected(stop, err)
+				}
+				authorized[rec.ID] = true
+			}
+			p := &inflight{seq: item.Seq, left: len(packet.Records)}
+			mu.Lock()
+			for _, rec := range packet.Records {
+				sent[rec] = p
+			}
+			mu.Unlock()
+			if err = client.Send(packet); err != nil {
+				return u.disconnected(stop, err)
+			}
+			last = item.Seq
+			u.sent(item.Seq, len(packet.Records))
+		}
+		if len(items) == sendBatch {
+			continue
+		}
+		select {
+		case <-u.wake:
+		case <-stop:
+			return errStopped
+		case <-client.Done():
+			return u.disconnected(stop, client.Err())
+		case <-broken:
+			return u.disconnected(stop, errNoResponse)
+		}
+	}
+}
+
+// authorize sends EGTS_SR_TERM_IDENTITY of object, platforms require it before data of object
+func authorize(client *egts.Client, id uint32) error {
+	packet, err := convertation.ConnRequestToEGTS(ndtp.NewConnRequest(id), 0, 0)
+	if err != nil {
+		return err
+	}
+	return client.Send(packet)
+}
+
+// disconnected counts lost connection, errStopped is returned if connection is closed by stop
+func (u *upstream) disconnected(stop <-chan struct{}, err error) error {
+	select {
+	case <-stop:
+		return errStopped
+	default:
+	}
+	atomic.AddUint64(&u.counters.Disconnects, 1)
+	return err
+}
+
+// ndtpSession distributes queued packets to objects, every object sends its packets over its own connection,
+// so unavailable object doesn't delay others. Session ends only when stop is closed.
+func (u *upstream) ndtpSession(stop <-chan struct{}) error {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	objects := make(map[uint32]*ndtpObject)
+	defer wg.Wait()
+	var last uint64
+	for {
+		items, err := u.queue.Unacked(last, sendBatch)
+		if err != nil {
+			// queue is read again after a pause
+			select {
+			case <-time.After(time.Duration(u.service.ReconnectInterval)):
+				continue
+			case <-stop:
+				return errStopped
+			}
+		}
+		for _, item := range items {
+			last = item.Seq
+			if len(item.Data) < 4 {
+				u.queue.Ack(item.Seq)
+				continue
+			}
+			id := binary.LittleEndian.Uint32(item.Data)
+			mu.Lock()
+			o, ok := objects[id]
+			if !ok {
+				o = &ndtpObject{id: id, wake: make(chan struct{}, 1)}
+				objects[id] = o
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					u.ndtpObject(o, stop, func() bool {
+						// object is removed only if no packets were added to it meanwhile
+						mu.Lock()
+						defer mu.Unlock()
+						if o.len() > 0 {
+							return false
+						}
+						delete(objects, o.id)
+						return true
+					})
+				}()
+			}
+			o.push(item)
+			mu.Unlock()
+		}
+		if len(items) == sendBatch {
+			continue
+		}
+		select {
+		case <-u.wake:
+		case <-stop:
+			return errStopped
+		}
+	}
+}
+
+// ndtpObject contains packets of object waiting for delivery to NDTP upstream
+type ndtpObject struct {
+	id    uint32
+	wake  chan struct{}
+	mu    sync.Mutex
+	items []queue.Item
+}
+
+func (o *ndtpObject) push(item queue.Item) {
+	o.mu.Lock()
+	o.items = append(o.items, item)
+	o.mu.Unlock()
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+// first returns the oldest packet of object without removing it
+func (o *ndtpObject) first() (queue.Item, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if len(o.items) == 0 {
+		return queue.Item{}, false
+	}
+	return o.items[0], true
+}
+
+func (o *ndtpObject) pop() {
+	o.mu.Lock()
+	o.items = o.items[1:]
+	o.mu.Unlock()
+}
+
+func (o *ndtpObject) len() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return len(o.items)
+}
+
+// ndtpObject sends packets of object one by one waiting for NPH_RESULT. Failed packet is sent again
+// after reconnection, packet with error result is sent again after ReconnectInterval. Connection is closed after IdleTimeout without packets, then remove is called
+// and delivery ends if it returns true.
+func (u *upstream) ndtpObject(o *ndtpObject, stop <-chan struct{}, remove func() bool) {
+	var terminal *ndtp.Terminal
+	defer func() {
+		if terminal != nil {
+			terminal.Close()
+		}
+	}()
+	wait := func(d time.Duration) bool {
+		select {
+		case <-stop:
+			return false
+		case <-time.After(d):
+			return true
+		}
+	}
+	for {
+		item, ok := o.first()
+		if !ok {
+			select {
+			case <-o.wake:
+			case <-stop:
+				return
+			case <-time.After(time.Duration(u.service.IdleTimeout)):
+				if terminal != nil {
+					terminal.Close()
+					terminal = nil
+				}
+				if remove() {
+					return
+				}
+			}
+			continue
+		}
+		packet := new(ndtp.Packet)
+		if _, err := packet.Parse(item.Data[4:]); err != nil {
+			u.queue.Ack(item.Seq)
+			o.pop()
+			continue
+		}
+		if terminal == nil {
+			terminal = ndtp.NewTerminal(u.conf.Addr, o.id)
+			terminal.Attempts = 1
+			terminal.DialTimeout = time.Duration(u.service.DialTimeout)
+			if u.service.ResponseTimeout > 0 {
+				terminal.ReplyTimeout = time.Duration(u.service.ResponseTimeout)
+			}
+			if err := terminal.Connect(); err != nil {
+				atomic.AddUint64(&u.counters.ConnectErrors, 1)
+				terminal = nil
+				if !wait(time.Duration(u.service.ReconnectInterval)) {
+					return
+				}
+				continue
+			}
+			atomic.AddUint64(&u.counters.Connects, 1)
+		}
+		err := terminal.Send(packet)
+		if _, ok := err.(*ndtp.ResultError); ok {
+			// packet is delivered, but not accepted, it's kept and sent again after a pause
+			u.sent(item.Seq, 1)
+			if !wait(time.Duration(u.service.ReconnectInterval)) {
+				return
+			}
+			continue
+		} else if err != nil {
+			terminal.Close()
+			terminal = nil
+			if u.disconnected(stop, err) == errStopped || !wait(time.Duration(u.service.ReconnectInterval)) {
+				return
+			}
+			continue
+		}
+		u.sent(item.Seq, 1)
+		atomic.AddUint64(&u.counters.RecordsConfirmed, 1)
+		u.queue.Ack(item.Seq)
+		o.pop()
+	}
+}
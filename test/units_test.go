@@ -0,0 +1,59 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/egorban/navprot/pkg/convertation"
+	"github.com/egorban/navprot/pkg/egts"
+	"github.com/egorban/navprot/pkg/general"
+	"github.com/egorban/navprot/pkg/ndtp"
+)
+
+func TestNDTPtoEGTSRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		lon   general.Degrees
+		lat   general.Degrees
+		speed general.KmH
+	}{
+		{name: "moscow", lon: 37.6925783, lat: 55.7890249, speed: 60},
+		{name: "southWest", lon: -179.9999999, lat: -89.9999999, speed: 1},
+		{name: "zero", lon: 0, lat: 0, speed: 0},
+		{name: "maxSpeed", lon: 0.0000001, lat: 0.0000001, speed: 1638},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ndtpPacket := ndtp.NewNavData(true, []ndtp.Subrecord{
+				&ndtp.NavData{Time: 1522961700, Lon: tt.lon, Lat: tt.lat, Speed: tt.speed, Valid: true},
+			})
+			bin, err := ndtpPacket.Form()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var parsedNdtp ndtp.Packet
+			if _, err = parsedNdtp.Parse(bin); err != nil {
+				t.Fatal(err)
+			}
+			egtsPacket, err := convertation.ToEGTS(&parsedNdtp, 1, 0, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bin, err = egtsPacket.Form(); err != nil {
+				t.Fatal(err)
+			}
+			var parsedEgts egts.Packet
+			if _, err = parsedEgts.Parse(bin); err != nil {
+				t.Fatal(err)
+			}
+			data, err := parsedEgts.ToGeneral()
+			if err != nil {
+				t.Fatal(err)
+			}
+			nav := data[0].(*general.NavData)
+			if !nav.Lon.Equal(tt.lon) || !nav.Lat.Equal(tt.lat) || !nav.Speed.Equal(tt.speed) {
+				t.Errorf("got Lon:%v Lat:%v Speed:%v, expected Lon:%v Lat:%v Speed:%v",
+					nav.Lon, nav.Lat, nav.Speed, tt.lon, tt.lat, tt.speed)
+			}
+		})
+	}
+}